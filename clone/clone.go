@@ -2,9 +2,11 @@ package clone
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"path"
+	"strconv"
 )
 
 type Input struct {
@@ -13,11 +15,40 @@ type Input struct {
 	WorkDir string
 	// GitURL to clone.
 	GitURL string
+	// Ref to check out after cloning, e.g. a tag, branch, or commit SHA.
+	// If empty, the default branch is used.
+	Ref string
+	// MirrorURL, if set, is added as the MirrorRemote remote, so that changes can also be pushed there
+	MirrorURL string
+	// Depth, if set, makes a shallow clone with this many commits of history, which is faster for large repos.
+	// The history is fetched on demand if it's needed, see Unshallow.
+	Depth int
+	// Dir, if set, is where the repo is cloned instead of {WorkDir}/cloned, e.g. for a GOPATH-style layout
+	Dir string
 }
 
+// MirrorRemote is the name of the remote added for Input.MirrorURL
+const MirrorRemote = "mirror"
+
 type Output struct {
 	Success       bool
 	ClonedIntoDir string
+	// Ref that was checked out, if any
+	Ref string
+	// RefIsBranch is true if Ref is a branch on the remote
+	RefIsBranch bool
+	// Permission is the authenticated user's permission level on the repo, e.g. "push", if known
+	Permission string `json:",omitempty"`
+	// DefaultBranch is the repo's default branch according to the provider's API when it was cloned, if known
+	DefaultBranch string `json:",omitempty"`
+	// MirrorURL is the URL of the MirrorRemote remote, if any
+	MirrorURL string `json:",omitempty"`
+	// Shallow is true if the clone has truncated history, see Input.Depth
+	Shallow bool `json:",omitempty"`
+	// Deepened is true if a shallow clone's full history was fetched because a step needed it
+	Deepened bool `json:",omitempty"`
+	// Layout is how ClonedIntoDir was chosen, e.g. "host-org-repo", so that plan lays out its copy the same way
+	Layout string `json:",omitempty"`
 }
 
 type Error struct {
@@ -27,15 +58,89 @@ type Error struct {
 
 func Clone(ctx context.Context, input Input) (Output, error) {
 	cloneIntoDir := path.Join(input.WorkDir, "cloned")
-	if _, err := os.Stat(cloneIntoDir); err == nil {
-		// already cloned
-		return Output{Success: true, ClonedIntoDir: cloneIntoDir}, nil
+	if input.Dir != "" {
+		cloneIntoDir = input.Dir
+	}
+	if _, err := os.Stat(cloneIntoDir); err != nil {
+		if err := os.MkdirAll(path.Dir(cloneIntoDir), 0755); err != nil {
+			return Output{Success: false}, err
+		}
+		args := []string{"clone"}
+		if input.Depth > 0 {
+			// all branches, so that a Ref that's a branch can be checked out
+			args = append(args, "--depth", strconv.Itoa(input.Depth), "--no-single-branch")
+		}
+		cmd := exec.CommandContext(ctx, "git", append(args, input.GitURL, cloneIntoDir)...)
+		cmd.Dir = input.WorkDir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return Output{Success: false}, Error{error: err, Details: string(output)}
+		}
+	}
+	if input.MirrorURL != "" {
+		if err := addRemote(ctx, cloneIntoDir, MirrorRemote, input.MirrorURL); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+	if input.Ref == "" {
+		return Output{Success: true, ClonedIntoDir: cloneIntoDir, MirrorURL: input.MirrorURL, Shallow: IsShallow(cloneIntoDir)}, nil
 	}
 
-	cmd := exec.CommandContext(ctx, "git", "clone", input.GitURL, cloneIntoDir)
-	cmd.Dir = input.WorkDir
+	// Check out the ref, failing if it doesn't exist rather than silently using the default branch.
+	// A shallow clone may not have it, e.g. an old tag or commit, so its history is fetched first.
+	deepened := false
+	if !hasRef(ctx, cloneIntoDir, input.Ref) && IsShallow(cloneIntoDir) {
+		if err := Unshallow(ctx, cloneIntoDir); err != nil {
+			return Output{Success: false}, err
+		}
+		deepened = true
+	}
+	if !hasRef(ctx, cloneIntoDir, input.Ref) {
+		return Output{Success: false}, Error{error: fmt.Errorf("ref %s does not exist", input.Ref)}
+	}
+	cmd := exec.CommandContext(ctx, "git", "checkout", input.Ref)
+	cmd.Dir = cloneIntoDir
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return Output{Success: false}, Error{error: err, Details: string(output)}
 	}
-	return Output{Success: true, ClonedIntoDir: cloneIntoDir}, nil
+
+	cmd = exec.CommandContext(ctx, "git", "show-ref", "--verify", "--quiet", "refs/remotes/origin/"+input.Ref)
+	cmd.Dir = cloneIntoDir
+	refIsBranch := cmd.Run() == nil
+
+	return Output{
+		Success:       true,
+		ClonedIntoDir: cloneIntoDir,
+		Ref:           input.Ref,
+		RefIsBranch:   refIsBranch,
+		MirrorURL:     input.MirrorURL,
+		Shallow:       IsShallow(cloneIntoDir),
+		Deepened:      deepened,
+	}, nil
+}
+
+// hasRef returns whether a ref is a commit in the repo, including a branch that only exists on the remote,
+// which isn't known locally until it's checked out
+func hasRef(ctx context.Context, dir, ref string) bool {
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	cmd.Dir = dir
+	if cmd.Run() == nil {
+		return true
+	}
+	cmd = exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", "origin/"+ref+"^{commit}")
+	cmd.Dir = dir
+	return cmd.Run() == nil
+}
+
+// addRemote adds a remote to a repo, or updates its URL if it already exists, e.g. from a previous clone
+func addRemote(ctx context.Context, dir, name, url string) error {
+	cmd := exec.CommandContext(ctx, "git", "remote", "add", name, url)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		cmd = exec.CommandContext(ctx, "git", "remote", "set-url", name, url)
+		cmd.Dir = dir
+		if _, setErr := cmd.CombinedOutput(); setErr != nil {
+			return Error{error: fmt.Errorf("failed to add remote %s", name), Details: string(output)}
+		}
+	}
+	return nil
 }
@@ -0,0 +1,96 @@
+package clone
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testRemote makes a repo to clone with three commits on master and a "feature" branch from the second.
+// It returns its URL and the first commit, which is only in the full history.
+func testRemote(t *testing.T, dir string) (string, string) {
+	remote := filepath.Join(dir, "remote")
+	for _, args := range [][]string{
+		{"init", "-q", remote},
+		{"-C", remote, "checkout", "-q", "-b", "master"},
+		{"-C", remote, "commit", "-q", "--allow-empty", "-m", "one"},
+		{"-C", remote, "commit", "-q", "--allow-empty", "-m", "two"},
+		{"-C", remote, "branch", "feature"},
+		{"-C", remote, "commit", "-q", "--allow-empty", "-m", "three"},
+	} {
+		output, err := exec.Command("git", append([]string{"-c", "user.name=mp", "-c", "user.email=mp@example.com"}, args...)...).CombinedOutput()
+		assert.NoError(t, err, string(output))
+	}
+	first, err := exec.Command("git", "-C", remote, "rev-parse", "HEAD~2").Output()
+	assert.NoError(t, err)
+	// shallow clones of a local repo need a file:// URL
+	return "file://" + remote, strings.TrimSpace(string(first))
+}
+
+func TestCloneShallow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-clone")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	remote, first := testRemote(t, dir)
+	ctx := context.Background()
+
+	output, err := Clone(ctx, Input{WorkDir: dir, GitURL: remote, Depth: 1, Dir: filepath.Join(dir, "shallow")})
+	assert.NoError(t, err)
+	assert.True(t, output.Shallow)
+	assert.False(t, output.Deepened)
+
+	// a branch is fetched with --no-single-branch, so doesn't need the full history
+	output, err = Clone(ctx, Input{WorkDir: dir, GitURL: remote, Depth: 1, Ref: "feature", Dir: filepath.Join(dir, "branch")})
+	assert.NoError(t, err)
+	assert.True(t, output.RefIsBranch)
+	assert.True(t, output.Shallow)
+
+	// an old commit isn't in the shallow history, so it's deepened
+	output, err = Clone(ctx, Input{WorkDir: dir, GitURL: remote, Depth: 1, Ref: first, Dir: filepath.Join(dir, "commit")})
+	assert.NoError(t, err)
+	assert.False(t, output.RefIsBranch)
+	assert.False(t, output.Shallow)
+	assert.True(t, output.Deepened)
+
+	_, err = Clone(ctx, Input{WorkDir: dir, GitURL: remote, Depth: 1, Ref: "v2", Dir: filepath.Join(dir, "missing")})
+	assert.EqualError(t, err, "ref v2 does not exist")
+}
+
+func TestUnshallow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-clone")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	remote, first := testRemote(t, dir)
+	ctx := context.Background()
+	output, err := Clone(ctx, Input{WorkDir: dir, GitURL: remote, Depth: 1})
+	assert.NoError(t, err)
+	assert.False(t, hasRef(ctx, output.ClonedIntoDir, first))
+
+	assert.NoError(t, Unshallow(ctx, output.ClonedIntoDir))
+	assert.False(t, IsShallow(output.ClonedIntoDir))
+	assert.True(t, hasRef(ctx, output.ClonedIntoDir, first))
+	assert.True(t, hasRef(ctx, output.ClonedIntoDir, "feature"))
+	// it's already deep
+	assert.NoError(t, Unshallow(ctx, output.ClonedIntoDir))
+}
+
+func TestIsHistoryError(t *testing.T) {
+	for _, message := range []string{
+		"fatal: ambiguous argument 'HEAD~5': unknown revision or path not in the working tree.",
+		"fatal: bad revision 'v1.0..HEAD'",
+		"fatal: Not a valid object name v1.0",
+		"error: Could not read 1234abcd\nfatal: revision walk setup failed\nshallow update not allowed",
+		"fatal: no merge base found",
+	} {
+		assert.True(t, IsHistoryError(errors.New(message)), message)
+	}
+	assert.False(t, IsHistoryError(errors.New("go: cannot find main module")))
+	assert.False(t, IsHistoryError(nil))
+}
@@ -0,0 +1,73 @@
+package clone
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+// RepoInfo is what the provider's API says about a repo
+type RepoInfo struct {
+	// Permission is the authenticated user's permission level on the repo: "admin", "push", or "pull"
+	Permission string
+	// DefaultBranch is the repo's current default branch, e.g. "main"
+	DefaultBranch string
+}
+
+// GitHubRepoInfo returns the authenticated user's permission level on a repo, and the repo's default branch.
+// It uses the identity that pushes and merges, see ghclient.Campaign.
+func GitHubRepoInfo(ctx context.Context, org, repo string, repoLimiter *time.Ticker) (RepoInfo, error) {
+	client := ghclient.New(ctx, ghclient.Campaign)
+	<-repoLimiter.C
+	r, _, err := client.Repositories.Get(ctx, org, repo)
+	if err != nil {
+		return RepoInfo{}, err
+	}
+	info := RepoInfo{DefaultBranch: r.GetDefaultBranch()}
+	if r.Permissions == nil {
+		return info, nil
+	}
+	permissions := *r.Permissions
+	for _, level := range []string{"admin", "push", "pull"} {
+		if permissions[level] {
+			info.Permission = level
+			return info, nil
+		}
+	}
+	return info, nil
+}
+
+// GitlabDefaultBranch returns a project's current default branch
+func GitlabDefaultBranch(ctx context.Context, org, repo string, repoLimiter *time.Ticker) (string, error) {
+	client := gitlab.NewClient(nil, os.Getenv("GITLAB_API_TOKEN"))
+	if os.Getenv("GITLAB_URL") != "" {
+		client.SetBaseURL(os.Getenv("GITLAB_URL"))
+	}
+	<-repoLimiter.C
+	project, _, err := client.Projects.GetProject(fmt.Sprintf("%s/%s", org, repo), nil, gitlab.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	return project.DefaultBranch, nil
+}
+
+// DefaultBranch returns a repo's current default branch from the provider's API
+func DefaultBranch(ctx context.Context, provider, org, repo string, repoLimiter *time.Ticker) (string, error) {
+	switch provider {
+	case "github":
+		info, err := GitHubRepoInfo(ctx, org, repo, repoLimiter)
+		return info.DefaultBranch, err
+	case "gitlab":
+		return GitlabDefaultBranch(ctx, org, repo, repoLimiter)
+	}
+	return "", fmt.Errorf("provider must be github or gitlab")
+}
+
+// CanPush returns whether a permission level allows pushing branches
+func CanPush(permission string) bool {
+	return permission == "admin" || permission == "push"
+}
@@ -0,0 +1,40 @@
+package clone
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+)
+
+// IsShallow returns whether a cloned repo has truncated history, e.g. from cloning with Input.Depth
+func IsShallow(dir string) bool {
+	_, err := os.Stat(path.Join(dir, ".git", "shallow"))
+	return err == nil
+}
+
+// Unshallow fetches the full history of a shallow clone, with all branches and tags.
+// It does nothing if the repo already has its full history, so it's safe to retry.
+func Unshallow(ctx context.Context, dir string) error {
+	if !IsShallow(dir) {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "git", "fetch", "--unshallow", "--tags", "origin", "+refs/heads/*:refs/remotes/origin/*")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return Error{error: fmt.Errorf("failed to fetch full history"), Details: string(output)}
+	}
+	return nil
+}
+
+// historyErrorPattern matches git's errors about history a shallow clone may not have, e.g. an older commit
+// that `git log` or `git diff` refers to
+var historyErrorPattern = regexp.MustCompile(`(?i)shallow|unknown revision|bad revision|bad object|not a valid object name|no merge base`)
+
+// IsHistoryError returns whether an error, e.g. of a change command that ran git, may be from history that
+// a shallow clone doesn't have, so is worth retrying with the full history
+func IsHistoryError(err error) bool {
+	return err != nil && historyErrorPattern.MatchString(err.Error())
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/merge"
+	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/verbosity"
+	"github.com/spf13/cobra"
+)
+
+var abandonFlagRepos []string
+var abandonFlagYes bool
+var abandonFlagMessage string
+
+// abandonOutput is the outcome of abandoning a repo's PRs, saved in its state
+type abandonOutput struct {
+	Success bool
+	PRs     []merge.AbandonOutput
+}
+
+var abandonCmd = &cobra.Command{
+	Use:   "abandon",
+	Short: "Abandon closes the campaign's open PRs and deletes their branches",
+	Long: `Abandon closes the PRs opened by push and deletes their branches, e.g. when a campaign is called off.
+PRs that are already closed and branches that are already deleted are skipped, so it's safe to run again,
+and merged PRs are left alone. It lists the PRs it would close and asks for confirmation, unless --yes is set.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repos, err := whichRepos(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		repos, err = filterRepoNames(repos, abandonFlagRepos)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		targets := []initialize.Repo{}
+		prsOf := map[string][]int{}
+		for _, r := range repos {
+			var pushOutput push.Output
+			if loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil || len(pushedPRs(pushOutput)) == 0 {
+				continue
+			}
+			if r.Provider == "gitlab" {
+				log.Printf("WARNING: %s/%s - abandon isn't supported for Gitlab, skipping", r.Owner, r.Name)
+				continue
+			}
+			targets = append(targets, r)
+			prsOf[r.Name] = pushedPRs(pushOutput)
+		}
+		if len(targets) == 0 {
+			verbosity.Printf("no PRs to abandon")
+			return
+		}
+		fmt.Printf("PRs of %d repo(s) to close, deleting their branches:\n", len(targets))
+		for _, r := range targets {
+			prs := []string{}
+			for _, number := range prsOf[r.Name] {
+				prs = append(prs, fmt.Sprintf("#%d", number))
+			}
+			fmt.Printf("  %s/%s: %s\n", r.Owner, r.Name, strings.Join(prs, ", "))
+		}
+		if !abandonFlagYes && !confirm("abandon them?") {
+			log.Fatal("aborted, nothing was closed")
+		}
+
+		var mutex sync.Mutex
+		outcomes := map[string]string{}
+		err = parallelize(targets, func(r initialize.Repo, ctx context.Context) error {
+			output, err := abandonOneRepo(ctx, r)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				outcomes[r.Name] = "error: " + err.Error()
+				return fmt.Errorf("%s/%s - %s", r.Owner, r.Name, err.Error())
+			}
+			prs := []string{}
+			for _, pr := range output.PRs {
+				prs = append(prs, pr.String())
+			}
+			outcomes[r.Name] = strings.Join(prs, "; ")
+			return nil
+		})
+		sort.Sort(initialize.ByName(targets))
+		for _, r := range targets {
+			fmt.Printf("%s/%s - %s\n", r.Owner, r.Name, outcomes[r.Name])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// filterRepoNames narrows repos down to the named ones, see abandon --repos
+func filterRepoNames(repos []initialize.Repo, names []string) ([]initialize.Repo, error) {
+	if len(names) == 0 {
+		return repos, nil
+	}
+	byName := map[string]initialize.Repo{}
+	for _, r := range repos {
+		byName[r.Name] = r
+	}
+	filtered := []initialize.Repo{}
+	for _, name := range names {
+		r, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("%s not a targeted repo name", name)
+		}
+		filtered = append(filtered, r)
+	}
+	return filtered, nil
+}
+
+// pushedPRs are the numbers of the PRs push opened for a repo, including each PR of a split change
+func pushedPRs(pushOutput push.Output) []int {
+	if !pushOutput.Success || pushOutput.DirectCommit {
+		return nil
+	}
+	prs := []int{}
+	if pushOutput.PullRequestNumber != 0 {
+		prs = append(prs, pushOutput.PullRequestNumber)
+	}
+	for _, split := range pushOutput.SplitPRs {
+		if split.PullRequestNumber != 0 && split.PullRequestNumber != pushOutput.PullRequestNumber {
+			prs = append(prs, split.PullRequestNumber)
+		}
+	}
+	return prs
+}
+
+func abandonOneRepo(ctx context.Context, r initialize.Repo) (abandonOutput, error) {
+	var pushOutput push.Output
+	if err := loadJSON(outputPath(r.Name, "push"), &pushOutput); err != nil {
+		return abandonOutput{Success: false}, err
+	}
+	var planOutput plan.Output
+	if err := loadJSON(outputPath(r.Name, "plan"), &planOutput); err != nil {
+		return abandonOutput{Success: false}, err
+	}
+	runID := campaignRunID()
+	if planOutput.BranchName == "" && runID == "" {
+		return abandonOutput{Success: false}, fmt.Errorf("no branch name in the plan state")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath(r.Name, "abandon")), 0755); err != nil {
+		return abandonOutput{Success: false}, err
+	}
+
+	output := abandonOutput{}
+	for _, number := range pushedPRs(pushOutput) {
+		pr, err := merge.GitHubAbandon(ctx, r.Owner, r.Name, number, planOutput.BranchName, runID, abandonFlagMessage, repoLimiter)
+		if err != nil {
+			writeJSON(struct {
+				abandonOutput
+				Error string
+			}{output, err.Error()}, outputPath(r.Name, "abandon"))
+			return output, err
+		}
+		verbosity.Printf("%s/%s - %s", r.Owner, r.Name, pr.String())
+		output.PRs = append(output.PRs, pr)
+	}
+	output.Success = true
+	return output, writeJSON(output, outputPath(r.Name, "abandon"))
+}
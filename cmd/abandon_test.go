@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/push"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterRepoNames(t *testing.T) {
+	repos := []initialize.Repo{{Name: "microplane"}, {Name: "sphinx"}, {Name: "wag"}}
+
+	all, err := filterRepoNames(repos, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, repos, all)
+
+	some, err := filterRepoNames(repos, []string{"wag", "microplane"})
+	assert.NoError(t, err)
+	assert.Equal(t, []initialize.Repo{{Name: "wag"}, {Name: "microplane"}}, some)
+
+	_, err = filterRepoNames(repos, []string{"nope"})
+	assert.EqualError(t, err, "nope not a targeted repo name")
+}
+
+func TestPushedPRs(t *testing.T) {
+	assert.Equal(t, []int{12}, pushedPRs(push.Output{Success: true, PullRequestNumber: 12}))
+	assert.Equal(t, []int{12, 13}, pushedPRs(push.Output{Success: true, PullRequestNumber: 12, SplitPRs: []push.SplitPR{{PullRequestNumber: 12}, {PullRequestNumber: 13}}}))
+	assert.Empty(t, pushedPRs(push.Output{Success: false, PullRequestNumber: 12}))
+	assert.Empty(t, pushedPRs(push.Output{Success: true, DirectCommit: true}))
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/merge"
+	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/verbosity"
+	"github.com/spf13/cobra"
+)
+
+var approveFlagRequireBuildSuccess bool
+var approveFlagMaxDiffLines int
+var approveFlagMessage string
+var approveFlagYes bool
+var approveFlagApproverToken string
+
+var approveCmd = &cobra.Command{
+	Use:   "approve",
+	Short: "Approve submits an approving review on each pushed PR, as the approver",
+	Long: `Approve submits an approving review on each pushed PR, as the approver, for campaigns where a trusted
+person approves the automated changes. The approver's token is set with $GITHUB_APPROVER_TOKEN or --approver-token,
+and must be another user's than the one that opened the PRs, since Github doesn't allow approving your own PRs.
+
+Only the commit that microplane pushed is approved, so a PR that has been pushed to since is left alone.
+Use --require-build-success and --max-diff-lines to only approve PRs that meet those criteria.
+It lists how many PRs it will approve, and as whom, and asks for confirmation unless --yes is set.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repos, err := whichRepos(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		repos = withoutSkipped(repos)
+
+		pushed := []initialize.Repo{}
+		for _, r := range repos {
+			var pushOutput push.Output
+			if loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil || !pushOutput.Success || pushOutput.DirectCommit {
+				continue
+			}
+			if r.Provider != "github" {
+				log.Printf("WARNING: %s/%s - approving is only supported for github repos, skipping", r.Owner, r.Name)
+				continue
+			}
+			pushed = append(pushed, r)
+		}
+		if len(pushed) == 0 {
+			verbosity.Printf("no pushed PRs to approve")
+			return
+		}
+
+		ghclient.SetToken(ghclient.Approver, approveFlagApproverToken)
+		if ghclient.Token(ghclient.Approver) == "" {
+			log.Fatal("approve needs the approver's token, set GITHUB_APPROVER_TOKEN or --approver-token")
+		}
+		login, err := merge.GitHubLogin(context.Background(), ghclient.Approver, repoLimiter)
+		if err != nil {
+			log.Fatalf("error finding the approver: %s", err.Error())
+		}
+		if !approveFlagYes && !confirm(fmt.Sprintf("approve up to %d PR(s) as %s?", len(pushed), login)) {
+			return
+		}
+
+		criteria := merge.ApproveCriteria{
+			RequireBuildSuccess: approveFlagRequireBuildSuccess,
+			MaxDiffLines:        approveFlagMaxDiffLines,
+			Body:                approveFlagMessage,
+		}
+		var mu sync.Mutex
+		approved := 0
+		err = parallelize(pushed, func(r initialize.Repo, ctx context.Context) error {
+			ok, err := approveOneRepo(ctx, r, login, criteria)
+			if ok {
+				mu.Lock()
+				approved++
+				mu.Unlock()
+			}
+			return err
+		})
+		log.Printf("approved %d of %d PR(s) as %s", approved, len(pushed), login)
+		if err != nil {
+			endRun(err)
+			log.Fatal(err)
+		}
+	},
+}
+
+// approveOneRepo approves a repo's PR, logging the outcome. A PR that doesn't meet the criteria isn't an error.
+func approveOneRepo(ctx context.Context, r initialize.Repo, login string, criteria merge.ApproveCriteria) (bool, error) {
+	var pushOutput push.Output
+	if err := loadJSON(outputPath(r.Name, "push"), &pushOutput); err != nil {
+		return false, err
+	}
+	input, err := mergeInput(r, pushOutput)
+	if err != nil {
+		return false, err
+	}
+	input.ExpectedHeadSHA = pushOutput.CommitSHA
+
+	approved, err := merge.GitHubApprove(ctx, input, criteria, login, repoLimiter)
+	if err != nil {
+		log.Printf("%s/%s - not approved: %s", r.Owner, r.Name, err.Error())
+		return false, nil
+	}
+	if !approved {
+		verbosity.Printf("%s/%s - already approved by %s", r.Owner, r.Name, login)
+		return false, nil
+	}
+	log.Printf("%s/%s - approved %s as %s", r.Owner, r.Name, pushOutput.PullRequestURL, login)
+	return true, nil
+}
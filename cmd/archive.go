@@ -0,0 +1,308 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/verbosity"
+	"github.com/spf13/cobra"
+)
+
+var archiveFlagIncludeWorkingTrees bool
+
+// archiveManifestName is the file within an archive that describes it
+const archiveManifestName = "archive.json"
+
+// archiveManifest records where an archive's state came from, so that absolute paths can be rewritten on restore
+type archiveManifest struct {
+	StateDir  string
+	Version   string
+	CreatedAt time.Time
+}
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive [file]",
+	Short: "Archive bundles a workflow's state into a tarball, e.g. to hand off a campaign",
+	Long: `Archive bundles a workflow's state into a tarball, e.g. to hand off a campaign or attach it to a ticket.
+It includes the log of each run, see mp.log in the workspace. The cloned and planned working trees
+are excluded, unless --include-working-trees is set.
+Use 'mp restore' to unpack the archive into a new workspace.`,
+	Args: cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file := "mp-archive.tar.gz"
+		if len(args) == 1 {
+			file = args[0]
+		}
+
+		var initOutput initialize.Output
+		if err := loadJSON(outputPath("", "init"), &initOutput); err != nil {
+			log.Fatalf("must run init first: %s", err.Error())
+		}
+
+		if err := writeArchive(file, initOutput.Repos); err != nil {
+			log.Fatal(err)
+		}
+		verbosity.Printf("archived %d repos to %s", len(initOutput.Repos), file)
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [file]",
+	Short: "Restore unpacks an archived workflow into the current workspace",
+	Long: `Restore unpacks an archived workflow into the current workspace, which must not already contain a workflow.
+Paths in the state are rewritten to point at the new workspace. Working trees aren't archived by default,
+so re-run clone and plan before pushing.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := os.Stat(outputPath("", "init")); err == nil {
+			log.Fatalf("a workflow already exists in %s, restore into an empty workspace", stateDir())
+		}
+
+		manifest, err := restoreArchive(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if manifest.Version != cliVersion {
+			log.Printf("WARNING: archive was created with microplane version %s, this is version %s", manifest.Version, cliVersion)
+		}
+		verbosity.Printf("restored workflow from %s, archived %s", args[0], manifest.CreatedAt.Format(time.RFC3339))
+	},
+}
+
+// stateDir is the absolute path of the directory holding init.json and each repo's state
+func stateDir() string {
+	dir, err := filepath.Abs(filepath.Dir(outputPath("", "init")))
+	if err != nil {
+		log.Fatalf("error finding state dir: %s", err.Error())
+	}
+	return dir
+}
+
+// isWorkingTree returns whether a path, relative to the state dir, is a cloned or planned working tree
+func isWorkingTree(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	return len(parts) >= 3 &&
+		((parts[1] == "clone" && parts[2] == "cloned") || (parts[1] == "plan" && parts[2] == "planned"))
+}
+
+func writeArchive(file string, repos []initialize.Repo) error {
+	root := stateDir()
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(archiveManifest{StateDir: root, Version: cliVersion, CreatedAt: time.Now().UTC()}, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: archiveManifestName, Mode: 0644, Size: int64(len(manifest)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+
+	paths := []string{outputPath("", "init"), overridesPath(), runLogPath()}
+	for _, r := range repos {
+		paths = append(paths, filepath.Join(root, r.Name))
+	}
+	if archiveFlagIncludeWorkingTrees {
+		// working trees laid out with --clone-layout are outside each repo's state
+		paths = append(paths, filepath.Join(root, "cloned"), filepath.Join(root, "planned"))
+	}
+	for _, p := range paths {
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			continue
+		}
+		err := filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			if !archiveFlagIncludeWorkingTrees && isWorkingTree(rel) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			return addToArchive(tw, path, rel, info)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addToArchive(tw *tar.Writer, path, rel string, info os.FileInfo) error {
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(rel)
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func restoreArchive(file string) (archiveManifest, error) {
+	var manifest archiveManifest
+	root := stateDir()
+	f, err := os.Open(file)
+	if err != nil {
+		return manifest, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return manifest, err
+	}
+	tr := tar.NewReader(gz)
+
+	stateFiles := []string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return manifest, err
+		}
+		if header.Name == archiveManifestName {
+			b, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return manifest, err
+			}
+			if err := json.Unmarshal(b, &manifest); err != nil {
+				return manifest, fmt.Errorf("invalid %s: %s", archiveManifestName, err.Error())
+			}
+			continue
+		}
+
+		target, err := restoreTarget(root, header.Name)
+		if err != nil {
+			return manifest, err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(header.Mode)); err != nil {
+				return manifest, err
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(header.Linkname) || !withinDir(root, filepath.Join(filepath.Dir(target), header.Linkname)) {
+				return manifest, fmt.Errorf("invalid symlink in archive: %s -> %s", header.Name, header.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return manifest, err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return manifest, err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return manifest, err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+			if err != nil {
+				return manifest, err
+			}
+			_, err = io.Copy(out, tr)
+			out.Close()
+			if err != nil {
+				return manifest, err
+			}
+			if strings.HasSuffix(target, ".json") && !isWorkingTree(header.Name) {
+				stateFiles = append(stateFiles, target)
+			}
+		}
+	}
+	if manifest.StateDir == "" {
+		return manifest, fmt.Errorf("%s is not a microplane archive, it has no %s", file, archiveManifestName)
+	}
+
+	// State files contain absolute paths, e.g. to the cloned repo, which must point to the new workspace
+	if manifest.StateDir != root {
+		for _, p := range stateFiles {
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				return manifest, err
+			}
+			b = bytes.Replace(b, []byte(manifest.StateDir+"/"), []byte(root+"/"), -1)
+			if err := ioutil.WriteFile(p, b, 0644); err != nil {
+				return manifest, err
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// restoreTarget resolves where an archive entry is restored to. It must be within root, and mustn't be written
+// through a symlink, e.g. one restored from the archive itself, so that a malicious archive can't write elsewhere.
+func restoreTarget(root, name string) (string, error) {
+	target := filepath.Join(root, filepath.FromSlash(name))
+	if !withinDir(root, target) || target == root {
+		return "", fmt.Errorf("invalid path in archive: %s", name)
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return "", err
+	}
+	p := root
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		p = filepath.Join(p, part)
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("invalid path in archive: %s is through a symlink", name)
+		}
+	}
+	return target, nil
+}
+
+// withinDir returns whether a cleaned path is dir or inside it
+func withinDir(dir, p string) bool {
+	p = filepath.Clean(p)
+	return p == dir || strings.HasPrefix(p, dir+string(os.PathSeparator))
+}
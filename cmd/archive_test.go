@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-archive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(d string) { workDir = d }(workDir)
+
+	workDir = filepath.Join(dir, "from")
+	repos := []initialize.Repo{{Owner: "Clever", Name: "microplane"}}
+	assert.NoError(t, os.MkdirAll(filepath.Join(workDir, "microplane", "plan", "planned"), 0755))
+	assert.NoError(t, writeJSON(initialize.Output{Repos: repos}, outputPath("", "init")))
+	planState := `{"PlanDir": "` + filepath.Join(workDir, "microplane", "plan", "planned") + `"}`
+	assert.NoError(t, ioutil.WriteFile(outputPath("microplane", "plan"), []byte(planState), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workDir, "microplane", "plan", "planned", "main.go"), []byte("package main\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(runLogPath(), []byte("--- mp plan\n"), 0644))
+	archive := filepath.Join(dir, "mp-archive.tar.gz")
+	assert.NoError(t, writeArchive(archive, repos))
+
+	workDir = filepath.Join(dir, "to")
+	assert.NoError(t, os.MkdirAll(workDir, 0755))
+	_, err = restoreArchive(archive)
+	assert.NoError(t, err)
+	b, err := ioutil.ReadFile(outputPath("microplane", "plan"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"PlanDir": "`+filepath.Join(workDir, "microplane", "plan", "planned")+`"}`, string(b))
+	b, err = ioutil.ReadFile(runLogPath())
+	assert.NoError(t, err)
+	assert.Equal(t, "--- mp plan\n", string(b))
+	// working trees aren't archived by default
+	_, err = os.Stat(filepath.Join(workDir, "microplane", "plan", "planned"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRestoreMaliciousArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-archive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(d string) { workDir = d }(workDir)
+	workDir = filepath.Join(dir, "workspace")
+	outside := filepath.Join(dir, "outside")
+	assert.NoError(t, os.MkdirAll(outside, 0755))
+
+	for name, entries := range map[string][]tar.Header{
+		"path escape":               {{Name: "../outside/pwned", Typeflag: tar.TypeReg}},
+		"absolute symlink":          {{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: outside}},
+		"escaping symlink":          {{Name: "repo/evil", Typeflag: tar.TypeSymlink, Linkname: "../../outside"}},
+		"write through symlink":     {{Name: "inside", Typeflag: tar.TypeDir, Mode: 0755}, {Name: "link", Typeflag: tar.TypeSymlink, Linkname: "inside"}, {Name: "link/pwned", Typeflag: tar.TypeReg}},
+		"overwrite through symlink": {{Name: "state.json", Typeflag: tar.TypeReg}, {Name: "link.json", Typeflag: tar.TypeSymlink, Linkname: "state.json"}, {Name: "link.json", Typeflag: tar.TypeReg}},
+	} {
+		assert.NoError(t, os.RemoveAll(workDir))
+		assert.NoError(t, os.MkdirAll(workDir, 0755))
+		archive := filepath.Join(dir, "malicious.tar.gz")
+		f, err := os.Create(archive)
+		assert.NoError(t, err)
+		gz := gzip.NewWriter(f)
+		tw := tar.NewWriter(gz)
+		for _, header := range entries {
+			header := header
+			if header.Typeflag == tar.TypeReg {
+				header.Mode, header.Size = 0644, 5
+			}
+			assert.NoError(t, tw.WriteHeader(&header))
+			if header.Typeflag == tar.TypeReg {
+				_, err = tw.Write([]byte("pwned"))
+				assert.NoError(t, err)
+			}
+		}
+		assert.NoError(t, tw.Close())
+		assert.NoError(t, gz.Close())
+		assert.NoError(t, f.Close())
+
+		_, err = restoreArchive(archive)
+		if assert.Error(t, err, name) {
+			assert.True(t, strings.HasPrefix(err.Error(), "invalid "), name)
+		}
+		files, err := ioutil.ReadDir(outside)
+		assert.NoError(t, err)
+		assert.Empty(t, files, name)
+	}
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/push"
+)
+
+// diffLimit is a size of change, e.g. the most a merge run may change across all repos, see --max-total-diff
+type diffLimit struct {
+	max   int
+	files bool
+}
+
+// parseDiffLimit parses the value of a flag like --max-total-diff, e.g. "5000" or "5000 lines" for changed lines,
+// or "200 files"
+func parseDiffLimit(flag, s string) (diffLimit, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return diffLimit{}, fmt.Errorf("invalid %s %q, e.g. '5000 lines' or '200 files'", flag, s)
+	}
+	max, err := strconv.Atoi(fields[0])
+	if err != nil || max < 0 {
+		return diffLimit{}, fmt.Errorf("invalid %s %q, e.g. '5000 lines' or '200 files'", flag, s)
+	}
+	limit := diffLimit{max: max}
+	if len(fields) == 2 {
+		switch fields[1] {
+		case "line", "lines":
+		case "file", "files":
+			limit.files = true
+		default:
+			return diffLimit{}, fmt.Errorf("invalid %s %q, the unit must be lines or files", flag, s)
+		}
+	}
+	return limit, nil
+}
+
+// size returns how big a diff is in the limit's unit
+func (l diffLimit) size(stat plan.DiffStat) int {
+	if l.files {
+		return stat.FilesChanged
+	}
+	return stat.Insertions + stat.Deletions
+}
+
+func (l diffLimit) String() string {
+	if l.files {
+		return fmt.Sprintf("%d files", l.max)
+	}
+	return fmt.Sprintf("%d lines", l.max)
+}
+
+// pendingDiffStats returns the diff stat recorded at plan time of each repo with a PR yet to be merged
+func pendingDiffStats(repos []initialize.Repo) map[string]plan.DiffStat {
+	stats := map[string]plan.DiffStat{}
+	for _, r := range repos {
+		var pushOutput push.Output
+		var planOutput plan.Output
+		if isMerged(r) || loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil || !pushOutput.Success || pushOutput.DirectCommit ||
+			loadJSON(outputPath(r.Name, "plan"), &planOutput) != nil {
+			continue
+		}
+		stats[r.Name] = planOutput.DiffStat
+	}
+	return stats
+}
+
+// totalDiffError returns an error if the repos' diffs add up to more than the limit, listing the biggest
+func totalDiffError(stats map[string]plan.DiffStat, limit diffLimit) error {
+	total := 0
+	names := []string{}
+	for name, stat := range stats {
+		total += limit.size(stat)
+		names = append(names, name)
+	}
+	if total <= limit.max {
+		return nil
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if a, b := limit.size(stats[names[i]]), limit.size(stats[names[j]]); a != b {
+			return a > b
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > 5 {
+		names = names[:5]
+	}
+	biggest := []string{}
+	for _, name := range names {
+		biggest = append(biggest, fmt.Sprintf("%s (%d)", name, limit.size(stats[name])))
+	}
+	unit := "lines"
+	if limit.files {
+		unit = "files"
+	}
+	return fmt.Errorf("the %d repo(s) to merge change %d %s in total, more than --max-total-diff %s. The biggest are %s",
+		len(stats), total, unit, limit, strings.Join(biggest, ", "))
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDiffLimit(t *testing.T) {
+	for s, expected := range map[string]diffLimit{
+		"5000":       {max: 5000},
+		"5000 lines": {max: 5000},
+		"200 files":  {max: 200, files: true},
+	} {
+		limit, err := parseDiffLimit("--max-total-diff", s)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, limit)
+	}
+	for _, s := range []string{"", "lots", "-1", "200 commits", "1 2 3"} {
+		_, err := parseDiffLimit("--max-total-diff", s)
+		assert.Error(t, err)
+	}
+}
+
+func TestTotalDiffError(t *testing.T) {
+	stats := map[string]plan.DiffStat{
+		"a": {FilesChanged: 1, Insertions: 10, Deletions: 5},
+		"b": {FilesChanged: 3, Insertions: 100},
+		"c": {FilesChanged: 2, Insertions: 1, Deletions: 1},
+	}
+	assert.NoError(t, totalDiffError(stats, diffLimit{max: 117}))
+	assert.EqualError(t, totalDiffError(stats, diffLimit{max: 100}),
+		"the 3 repo(s) to merge change 117 lines in total, more than --max-total-diff 100 lines. The biggest are b (100), a (15), c (2)")
+	assert.EqualError(t, totalDiffError(stats, diffLimit{max: 5, files: true}),
+		"the 3 repo(s) to merge change 6 files in total, more than --max-total-diff 5 files. The biggest are b (3), c (2), a (1)")
+}
+
+func TestSmallChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-small")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(d string) { workDir = d }(workDir)
+	workDir = dir
+
+	for name, stat := range map[string]plan.DiffStat{
+		"small": {FilesChanged: 1, Insertions: 3, Deletions: 2},
+		"big":   {FilesChanged: 2, Insertions: 30},
+	} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(outputPath(name, "plan")), 0755))
+		assert.NoError(t, writeJSON(plan.Output{Success: true, DiffStat: stat}, outputPath(name, "plan")))
+	}
+
+	lines := diffLimit{max: 5}
+	assert.True(t, smallChange(initialize.Repo{Name: "small"}, lines))
+	assert.False(t, smallChange(initialize.Repo{Name: "big"}, lines))
+	assert.False(t, smallChange(initialize.Repo{Name: "unplanned"}, lines))
+	assert.False(t, smallChange(initialize.Repo{Name: "big"}, diffLimit{max: 1, files: true}))
+}
@@ -2,15 +2,23 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/Clever/microplane/clone"
 	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/verbosity"
 	"github.com/spf13/cobra"
 )
 
+var cloneFlagRef string
+var cloneFlagMirrorRemote string
+var cloneFlagDepth int
+var cloneFlagLayout string
+
 var cloneCmd = &cobra.Command{
 	Use:   "clone",
 	Short: "Clone all repos targeted by init",
@@ -20,16 +28,23 @@ var cloneCmd = &cobra.Command{
 		if err != nil {
 			log.Fatal(err)
 		}
+		repos = withoutSkipped(repos)
+		for _, r := range repos {
+			if _, err := layoutPath(cloneFlagLayout, r); err != nil {
+				log.Fatal(err)
+			}
+		}
 
-		err = parallelize(repos, cloneOneRepo)
+		err = parallelize(repos, trackProgress("clone", cloneOneRepo))
 		if err != nil {
-			log.Fatal(err)
+			endRun(err)
+			log.Fatal(batchError("clone", err))
 		}
 	},
 }
 
 func cloneOneRepo(r initialize.Repo, ctx context.Context) error {
-	log.Printf("cloning: %s/%s", r.Owner, r.Name)
+	verbosity.Printf("cloning: %s/%s", r.Owner, r.Name)
 
 	// Prepare workdir for current step's output
 	cloneOutputPath := outputPath(r.Name, "clone")
@@ -38,12 +53,58 @@ func cloneOneRepo(r initialize.Repo, ctx context.Context) error {
 		return err
 	}
 
+	// Check we'll be able to push, before doing any work on the repo
+	var info clone.RepoInfo
+	if r.Provider == "github" {
+		var err error
+		info, err = clone.GitHubRepoInfo(ctx, r.Owner, r.Name, repoLimiter)
+		if err != nil {
+			return fmt.Errorf("%s/%s - error checking permissions: %s", r.Owner, r.Name, err.Error())
+		}
+		if !clone.CanPush(info.Permission) {
+			err := fmt.Errorf("no push access (permission: %s). Drop the repo from the campaign, or fork it", info.Permission)
+			o := struct {
+				clone.Output
+				Error string
+			}{clone.Output{Success: false, Permission: info.Permission}, err.Error()}
+			writeJSON(o, cloneOutputPath)
+			return fmt.Errorf("%s/%s - %s", r.Owner, r.Name, err.Error())
+		}
+	}
+
+	// Record the default branch, which varies across a fleet, so that the PR is opened against it
+	if r.Provider == "gitlab" {
+		defaultBranch, err := clone.GitlabDefaultBranch(ctx, r.Owner, r.Name, repoLimiter)
+		if err != nil {
+			log.Printf("WARNING: %s/%s - error finding the default branch: %s", r.Owner, r.Name, err.Error())
+		}
+		info.DefaultBranch = defaultBranch
+	}
+
+	// Base the change off the overridden base branch, if any
+	ref := cloneFlagRef
+	if o := overrideFor(r); o.BaseBranch != "" {
+		ref = o.BaseBranch
+	}
+
+	dir, err := layoutDir(cloneFlagLayout, r, "cloned")
+	if err != nil {
+		return err
+	}
+
 	// Execute
 	input := clone.Input{
-		WorkDir: cloneWorkDir,
-		GitURL:  r.CloneURL,
+		WorkDir:   cloneWorkDir,
+		GitURL:    r.CloneURL,
+		Ref:       ref,
+		MirrorURL: mirrorURL(r),
+		Depth:     cloneFlagDepth,
+		Dir:       dir,
 	}
 	output, err := clone.Clone(ctx, input)
+	output.Layout = cloneFlagLayout
+	output.Permission = info.Permission
+	output.DefaultBranch = info.DefaultBranch
 	if err != nil {
 		o := struct {
 			clone.Output
@@ -52,6 +113,14 @@ func cloneOneRepo(r initialize.Repo, ctx context.Context) error {
 		writeJSON(o, cloneOutputPath)
 		return err
 	}
+	if output.Deepened {
+		verbosity.Printf("%s/%s - fetched full history to check out %s", r.Owner, r.Name, ref)
+	}
 	writeJSON(output, cloneOutputPath)
 	return nil
 }
+
+// mirrorURL renders --mirror-remote for a repo, replacing {org} and {repo}
+func mirrorURL(r initialize.Repo) string {
+	return strings.NewReplacer("{org}", r.Owner, "{repo}", r.Name).Replace(cloneFlagMirrorRemote)
+}
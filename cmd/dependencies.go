@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/push"
+)
+
+// dependencyLayers splits repos into layers to merge in order, from `mp init --dependencies`.
+// Each repo comes after the repos it depends on, and repos within a layer can be merged in parallel.
+func dependencyLayers(repos []initialize.Repo) [][]initialize.Repo {
+	remaining := map[string]initialize.Repo{}
+	for _, r := range repos {
+		remaining[r.Name] = r
+	}
+	layers := [][]initialize.Repo{}
+	for len(remaining) > 0 {
+		layer := []initialize.Repo{}
+		for _, r := range repos {
+			if _, ok := remaining[r.Name]; !ok {
+				continue
+			}
+			ready := true
+			for _, dep := range r.DependsOn {
+				if _, waiting := remaining[dep]; waiting {
+					ready = false
+				}
+			}
+			if ready {
+				layer = append(layer, r)
+			}
+		}
+		if len(layer) == 0 {
+			// a cycle, which init should have broken. Merge the rest together rather than never.
+			for _, r := range repos {
+				if _, ok := remaining[r.Name]; ok {
+					layer = append(layer, r)
+				}
+			}
+		}
+		for _, r := range layer {
+			delete(remaining, r.Name)
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+// unmergedDependency returns a repo that r depends on whose PR hasn't merged yet, or "" if there isn't one.
+// Dependencies that weren't pushed, e.g. because they didn't need the change, don't hold r up.
+func unmergedDependency(r initialize.Repo) string {
+	for _, dep := range r.DependsOn {
+		var pushOutput push.Output
+		if loadJSON(outputPath(dep, "push"), &pushOutput) == nil && pushOutput.Success && !isMerged(initialize.Repo{Name: dep}) {
+			return dep
+		}
+	}
+	return ""
+}
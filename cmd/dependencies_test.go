@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDependencyLayers(t *testing.T) {
+	names := func(layers [][]initialize.Repo) [][]string {
+		out := [][]string{}
+		for _, layer := range layers {
+			l := []string{}
+			for _, r := range layer {
+				l = append(l, r.Name)
+			}
+			out = append(out, l)
+		}
+		return out
+	}
+
+	repos := []initialize.Repo{
+		{Name: "app", DependsOn: []string{"components", "kayvee-go"}},
+		{Name: "components", DependsOn: []string{"kayvee-go"}},
+		{Name: "kayvee-go"},
+		{Name: "wag", DependsOn: []string{"not-targeted"}},
+	}
+	assert.Equal(t, [][]string{{"kayvee-go", "wag"}, {"components"}, {"app"}}, names(dependencyLayers(repos)))
+
+	cycle := []initialize.Repo{{Name: "a", DependsOn: []string{"b"}}, {Name: "b", DependsOn: []string{"a"}}, {Name: "c"}}
+	assert.Equal(t, [][]string{{"c"}, {"a", "b"}}, names(dependencyLayers(cycle)))
+}
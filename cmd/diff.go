@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/push"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var diffFlagStat bool
+var diffFlagColor bool
+var diffFlagPR bool
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [org/repo]",
+	Short: "Show the planned change for a single repo",
+	Long: `Show the planned change for a single repo.
+
+By default, the diff of the planned commit is shown. This works as soon as the repo has been planned.
+After pushing, use --pr to instead show the diff of the open pull request.`,
+	Example: `mp diff clever/app-service
+mp diff app-service --stat
+mp diff app-service --pr`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		r, err := findRepo(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var diff string
+		if diffFlagPR {
+			if r.Provider != "github" {
+				log.Fatalf("--pr is only supported for github repos")
+			}
+			var pushOutput push.Output
+			if loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil || !pushOutput.Success {
+				log.Fatalf("%s/%s - must successfully push first", r.Owner, r.Name)
+			}
+			diff, err = push.GithubPRDiff(context.Background(), r.Owner, r.Name, pushOutput.PullRequestNumber, repoLimiter)
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			var planOutput plan.Output
+			if loadJSON(outputPath(r.Name, "plan"), &planOutput) != nil || !planOutput.Success {
+				log.Fatalf("%s/%s - must successfully plan first", r.Owner, r.Name)
+			}
+			// Let git format the diff of the planned checkout, so that --stat and --color match git's behavior
+			gitArgs := []string{"diff", "HEAD^", "HEAD"}
+			if diffFlagStat {
+				gitArgs = append(gitArgs, "--stat")
+			}
+			if diffFlagColor {
+				gitArgs = append(gitArgs, "--color=always")
+			}
+			gitDiff := exec.Command("git", gitArgs...)
+			gitDiff.Dir = planOutput.PlanDir
+			gitDiff.Stdout = os.Stdout
+			gitDiff.Stderr = os.Stderr
+			if err := gitDiff.Run(); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		if diffFlagStat {
+			fmt.Println(plan.ParseDiffStat(diff))
+			return
+		}
+		if diffFlagColor {
+			diff = colorizeDiff(diff)
+		}
+		fmt.Print(diff)
+	},
+}
+
+// colorizeDiff colors added and removed lines, similar to `git diff --color`
+func colorizeDiff(diff string) string {
+	lines := strings.Split(diff, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "diff --git "):
+			lines[i] = color.New(color.Bold).Sprint(line)
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = color.CyanString(line)
+		case strings.HasPrefix(line, "+"):
+			lines[i] = color.GreenString(line)
+		case strings.HasPrefix(line, "-"):
+			lines[i] = color.RedString(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
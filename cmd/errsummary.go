@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Clever/microplane/initialize"
+)
+
+// runFailures are the errors of the repos that failed in this run, see trackProgress
+var runFailures = &failures{byRepo: map[string]string{}}
+
+type failures struct {
+	sync.Mutex
+	byRepo map[string]string
+}
+
+func (f *failures) record(r initialize.Repo, err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.byRepo[fmt.Sprintf("%s/%s", r.Owner, r.Name)] = err.Error()
+}
+
+// errorGroup is an error that several repos failed with, e.g. an expired token
+type errorGroup struct {
+	Error string
+	Repos []string
+}
+
+var shaPattern = regexp.MustCompile(`\b[0-9a-f]{7,40}\b`)
+
+// similarError reduces a repo's error to what it has in common with other repos' errors: its first line,
+// without the repo's org/name or any commit SHAs
+func similarError(repo, msg string) string {
+	if i := strings.Index(msg, "\n"); i >= 0 {
+		msg = msg[:i]
+	}
+	msg = strings.Replace(msg, repo, "{repo}", -1)
+	msg = shaPattern.ReplaceAllString(msg, "{sha}")
+	for _, prefix := range []string{"{repo} - ", "{repo} error: ", "{repo}: "} {
+		msg = strings.TrimPrefix(msg, prefix)
+	}
+	return strings.TrimSpace(msg)
+}
+
+// groupFailures groups repos that failed with similar errors, most common first. Errors only one repo
+// failed with are returned separately, by repo.
+func groupFailures(byRepo map[string]string) (groups []errorGroup, oneOffs map[string]string) {
+	repos := map[string][]string{}
+	for repo, msg := range byRepo {
+		key := similarError(repo, msg)
+		repos[key] = append(repos[key], repo)
+	}
+	oneOffs = map[string]string{}
+	for key, rs := range repos {
+		if len(rs) == 1 {
+			oneOffs[rs[0]] = byRepo[rs[0]]
+			continue
+		}
+		sort.Strings(rs)
+		groups = append(groups, errorGroup{Error: key, Repos: rs})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].Repos) != len(groups[j].Repos) {
+			return len(groups[i].Repos) > len(groups[j].Repos)
+		}
+		return groups[i].Error < groups[j].Error
+	})
+	return groups, oneOffs
+}
+
+// printFailures logs the run's failures, grouping repos that failed with similar errors so that a systemic
+// problem doesn't bury the one-off failures. It returns the number of repos that failed.
+func printFailures() int {
+	runFailures.Lock()
+	defer runFailures.Unlock()
+	groups, oneOffs := groupFailures(runFailures.byRepo)
+	for _, g := range groups {
+		repos := []string{}
+		for _, repo := range g.Repos {
+			repos = append(repos, withAttempts(repo))
+		}
+		log.Printf("%s × %d repos: %s", g.Error, len(g.Repos), strings.Join(repos, ", "))
+	}
+	if len(oneOffs) > 0 {
+		if len(groups) > 0 {
+			log.Printf("other failures:")
+		}
+		repos := []string{}
+		for repo := range oneOffs {
+			repos = append(repos, repo)
+		}
+		sort.Strings(repos)
+		for _, repo := range repos {
+			log.Printf("%s: %s", withAttempts(repo), oneOffs[repo])
+		}
+	}
+	return len(runFailures.byRepo)
+}
+
+// withAttempts adds how many times a repo was attempted, if it was retried, e.g. "Clever/microplane (3 attempts)"
+func withAttempts(repo string) string {
+	if n := runAttempts.of(repo); n > 1 {
+		return fmt.Sprintf("%s (%d attempts)", repo, n)
+	}
+	return repo
+}
+
+// batchError is the error a step exits with after a run where repos failed, having printed them with printFailures
+func batchError(step string, err error) error {
+	if n := printFailures(); n > 0 {
+		return fmt.Errorf("%s failed for %d repo(s)", step, n)
+	}
+	return err
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupFailures(t *testing.T) {
+	groups, oneOffs := groupFailures(map[string]string{
+		"Clever/a":     "Clever/a - error checking permissions: 403 Resource protected by organization SAML enforcement",
+		"Clever/b":     "Clever/b - error checking permissions: 403 Resource protected by organization SAML enforcement",
+		"Clever/c":     "Clever/c - error checking permissions: 403 Resource protected by organization SAML enforcement",
+		"Clever/d":     "head branch changed since push: expected 1a2b3c4d, found 5e6f7a8b",
+		"Clever/e":     "head branch changed since push: expected 9a8b7c6d, found 0f1e2d3c",
+		"Clever/wag":   "PR is not mergeable",
+		"Other/sphinx": "Other/sphinx error: exit status 1\ngo: cannot find main module",
+	})
+	assert.Equal(t, []errorGroup{
+		{Error: "error checking permissions: 403 Resource protected by organization SAML enforcement", Repos: []string{"Clever/a", "Clever/b", "Clever/c"}},
+		{Error: "head branch changed since push: expected {sha}, found {sha}", Repos: []string{"Clever/d", "Clever/e"}},
+	}, groups)
+	assert.Equal(t, map[string]string{
+		"Clever/wag":   "PR is not mergeable",
+		"Other/sphinx": "Other/sphinx error: exit status 1\ngo: cannot find main module",
+	}, oneOffs)
+}
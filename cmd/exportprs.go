@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/push"
+	"github.com/spf13/cobra"
+)
+
+var exportPRsFlagFormat string
+
+var exportPRsCmd = &cobra.Command{
+	Use:   "export-prs",
+	Short: "Export lists the PRs opened by push, e.g. for a dashboard, spreadsheet or review-request bot",
+	Args:  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		if exportPRsFlagFormat != "text" && exportPRsFlagFormat != "csv" && exportPRsFlagFormat != "json" {
+			log.Fatalf("unsupported --format %s, must be one of: text, csv, json", exportPRsFlagFormat)
+		}
+
+		repos, err := whichRepos(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := writeExportedPRs(os.Stdout, exportPRsFlagFormat, openedPRs(repos)); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// exportedPR is a PR opened by push
+type exportedPR struct {
+	Org    string `json:"org"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+}
+
+// openedPRs are the PRs recorded in each repo's push state, including each PR of a split change
+func openedPRs(repos []initialize.Repo) []exportedPR {
+	prs := []exportedPR{}
+	for _, r := range repos {
+		var pushOutput push.Output
+		if loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil || !pushOutput.Success {
+			continue
+		}
+		if pushOutput.PullRequestURL != "" {
+			prs = append(prs, exportedPR{Org: r.Owner, Repo: r.Name, Number: pushOutput.PullRequestNumber, URL: pushOutput.PullRequestURL})
+		}
+		for _, split := range pushOutput.SplitPRs {
+			if split.PullRequestURL != "" && split.PullRequestURL != pushOutput.PullRequestURL {
+				prs = append(prs, exportedPR{Org: r.Owner, Repo: r.Name, Number: split.PullRequestNumber, URL: split.PullRequestURL})
+			}
+		}
+	}
+	return prs
+}
+
+func writeExportedPRs(w io.Writer, format string, prs []exportedPR) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(prs)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"org", "repo", "number", "url"})
+		for _, pr := range prs {
+			cw.Write([]string{pr.Org, pr.Repo, strconv.Itoa(pr.Number), pr.URL})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		for _, pr := range prs {
+			if _, err := fmt.Fprintf(w, "%s/%s#%d\t%s\n", pr.Org, pr.Repo, pr.Number, pr.URL); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteExportedPRs(t *testing.T) {
+	prs := []exportedPR{
+		{Org: "Clever", Repo: "microplane", Number: 12, URL: "https://github.com/Clever/microplane/pull/12"},
+		{Org: "Clever", Repo: "sphinx", Number: 3, URL: "https://github.com/Clever/sphinx/pull/3"},
+	}
+
+	var text bytes.Buffer
+	assert.NoError(t, writeExportedPRs(&text, "text", prs))
+	assert.Equal(t, "Clever/microplane#12\thttps://github.com/Clever/microplane/pull/12\nClever/sphinx#3\thttps://github.com/Clever/sphinx/pull/3\n", text.String())
+
+	var csv bytes.Buffer
+	assert.NoError(t, writeExportedPRs(&csv, "csv", prs))
+	assert.Equal(t, "org,repo,number,url\nClever,microplane,12,https://github.com/Clever/microplane/pull/12\nClever,sphinx,3,https://github.com/Clever/sphinx/pull/3\n", csv.String())
+
+	var json bytes.Buffer
+	assert.NoError(t, writeExportedPRs(&json, "json", prs[:1]))
+	assert.Equal(t, "[\n  {\n    \"org\": \"Clever\",\n    \"repo\": \"microplane\",\n    \"number\": 12,\n    \"url\": \"https://github.com/Clever/microplane/pull/12\"\n  }\n]\n", json.String())
+}
@@ -5,11 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/verbosity"
 	"github.com/facebookgo/errgroup"
 	"github.com/spf13/cobra"
-	"golang.org/x/sync/semaphore"
 )
 
 func loadJSON(path string, obj interface{}) error {
@@ -25,30 +31,107 @@ func writeJSON(obj interface{}, path string) error {
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(path, b, 0644)
+	// Write to a temp file and rename it into place, so that an interrupted run
+	// never leaves behind a partially written state file. The temp file is unique,
+	// so concurrent writes to the same state file can't interleave.
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
 
+// defaultConcurrency is how many repos a step works on at once
+const defaultConcurrency = 10
+
 // parallelize take a list of repos and applies a function (clone, plan, ...) to them
 func parallelize(repos []initialize.Repo, f func(initialize.Repo, context.Context) error) error {
-	ctx := context.Background()
-	var eg errgroup.Group
-	parallelLimit := semaphore.NewWeighted(10)
+	return parallelizeN(repos, defaultConcurrency, f)
+}
+
+// parallelizeN is parallelize, working on up to n repos at once. A repo that fails with a transient error,
+// e.g. a rate limit or a 502, is requeued behind the other repos, so that they proceed while the condition
+// clears, and attempted again up to --retry-budget times.
+func parallelizeN(repos []initialize.Repo, n int, f func(initialize.Repo, context.Context) error) error {
+	if n < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got %d", n)
+	}
+	ctx := runCtx
+	type job struct {
+		repo    initialize.Repo
+		attempt int
+	}
+	// each repo is either queued, waiting to be requeued, or being worked on, so the queue never fills up
+	queue := make(chan job, len(repos))
 	for _, r := range repos {
+		queue <- job{repo: r, attempt: 1}
+	}
+	var eg errgroup.Group
+	var mutex sync.Mutex
+	retried := []string{}
+	var pending sync.WaitGroup
+	pending.Add(len(repos))
+	go func() {
+		pending.Wait()
+		close(queue)
+	}()
+
+	if n > len(repos) {
+		n = len(repos)
+	}
+	for i := 0; i < n; i++ {
 		eg.Add(1)
-		go func(repo initialize.Repo) {
-			parallelLimit.Acquire(ctx, 1)
-			defer parallelLimit.Release(1)
+		go func() {
 			defer eg.Done()
-
-			err := f(repo, ctx)
-			if err != nil {
-				eg.Error(err)
-				return
+			for j := range queue {
+				attemptCtx := context.WithValue(ctx, attemptKey{}, attempt{number: j.attempt, budget: retryBudgetFlag})
+				err := f(j.repo, attemptCtx)
+				if willRequeue(attemptCtx, err) {
+					wait := requeueWait(err, j.attempt)
+					verbosity.Printf("%s/%s - transient failure, will retry in %s after the other repos: %s", j.repo.Owner, j.repo.Name, wait, err.Error())
+					// the repo waits out of the queue, so that the workers carry on with the other repos meanwhile
+					go func(next job) {
+						select {
+						case <-ctx.Done():
+						case <-time.After(wait):
+						}
+						queue <- next
+					}(job{repo: j.repo, attempt: j.attempt + 1})
+					continue
+				}
+				if j.attempt > 1 {
+					runAttempts.record(j.repo, j.attempt)
+					mutex.Lock()
+					retried = append(retried, fmt.Sprintf("%s/%s (%d attempts)", j.repo.Owner, j.repo.Name, j.attempt))
+					mutex.Unlock()
+				}
+				if err != nil {
+					eg.Error(err)
+				}
+				pending.Done()
 			}
-		}(r)
+		}()
 	}
 
-	return eg.Wait()
+	err := eg.Wait()
+	if len(retried) > 0 {
+		sort.Strings(retried)
+		verbosity.Printf("retried %d repo(s) after transient failures: %s", len(retried), strings.Join(retried, ", "))
+	}
+	return err
 }
 
 // whichRepos determines which repos are relevant to the current command.
@@ -64,17 +147,101 @@ func whichRepos(cmd *cobra.Command) ([]initialize.Repo, error) {
 		return []initialize.Repo{}, err
 	}
 
-	// All repos
-	if singleRepo == "" {
-		return initOutput.Repos, nil
+	repos := initOutput.Repos
+	if singleRepo != "" {
+		repos = []initialize.Repo{}
+		for _, r := range initOutput.Repos {
+			if r.Name == singleRepo {
+				repos = append(repos, r)
+			}
+		}
+		if len(repos) == 0 {
+			// TODO: showing valid repo names would be helpful
+			return []initialize.Repo{}, fmt.Errorf("%s not a targeted repo name", singleRepo)
+		}
+	}
+
+	reposFrom, err := cmd.Flags().GetString("repos-from")
+	if err != nil {
+		return []initialize.Repo{}, err
+	}
+	if reposFrom == "" {
+		return repos, nil
+	}
+	step, outcome, err := parseReposFrom(reposFrom)
+	if err != nil {
+		return []initialize.Repo{}, err
+	}
+	selected := []initialize.Repo{}
+	for _, r := range repos {
+		if matchesOutcome(stepOutcome(r, step), outcome) {
+			selected = append(selected, r)
+		}
+	}
+	return selected, nil
+}
+
+// step outcomes, as recorded in each repo's state
+const (
+	outcomeSucceeded = "succeeded"
+	outcomeFailed    = "failed"
+	outcomePending   = "pending"
+	// outcomeIncomplete matches both failed and pending
+	outcomeIncomplete = "incomplete"
+)
+
+// parseReposFrom parses a --repos-from selector, e.g. "plan:failed"
+func parseReposFrom(s string) (step, outcome string, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid --repos-from %s, expected format '{step}:{outcome}'", s)
+	}
+	step, outcome = parts[0], parts[1]
+	switch step {
+	case "clone", "plan", "push", "merge":
+	default:
+		return "", "", fmt.Errorf("invalid --repos-from step %s, must be one of: clone, plan, push, merge", step)
+	}
+	switch outcome {
+	case outcomeSucceeded, outcomeFailed, outcomePending, outcomeIncomplete:
+	default:
+		return "", "", fmt.Errorf("invalid --repos-from outcome %s, must be one of: succeeded, failed, pending, incomplete", outcome)
+	}
+	return step, outcome, nil
+}
+
+// stepOutcome reads the outcome of the last run of a step for a repo
+func stepOutcome(r initialize.Repo, step string) string {
+	var output struct {
+		Success bool
+	}
+	if err := loadJSON(outputPath(r.Name, step), &output); err != nil {
+		return outcomePending
+	}
+	if output.Success {
+		return outcomeSucceeded
+	}
+	return outcomeFailed
+}
+
+func matchesOutcome(actual, selector string) bool {
+	if selector == outcomeIncomplete {
+		return actual == outcomeFailed || actual == outcomePending
+	}
+	return actual == selector
+}
+
+// findRepo looks up a targeted repo by either its name or "{org}/{repo}"
+func findRepo(name string) (initialize.Repo, error) {
+	var initOutput initialize.Output
+	if err := loadJSON(outputPath("", "init"), &initOutput); err != nil {
+		return initialize.Repo{}, err
 	}
 
-	// Single repo
 	for _, r := range initOutput.Repos {
-		if r.Name == singleRepo {
-			return []initialize.Repo{r}, nil
+		if r.Name == name || fmt.Sprintf("%s/%s", r.Owner, r.Name) == name {
+			return r, nil
 		}
 	}
-	// TODO: showing valid repo names would be helpful
-	return []initialize.Repo{}, fmt.Errorf("%s not a targeted repo name", singleRepo)
+	return initialize.Repo{}, fmt.Errorf("%s not a targeted repo name", name)
 }
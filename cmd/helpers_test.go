@@ -2,9 +2,11 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/Clever/microplane/initialize"
 	"github.com/stretchr/testify/assert"
@@ -41,3 +43,104 @@ func TestParallelize(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, len(repos), total)
 }
+
+func TestParseReposFrom(t *testing.T) {
+	step, outcome, err := parseReposFrom("plan:failed")
+	assert.NoError(t, err)
+	assert.Equal(t, "plan", step)
+	assert.Equal(t, "failed", outcome)
+
+	for _, invalid := range []string{"plan", "plan:failed:again", "deploy:failed", "merge:exploded"} {
+		_, _, err := parseReposFrom(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestMatchesOutcome(t *testing.T) {
+	assert.True(t, matchesOutcome(outcomeFailed, outcomeFailed))
+	assert.False(t, matchesOutcome(outcomeSucceeded, outcomeFailed))
+	assert.True(t, matchesOutcome(outcomeFailed, outcomeIncomplete))
+	assert.True(t, matchesOutcome(outcomePending, outcomeIncomplete))
+	assert.False(t, matchesOutcome(outcomeSucceeded, outcomeIncomplete))
+}
+
+func TestParallelizeRequeuesTransientFailures(t *testing.T) {
+	defer func(delay time.Duration, budget int) { requeueDelay, retryBudgetFlag = delay, budget }(requeueDelay, retryBudgetFlag)
+	requeueDelay, retryBudgetFlag = 0, 2
+
+	repos := []initialize.Repo{{Owner: "Clever", Name: "flaky"}, {Owner: "Clever", Name: "broken"}, {Owner: "Clever", Name: "down"}}
+	var mutex sync.Mutex
+	order := []string{}
+	err := parallelizeN(repos, 1, func(r initialize.Repo, ctx context.Context) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		order = append(order, r.Name)
+		switch {
+		case r.Name == "flaky" && len(order) == 1:
+			return errors.New("GET https://api.github.com/repos/Clever/flaky: 502 Bad Gateway []")
+		case r.Name == "broken":
+			return errors.New("plan failed: exit status 1")
+		case r.Name == "down":
+			return errors.New("API rate limit exceeded")
+		}
+		return nil
+	})
+	assert.Error(t, err)
+	// the flaky repo is retried after the others, the broken one isn't retried,
+	// and the one that's down is retried until the budget runs out
+	assert.Equal(t, []string{"flaky", "broken", "down"}, order[:3])
+	assert.ElementsMatch(t, []string{"flaky", "down", "down"}, order[3:])
+	assert.Equal(t, 2, runAttempts.of("Clever/flaky"))
+	assert.Equal(t, 1, runAttempts.of("Clever/broken"))
+	assert.Equal(t, 3, runAttempts.of("Clever/down"))
+}
+
+func TestParallelizeDoesntWaitOnRequeuedRepos(t *testing.T) {
+	defer func(delay time.Duration, budget int) { requeueDelay, retryBudgetFlag = delay, budget }(requeueDelay, retryBudgetFlag)
+	requeueDelay, retryBudgetFlag = 50*time.Millisecond, 1
+
+	repos := []initialize.Repo{{Owner: "Clever", Name: "flaky"}, {Owner: "Clever", Name: "microplane"}}
+	var mutex sync.Mutex
+	finished := map[string]time.Time{}
+	start := time.Now()
+	err := parallelizeN(repos, 1, func(r initialize.Repo, ctx context.Context) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if _, ok := finished[r.Name]; !ok && r.Name == "flaky" {
+			finished[r.Name] = time.Time{}
+			return errors.New("GET https://api.github.com/repos/Clever/flaky: 502 Bad Gateway []")
+		}
+		finished[r.Name] = time.Now()
+		return nil
+	})
+	assert.NoError(t, err)
+	// the only worker went on to the other repo while the flaky one waited to be retried
+	assert.True(t, finished["microplane"].Sub(start) < requeueDelay)
+	assert.True(t, finished["flaky"].Sub(start) >= requeueDelay)
+}
+
+func TestParallelizeConcurrency(t *testing.T) {
+	err := parallelizeN([]initialize.Repo{{Owner: "Clever", Name: "microplane"}}, 0, func(r initialize.Repo, ctx context.Context) error {
+		return nil
+	})
+	assert.Error(t, err)
+}
+
+func TestRequeueWait(t *testing.T) {
+	defer func(delay time.Duration) { requeueDelay = delay }(requeueDelay)
+	requeueDelay = 10 * time.Second
+
+	assert.Equal(t, 20*time.Second, requeueWait(errors.New("GET https://api.github.com/repos/Clever/flaky: 502 Bad Gateway []"), 2))
+	assert.Equal(t, 20*time.Second, requeueWait(errors.New("You have exceeded a secondary rate limit"), 2))
+	// a primary rate limit waits at least as long, until the quota resets if it's known
+	assert.True(t, requeueWait(errors.New("API rate limit exceeded"), 2) >= 20*time.Second)
+}
+
+func TestTransientError(t *testing.T) {
+	assert.True(t, transientError(errors.New("GET https://api.github.com/repos/Clever/microplane/pulls/12: 503 Service Unavailable []")))
+	assert.True(t, transientError(errors.New("fatal: unable to access 'https://github.com/Clever/microplane/': The requested URL returned error: 502")))
+	assert.True(t, transientError(errors.New("You have exceeded a secondary rate limit")))
+	assert.False(t, transientError(errors.New("GET https://api.github.com/repos/Clever/microplane/pulls/12: 404 Not Found []")))
+	assert.False(t, transientError(errors.New("plan failed: exit status 1")))
+	assert.False(t, transientError(nil))
+}
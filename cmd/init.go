@@ -3,21 +3,31 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/verbosity"
 
 	"github.com/spf13/cobra"
 )
 
 var repoProviderFlag string
 var initFlagReposFile string
+var initFlagTopics []string
+var initFlagExcludeTopics []string
+var initFlagOwnedBy string
+var initFlagDependencies bool
+var initFlagCacheTTL time.Duration
+var initFlagRefresh bool
+var initFlagRunID string
 
 var initCmd = &cobra.Command{
 	Use:   "init [query]",
 	Short: "Initialize a microplane workflow",
 	Long: `Initialize a microplane workflow.
 
-There are two ways to init, either (1) from a file or (2) via search
+There are two ways to init, either (1) from a file or (2) via search.
+Both can be used at once, targeting the repos found by either. Repos found more than once are only targeted once.
 
 ## (1) Init from File
 
@@ -40,6 +50,11 @@ $ mp init "org:Clever filename:circle.yml"
 
 would target all Clever repos with a circle.yml file.
 
+To target only the repos a team owns, add --owned-by. It reads each repo's CODEOWNERS, and keeps those where
+the team or user is an owner of the catch-all (*) rule:
+
+$ mp init "org:Clever filename:CODEOWNERS" --owned-by @Clever/infra
+
 See https://help.github.com/articles/searching-code/ for more details about the search syntax on Github.
 
 ### GitLab
@@ -61,10 +76,6 @@ See https://docs.gitlab.com/ee/user/search/advanced_search_syntax.html for more
 			log.Fatal("to init via search, you must pass a search query. otherwise, specify a repos file with -f")
 		}
 
-		if len(args) == 1 && initFlagReposFile != "" {
-			log.Fatal("to init via search, you must pass a search query. otherwise, specify a repos file with -f")
-		}
-
 		query := ""
 		if len(args) > 0 {
 			query = args[0]
@@ -76,11 +87,24 @@ See https://docs.gitlab.com/ee/user/search/advanced_search_syntax.html for more
 			Version:       cliVersion,
 			RepoProvider:  repoProviderFlag,
 			ReposFromFile: initFlagReposFile,
+			Topics:        initFlagTopics,
+			ExcludeTopics: initFlagExcludeTopics,
+			RepoLimiter:   repoLimiter,
+			Codeowner:     initFlagOwnedBy,
+			Dependencies:  initFlagDependencies,
+			CacheTTL:      initFlagCacheTTL,
+			Refresh:       initFlagRefresh,
 		})
 		if err != nil {
 			log.Fatal(err)
 		}
 
+		output.RunID, err = initRunID(initFlagRunID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		verbosity.Printf("run ID is %s", output.RunID)
+
 		err = writeJSON(output, outputPath("", "init"))
 		if err != nil {
 			log.Fatal(err)
@@ -89,5 +113,11 @@ See https://docs.gitlab.com/ee/user/search/advanced_search_syntax.html for more
 		for _, repo := range output.Repos {
 			fmt.Println(repo.Name)
 		}
+		if !output.CachedAt.IsZero() {
+			verbosity.Printf("reused the repos discovered %s ago, use --refresh to discover them again", time.Since(output.CachedAt).Round(time.Second))
+		}
+		if output.Duplicates > 0 {
+			verbosity.Printf("collapsed %d duplicate repo(s)", output.Duplicates)
+		}
 	},
 }
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/Clever/microplane/initialize"
+)
+
+// Clone layouts, see --clone-layout
+const (
+	// layoutDefault nests each repo's working trees in its state, e.g. mp/microplane/clone/cloned
+	layoutDefault = "default"
+	// layoutFlat is e.g. mp/cloned/microplane
+	layoutFlat = "flat"
+	// layoutOrgRepo is e.g. mp/cloned/Clever/microplane
+	layoutOrgRepo = "org-repo"
+	// layoutHostOrgRepo is e.g. mp/cloned/github.com/Clever/microplane, like a GOPATH
+	layoutHostOrgRepo = "host-org-repo"
+)
+
+var cloneLayouts = []string{layoutDefault, layoutFlat, layoutOrgRepo, layoutHostOrgRepo}
+
+// layoutPath is where a repo is laid out under the "cloned" and "planned" directories of the workdir,
+// or "" for layoutDefault
+func layoutPath(layout string, r initialize.Repo) (string, error) {
+	switch layout {
+	case layoutDefault, "":
+		return "", nil
+	case layoutFlat:
+		return r.Name, nil
+	case layoutOrgRepo:
+		return filepath.Join(r.Owner, r.Name), nil
+	case layoutHostOrgRepo:
+		host, err := cloneURLHost(r.CloneURL)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(host, r.Owner, r.Name), nil
+	}
+	return "", fmt.Errorf("unsupported --clone-layout %s, must be one of: %s", layout, strings.Join(cloneLayouts, ", "))
+}
+
+// layoutDir is where a repo's working tree for a step ("cloned" or "planned") goes with a layout,
+// or "" to use the step's default
+func layoutDir(layout string, r initialize.Repo, step string) (string, error) {
+	rel, err := layoutPath(layout, r)
+	if err != nil || rel == "" {
+		return "", err
+	}
+	return filepath.Join(workDir, step, rel), nil
+}
+
+// cloneURLHost is the host of an SSH or HTTPS clone URL, e.g. "github.com" for git@github.com:Clever/microplane
+func cloneURLHost(cloneURL string) (string, error) {
+	if !strings.Contains(cloneURL, "://") {
+		// scp-like syntax, user@host:path
+		hostAndPath := cloneURL[strings.Index(cloneURL, "@")+1:]
+		if i := strings.Index(hostAndPath, ":"); i > 0 {
+			return hostAndPath[:i], nil
+		}
+		return "", fmt.Errorf("can't find the host of clone URL %s", cloneURL)
+	}
+	u, err := url.Parse(cloneURL)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("can't find the host of clone URL %s", cloneURL)
+	}
+	return u.Hostname(), nil
+}
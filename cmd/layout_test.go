@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayoutPath(t *testing.T) {
+	r := initialize.Repo{Name: "microplane", Owner: "Clever", CloneURL: "git@github.com:Clever/microplane"}
+	for layout, expected := range map[string]string{
+		"":              "",
+		"default":       "",
+		"flat":          "microplane",
+		"org-repo":      "Clever/microplane",
+		"host-org-repo": "github.com/Clever/microplane",
+	} {
+		p, err := layoutPath(layout, r)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, p, layout)
+	}
+	_, err := layoutPath("gopath", r)
+	assert.Error(t, err)
+}
+
+func TestCloneURLHost(t *testing.T) {
+	for cloneURL, expected := range map[string]string{
+		"git@github.com:Clever/microplane":             "github.com",
+		"git@gitlab.example.com:group/sub/repo.git":    "gitlab.example.com",
+		"https://github.example.com/Clever/microplane": "github.example.com",
+		"ssh://git@gitlab.example.com:2222/group/repo": "gitlab.example.com",
+	} {
+		host, err := cloneURLHost(cloneURL)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, host, cloneURL)
+	}
+	_, err := cloneURLHost("microplane")
+	assert.Error(t, err)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+)
+
+// adaptiveMinInterval is the fastest an adaptive limiter ticks, however much quota is left,
+// since bursts of requests trigger Github's abuse detection
+const adaptiveMinInterval = 100 * time.Millisecond
+
+// adaptiveTicker returns a ticker that paces API calls to spread the remaining Github quota evenly until it resets,
+// but ticks at most every min. Until the quota is known, e.g. before the first API call or with Gitlab,
+// it ticks every fallback.
+func adaptiveTicker(fallback, min time.Duration) *time.Ticker {
+	c := make(chan time.Time)
+	go func() {
+		for {
+			interval := fallback
+			if remaining, reset, ok := ghclient.Quota(); ok {
+				interval = adaptiveInterval(remaining, reset, time.Now(), min)
+			}
+			time.Sleep(interval)
+			c <- time.Now()
+		}
+	}()
+	return &time.Ticker{C: c}
+}
+
+// throttleTicker returns the ticker of a --throttle, which with --adaptive-rate-limit also slows down
+// when the remaining Github quota is scarce
+func throttleTicker(throttle time.Duration) *time.Ticker {
+	if adaptiveRateLimitFlag {
+		return adaptiveTicker(throttle, throttle)
+	}
+	return time.NewTicker(throttle)
+}
+
+// adaptiveInterval is the time between requests that uses up the remaining quota as it resets
+func adaptiveInterval(remaining int, reset, now time.Time, min time.Duration) time.Duration {
+	untilReset := reset.Sub(now)
+	if untilReset <= 0 {
+		return min
+	}
+	if remaining <= 0 {
+		// wait out the reset, rather than have every request fail
+		return untilReset + time.Second
+	}
+	if interval := untilReset / time.Duration(remaining); interval > min {
+		return interval
+	}
+	return min
+}
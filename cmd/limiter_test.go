@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveInterval(t *testing.T) {
+	now := time.Date(2019, 8, 14, 9, 0, 0, 0, time.UTC)
+	min := 100 * time.Millisecond
+
+	// plenty of quota
+	assert.Equal(t, min, adaptiveInterval(10000, now.Add(10*time.Minute), now, min))
+	// scarce quota is spread until the reset
+	assert.Equal(t, 6*time.Second, adaptiveInterval(100, now.Add(10*time.Minute), now, min))
+	// exhausted quota waits for the reset
+	assert.Equal(t, 61*time.Second, adaptiveInterval(0, now.Add(time.Minute), now, min))
+	// the reset has passed
+	assert.Equal(t, min, adaptiveInterval(0, now.Add(-time.Minute), now, min))
+}
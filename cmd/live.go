@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/merge"
+	"github.com/Clever/microplane/push"
+)
+
+var statusFlagLive bool
+
+// liveDiscrepancies compares a repo's saved push and merge state with its PR's live state,
+// returning how they differ
+func liveDiscrepancies(pushOutput push.Output, mergeOutput merge.Output, live merge.LivePR) []string {
+	discrepancies := []string{}
+	switch {
+	case mergeOutput.Success && !mergeOutput.AutoMergeEnabled && !live.Merged:
+		discrepancies = append(discrepancies, fmt.Sprintf("recorded as merged, but the PR is %s and unmerged", live.State))
+	case live.Merged && !mergeOutput.Success:
+		discrepancies = append(discrepancies, fmt.Sprintf("merged on Github by %s at %s, but not recorded as merged", live.MergedBy, live.MergedAt.Format("2006-01-02 15:04")))
+	case !live.Merged && live.State == "closed":
+		discrepancies = append(discrepancies, "PR was closed without merging")
+	}
+	if live.Merged && mergeOutput.MergeCommitSHA != "" && live.MergeCommitSHA != mergeOutput.MergeCommitSHA {
+		discrepancies = append(discrepancies, fmt.Sprintf("merge commit is %s, recorded as %s", live.MergeCommitSHA, mergeOutput.MergeCommitSHA))
+	}
+	if !live.Merged && pushOutput.CommitSHA != "" && live.HeadSHA != pushOutput.CommitSHA {
+		discrepancies = append(discrepancies, fmt.Sprintf("PR head is %s, not the pushed commit %s", live.HeadSHA, pushOutput.CommitSHA))
+	}
+	if !live.Merged && live.State == "open" && pushOutput.PullRequestCombinedStatus != "" && live.BuildState != pushOutput.PullRequestCombinedStatus {
+		discrepancies = append(discrepancies, fmt.Sprintf("CI is %s, recorded as %s", live.BuildState, pushOutput.PullRequestCombinedStatus))
+	}
+	return discrepancies
+}
+
+// printLive re-fetches the PR of each pushed repo from Github, ignoring the saved state,
+// and lists the repos whose saved state has drifted from reality, e.g. after a PR was merged by hand
+func printLive(repos []initialize.Repo) {
+	var mutex sync.Mutex
+	differ := map[string][]string{}
+	checked := 0
+	err := parallelize(repos, func(r initialize.Repo, ctx context.Context) error {
+		var pushOutput push.Output
+		if r.Provider != "github" || loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil ||
+			!pushOutput.Success || pushOutput.PullRequestNumber == 0 {
+			return nil
+		}
+		live, err := merge.GitHubLivePR(ctx, merge.Input{Org: r.Owner, Repo: r.Name, PRNumber: pushOutput.PullRequestNumber}, repoLimiter)
+		if err != nil {
+			log.Printf("WARNING: %s/%s - error checking PR #%d: %s", r.Owner, r.Name, pushOutput.PullRequestNumber, err.Error())
+			return nil
+		}
+		var mergeOutput merge.Output
+		loadJSON(outputPath(r.Name, "merge"), &mergeOutput)
+		discrepancies := liveDiscrepancies(pushOutput, mergeOutput, live)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		checked++
+		if len(discrepancies) > 0 {
+			differ[fmt.Sprintf("%s/%s#%d", r.Owner, r.Name, pushOutput.PullRequestNumber)] = discrepancies
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("\n%d of %d PR(s) differ from the saved state\n", len(differ), checked)
+	if len(differ) == 0 {
+		return
+	}
+	prs := []string{}
+	for pr := range differ {
+		prs = append(prs, pr)
+	}
+	sort.Strings(prs)
+	out := tabWriterWithDefaults()
+	fmt.Fprintln(out, joinWithTab("PR", "DISCREPANCY"))
+	for _, pr := range prs {
+		fmt.Fprintln(out, joinWithTab(pr, strings.Join(differ[pr], ", ")))
+	}
+	out.Flush()
+}
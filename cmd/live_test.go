@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/merge"
+	"github.com/Clever/microplane/push"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveDiscrepancies(t *testing.T) {
+	pushed := push.Output{Success: true, CommitSHA: "abc", PullRequestCombinedStatus: "pending"}
+
+	// in sync
+	assert.Empty(t, liveDiscrepancies(pushed, merge.Output{}, merge.LivePR{State: "open", HeadSHA: "abc", BuildState: "pending"}))
+	assert.Empty(t, liveDiscrepancies(pushed, merge.Output{Success: true, MergeCommitSHA: "def"},
+		merge.LivePR{State: "closed", Merged: true, MergeCommitSHA: "def", HeadSHA: "abc"}))
+
+	// merged by hand
+	mergedAt := time.Date(2020, 1, 2, 3, 4, 0, 0, time.UTC)
+	assert.Equal(t, []string{"merged on Github by alice at 2020-01-02 03:04, but not recorded as merged"},
+		liveDiscrepancies(pushed, merge.Output{}, merge.LivePR{State: "closed", Merged: true, MergedBy: "alice", MergedAt: mergedAt, HeadSHA: "abc"}))
+
+	// pushed to and CI has finished
+	assert.Equal(t, []string{"PR head is fff, not the pushed commit abc", "CI is failure, recorded as pending"},
+		liveDiscrepancies(pushed, merge.Output{}, merge.LivePR{State: "open", HeadSHA: "fff", BuildState: "failure"}))
+
+	// closed by hand
+	assert.Equal(t, []string{"PR was closed without merging"},
+		liveDiscrepancies(pushed, merge.Output{}, merge.LivePR{State: "closed", HeadSHA: "abc"}))
+
+	// recorded as merged, but the merge never happened
+	assert.Equal(t, []string{"recorded as merged, but the PR is open and unmerged", "CI is success, recorded as pending"},
+		liveDiscrepancies(pushed, merge.Output{Success: true}, merge.LivePR{State: "open", HeadSHA: "abc", BuildState: "success"}))
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+)
+
+// lockFile is held open for the life of the process, see lockWorkDir
+var lockFile *os.File
+
+// readOnlyCommands don't modify state, so can run alongside another microplane process
+var readOnlyCommands = map[string]bool{
+	"archive":    true,
+	"diff":       true,
+	"docs":       true,
+	"export-prs": true,
+	"report":     true,
+	"status":     true,
+}
+
+// lockWorkDir takes an exclusive lock on the workdir, so that two microplane processes can't modify
+// the same state at once. The lock is released by the OS when the process exits, even if it crashes.
+// The lock file records the process and its command, e.g. "mp merge", but not its args, which may have tokens.
+func lockWorkDir(command string) {
+	lockPath := path.Join(workDir, ".lock")
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		log.Fatalf("error opening lock file: %s", err.Error())
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		holder, _ := ioutil.ReadAll(f)
+		f.Close()
+		log.Fatalf("another microplane process (%s) is using %s, wait for it to finish or use a different --state-dir",
+			describeLockHolder(string(holder)), workDir)
+	}
+	f.Truncate(0)
+	f.WriteAt([]byte(fmt.Sprintf("pid %d: %s", os.Getpid(), command)), 0)
+	lockFile = f
+}
+
+func describeLockHolder(holder string) string {
+	if holder = strings.TrimSpace(holder); holder == "" {
+		return "unknown"
+	}
+	return holder
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockWorkDirOmitsArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-lock")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(d string, args []string) { workDir, os.Args = d, args }(workDir, os.Args)
+	workDir = dir
+	os.Args = []string{"mp", "merge", "--github-campaign-token", "s3cr3t-token", "--approver-token=0ther-token"}
+
+	lockWorkDir("mp merge")
+	defer func() {
+		lockFile.Close()
+		lockFile = nil
+	}()
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, ".lock"))
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("pid %d: mp merge", os.Getpid()), string(b))
+	assert.NotContains(t, string(b), "s3cr3t-token")
+	assert.NotContains(t, string(b), "0ther-token")
+}
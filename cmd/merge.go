@@ -2,23 +2,102 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
+	"github.com/Clever/microplane/ghclient"
 	"github.com/Clever/microplane/initialize"
 	"github.com/Clever/microplane/merge"
+	"github.com/Clever/microplane/plan"
 	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/verbosity"
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/semaphore"
 )
 
 // CLI flags
 var mergeFlagThrottle string
 var mergeFlagIgnoreReviewApproval bool
 var mergeFlagIgnoreBuildStatus bool
+var mergeFlagPreflight bool
+var mergeFlagRequireCleanMergeState bool
+var mergeFlagOnlyApproved bool
+var mergeFlagOnlyGreen bool
+var mergeFlagAdminOverride bool
+var mergeFlagCleanup bool
+var mergeFlagIgnoreContexts []string
+var mergeFlagBlockingContexts []string
+var mergeFlagRetargetBase bool
+var mergeFlagWindowStart string
+var mergeFlagWindowEnd string
+var mergeFlagWindowTimezone string
+var mergeFlagWindowDays string
+var mergeFlagWait bool
+var mergeFlagMergeMethod string
+var mergeFlagAutoMerge bool
+var mergeFlagCoAuthors bool
+var mergeFlagRebase bool
+var mergeFlagLabelOutcomes bool
+var mergeFlagMarkReady bool
+var mergeFlagGateCommand string
+var mergeFlagMaxCheckAge string
+var mergeFlagProhibitSelfApproval bool
+var mergeFlagMinApprovals int
+var mergeFlagApprovalsFromProtection bool
+var mergeFlagNeverWithChangesRequested bool
+var mergeFlagOperator string
+var mergeFlagDispatchWorkflow string
+var mergeFlagDispatchEvent string
+var mergeFlagNoDeleteBranch bool
+var mergeFlagMaxMergesPerTeam int
+var mergeFlagJSON string
+var mergeFlagDryRunDiff bool
+var mergeFlagDiffDir string
+var mergeFlagStat bool
+var mergeFlagNoChecksPolicy string
+var mergeFlagNoChecksGrace time.Duration
+var mergeFlagRequirePushedHead bool
+var mergeFlagCommentOutcomes bool
+var mergeFlagCommentTemplate string
+var mergeFlagLinkedIssueState string
+var mergeFlagLinkedIssueLabels []string
+var mergeFlagConcurrency int
+var mergeFlagRetryAttempts int
+var mergeFlagRetryMaxDelay time.Duration
+var mergeFlagMaxInFlightPerOrg int
+var mergeFlagTimeout time.Duration
+var mergeFlagMaxTotalDiff string
+var mergeFlagRequireApprovalAbove string
+var mergeFlagMinExpectedChecks int
+var mergeFlagBuildTimeout time.Duration
+
+// requireApprovalAbove is the parsed --require-approval-above, if set
+var requireApprovalAbove *diffLimit
+var mergeFlagForce bool
+
+// mergeCommentTemplate renders outcome comments, see --comment-outcomes
+var mergeCommentTemplate *template.Template
+
+// mergeTeamCaps enforces --max-merges-per-team
+var mergeTeamCaps = &teamMergeCaps{merged: map[string]int{}}
+
+// mergeOrgLimits enforces --max-in-flight-per-org
+var mergeOrgLimits = &orgMergeLimits{sems: map[string]*semaphore.Weighted{}}
+
+// mergeMaxCheckAge is the parsed --max-check-age
+var mergeMaxCheckAge time.Duration
+
+// mergeWindow, if set, restricts when merges may happen
+var mergeWindow *merge.Window
 
 // rate limits the # of PR merges. used to prevent load on CI system
 var mergeThrottle *time.Ticker
@@ -32,6 +111,15 @@ var mergeCmd = &cobra.Command{
 		if err != nil {
 			log.Fatal(err)
 		}
+		repos = withoutSkipped(repos)
+		targeted := repos
+
+		if mergeFlagDryRunDiff {
+			if err := mergeDiffs(repos); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
 
 		throttle, err := cmd.Flags().GetString("throttle")
 		if err != nil {
@@ -43,40 +131,225 @@ var mergeCmd = &cobra.Command{
 			if err != nil {
 				log.Fatalf("Error parsing --throttle flag: %s", err.Error())
 			}
-			mergeThrottle = time.NewTicker(dur)
+			mergeThrottle = throttleTicker(dur)
+		}
+
+		if mergeFlagMaxCheckAge != "" {
+			mergeMaxCheckAge, err = time.ParseDuration(mergeFlagMaxCheckAge)
+			if err != nil {
+				log.Fatalf("Error parsing --max-check-age flag: %s", err.Error())
+			}
+		}
+
+		if mergeFlagWindowStart != "" || mergeFlagWindowEnd != "" {
+			w, err := merge.ParseWindow(mergeFlagWindowStart, mergeFlagWindowEnd, mergeFlagWindowTimezone, mergeFlagWindowDays)
+			if err != nil {
+				log.Fatal(err)
+			}
+			mergeWindow = &w
+			// Refuse to start outside the window, rather than partially merging
+			if !mergeWindow.Contains(time.Now()) && !mergeFlagWait {
+				log.Fatalf("outside merge window %s, next opens at %s", mergeWindow, mergeWindow.NextOpen(time.Now()))
+			}
+		}
+
+		switch mergeFlagMergeMethod {
+		case "merge", "squash", "rebase":
+		default:
+			log.Fatalf("invalid --merge-method %s, must be one of: merge, squash, rebase", mergeFlagMergeMethod)
+		}
+
+		switch mergeFlagNoChecksPolicy {
+		case merge.NoChecksPending, merge.NoChecksSuccess, merge.NoChecksFailure:
+		default:
+			log.Fatalf("invalid --no-checks-policy %s, must be one of: pending, success, failure", mergeFlagNoChecksPolicy)
+		}
+
+		switch mergeFlagLinkedIssueState {
+		case "", "open", "closed":
+		default:
+			log.Fatalf("invalid --linked-issue-state %s, must be one of: open, closed", mergeFlagLinkedIssueState)
+		}
+
+		if mergeFlagRequirePushedHead && mergeFlagRebase {
+			log.Fatal("--require-pushed-head can't be used with --rebase, which changes the PR's head")
+		}
+
+		if mergeFlagCommentOutcomes {
+			text := merge.DefaultOutcomeCommentTemplate
+			if mergeFlagCommentTemplate != "" {
+				b, err := ioutil.ReadFile(mergeFlagCommentTemplate)
+				if err != nil {
+					log.Fatalf("error reading --comment-template: %s", err.Error())
+				}
+				text = string(b)
+			}
+			mergeCommentTemplate, err = merge.NewCommentTemplate(text)
+			if err != nil {
+				log.Fatalf("error parsing --comment-template: %s", err.Error())
+			}
+		} else if mergeFlagCommentTemplate != "" {
+			log.Fatal("--comment-template requires --comment-outcomes")
+		}
+
+		if mergeFlagConcurrency < 1 {
+			log.Fatal("--concurrency must be at least 1")
+		}
+
+		var maxTotalDiff diffLimit
+		if mergeFlagMaxTotalDiff != "" {
+			maxTotalDiff, err = parseDiffLimit("--max-total-diff", mergeFlagMaxTotalDiff)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if mergeFlagRequireApprovalAbove != "" {
+			limit, err := parseDiffLimit("--require-approval-above", mergeFlagRequireApprovalAbove)
+			if err != nil {
+				log.Fatal(err)
+			}
+			requireApprovalAbove = &limit
+			if mergeFlagIgnoreBuildStatus {
+				log.Fatal("--require-approval-above merges small PRs without review once their build passes, so it can't be used with --ignore-build-status")
+			}
+			if mergeFlagRebase {
+				log.Fatal("--require-approval-above merges small PRs without review only if their head is the pushed commit, so it can't be used with --rebase, which changes the PR's head")
+			}
+		}
+
+		if mergeFlagTimeout < 0 {
+			log.Fatal("--timeout must not be negative")
+		}
+
+		if mergeFlagAdminOverride {
+			log.Printf("WARNING: --admin-override is set. Branch protection will be bypassed for every merge in this run.")
+		}
+
+		// --timeout cancels the run's context, which cuts short the repos in flight and skips the rest
+		if mergeFlagTimeout > 0 {
+			ctx, cancel := context.WithTimeout(runCtx, mergeFlagTimeout)
+			defer cancel()
+			runCtx = ctx
+			go func() {
+				<-ctx.Done()
+				if ctx.Err() == context.DeadlineExceeded {
+					currentMergeRun.timeout()
+				}
+			}()
+		}
+
+		if mergeFlagPreflight {
+			if err := mergePreflight(repos); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if mergeFlagOnlyApproved && !mergeFlagIgnoreReviewApproval {
+			repos, err = onlyApproved(repos)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if mergeFlagOnlyGreen && !mergeFlagIgnoreBuildStatus {
+			repos, err = onlyGreen(repos)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// A last check of the blast radius before any irreversible merges
+		if mergeFlagMaxTotalDiff != "" {
+			if err := totalDiffError(pendingDiffStats(repos), maxTotalDiff); err != nil {
+				if !mergeFlagForce {
+					log.Printf("WARNING: %s", err.Error())
+					log.Fatal("refusing to merge, the plan may have gone wrong. Use --force to merge anyway")
+				}
+				log.Printf("WARNING: %s. Merging anyway, since --force is set", err.Error())
+			}
 		}
 
-		err = parallelize(repos, mergeOneRepo)
+		mergeTeamCaps.max = mergeFlagMaxMergesPerTeam
+		mergeOrgLimits.max = mergeFlagMaxInFlightPerOrg
+
+		// Merge outcomes are saved as each repo completes, so an interrupted run can be resumed
+		alreadyMerged := 0
+		for _, r := range repos {
+			if isMerged(r) {
+				alreadyMerged++
+				currentMergeRun.alreadyMerged[r.Name] = true
+			}
+		}
+		if alreadyMerged > 0 {
+			verbosity.Printf("resuming: %d of %d repos already merged, skipping them", alreadyMerged, len(repos))
+		}
+
+		// Repos are merged after the repos they depend on, see `mp init --dependencies`.
+		// Repos waiting on --throttle for their merge call hold a slot, so --concurrency should be high enough
+		// that other repos' gate checks can proceed meanwhile.
+		for _, layer := range dependencyLayers(repos) {
+			layerErr := parallelizeN(layer, mergeFlagConcurrency, trackProgress("merge", func(r initialize.Repo, ctx context.Context) error {
+				if ctx.Err() != nil {
+					currentMergeRun.skip(r, "not attempted: --timeout reached")
+					return nil
+				}
+				currentMergeRun.begin(r)
+				defer currentMergeRun.end(r)
+				err := mergeOneRepo(r, ctx)
+				if err != nil {
+					currentMergeRun.fail(r, err)
+				}
+				return err
+			}))
+			if err == nil {
+				err = layerErr
+			}
+		}
+		printMergeSummary(repos)
+		if runCtx.Err() == context.DeadlineExceeded {
+			printFailures()
+			err = timeoutError(repos)
+		} else if err != nil {
+			err = batchError("merge", err)
+		}
+		if mergeFlagJSON != "" {
+			if jsonErr := writeMergeResults(mergeFlagJSON, currentMergeRun.results(targeted)); jsonErr != nil {
+				log.Printf("error writing --json: %s", jsonErr.Error())
+			}
+		}
 		if err != nil {
+			endRun(err)
 			log.Fatal(err)
 		}
 	},
 }
 
 func mergeOneRepo(r initialize.Repo, ctx context.Context) error {
-	log.Printf("%s/%s - merging...", r.Owner, r.Name)
+	verbosity.Printf("%s/%s - merging...", r.Owner, r.Name)
 
-	// Exit early if already merged
-	var mergeOutput struct {
-		merge.Output
-		Error string
+	if err := restoreLiftedEnforcement(ctx, r); err != nil {
+		return err
 	}
-	if loadJSON(outputPath(r.Name, "merge"), &mergeOutput) == nil && mergeOutput.Success {
-		log.Printf("%s/%s - already merged", r.Owner, r.Name)
+
+	// Exit early if already merged
+	if isMerged(r) {
+		verbosity.Printf("%s/%s - already merged", r.Owner, r.Name)
+		if err := deleteLingeringBranch(ctx, r); err != nil {
+			return err
+		}
+		if mergeFlagCleanup {
+			return cleanupRepo(r)
+		}
 		return nil
 	}
 
 	// Get previous step's output
 	var pushOutput push.Output
 	if loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil || !pushOutput.Success {
-		log.Printf("%s/%s - skipping, must successfully push first", r.Owner, r.Name)
+		verbosity.Printf("%s/%s - skipping, must successfully push first", r.Owner, r.Name)
+		currentMergeRun.skip(r, "not pushed")
 		return nil
 	}
-	segments := strings.Split(pushOutput.PullRequestURL, "/")
-	prNumber, err := strconv.Atoi(strings.TrimSpace(segments[len(segments)-1]))
-	if err != nil {
-		return err
-	}
 
 	// Prepare workdir for current step's output
 	mergeOutputPath := outputPath(r.Name, "merge")
@@ -85,24 +358,53 @@ func mergeOneRepo(r initialize.Repo, ctx context.Context) error {
 		return err
 	}
 
-	// Execute
-	input := merge.Input{
-		Org:                   r.Owner,
-		Repo:                  r.Name,
-		PRNumber:              prNumber,
-		CommitSHA:             pushOutput.CommitSHA,
-		RequireReviewApproval: !mergeFlagIgnoreReviewApproval,
-		RequireBuildSuccess:   !mergeFlagIgnoreBuildStatus,
+	// A direct commit is already on the base branch, there's no PR to merge
+	if pushOutput.DirectCommit {
+		verbosity.Printf("%s/%s - committed directly to %s, nothing to merge", r.Owner, r.Name, pushOutput.DirectBranch)
+		return writeJSON(merge.Output{Success: true, MergeCommitSHA: pushOutput.CommitSHA}, mergeOutputPath)
+	}
+
+	input, err := mergeInput(r, pushOutput)
+	if err != nil {
+		return err
+	}
+
+	if err := waitForMergeWindow(ctx, r); err != nil {
+		return err
 	}
+
+	if dep := unmergedDependency(r); dep != "" {
+		verbosity.Printf("%s/%s - deferred, waiting on %s to merge first", r.Owner, r.Name, dep)
+		currentMergeRun.skip(r, fmt.Sprintf("deferred: waiting on dependency %s", dep))
+		return nil
+	}
+
+	// Spread merges across teams, leaving the rest of a team's repos for a later run
+	team := teamFor(r)
+	if !mergeTeamCaps.reserve(team) {
+		verbosity.Printf("%s/%s - deferred, %s has had %d merge(s) this run (--max-merges-per-team)", r.Owner, r.Name, team, mergeTeamCaps.max)
+		currentMergeRun.skip(r, fmt.Sprintf("deferred: %s reached --max-merges-per-team", team))
+		return nil
+	}
+
+	// Execute
 	var output merge.Output
-	if r.Provider == "gitlab" {
-		output, err = merge.GitlabMerge(ctx, input, repoLimiter, mergeThrottle)
-	} else if r.Provider == "github" {
-		output, err = merge.GitHubMerge(ctx, input, repoLimiter, mergeThrottle)
+	if len(pushOutput.SplitPRs) > 0 {
+		output, err = mergeSplit(ctx, r, pushOutput)
 	} else {
-		log.Fatal("Provider must be github or gitlab")
+		output, err = mergeWithProvider(ctx, r, input)
+	}
+	if mergeFlagLabelOutcomes && r.Provider == "github" && len(pushOutput.SplitPRs) == 0 {
+		label := merge.OutcomeLabel(output, err)
+		if labelErr := merge.GitHubSetOutcomeLabel(ctx, r.Owner, r.Name, input.PRNumber, label, repoLimiter); labelErr != nil {
+			log.Printf("WARNING: %s/%s - failed to label PR: %s", r.Owner, r.Name, labelErr.Error())
+		}
+	}
+	if mergeFlagCommentOutcomes && r.Provider == "github" && len(pushOutput.SplitPRs) == 0 {
+		commentOutcome(ctx, r, input.PRNumber, output, err)
 	}
 	if err != nil {
+		mergeTeamCaps.release(team)
 		log.Printf("%s/%s - merge error: %s", r.Owner, r.Name, err.Error())
 		o := struct {
 			merge.Output
@@ -111,6 +413,459 @@ func mergeOneRepo(r initialize.Repo, ctx context.Context) error {
 		writeJSON(o, mergeOutputPath)
 		return err
 	}
-	writeJSON(output, mergeOutputPath)
+	if output.AutoMergeEnabled {
+		verbosity.Printf("%s/%s - auto-merge enabled, Github will merge once checks and reviews pass", r.Owner, r.Name)
+	}
+	for _, warning := range output.Warnings {
+		log.Printf("WARNING: %s/%s - %s", r.Owner, r.Name, warning)
+	}
+	if output.AdminOverride {
+		log.Printf("WARNING: %s/%s - merged with admin override, bypassing branch protection", r.Owner, r.Name)
+	}
+	if err := writeJSON(output, mergeOutputPath); err != nil {
+		return fmt.Errorf("%s/%s - merged, but failed to save state: %s", r.Owner, r.Name, err.Error())
+	}
+	if mergeFlagCleanup && output.Success {
+		return cleanupRepo(r)
+	}
 	return nil
 }
+
+// commentOutcome comments on a PR with the outcome of merging it, see --comment-outcomes.
+// Failing to comment is only a warning.
+func commentOutcome(ctx context.Context, r initialize.Repo, prNumber int, output merge.Output, mergeErr error) {
+	data := merge.CommentData{Org: r.Owner, Repo: r.Name, PRNumber: prNumber, Campaign: campaignFlag}
+	body, err := merge.OutcomeComment(mergeCommentTemplate, data, output, mergeErr)
+	if err == nil && body != "" {
+		var commented bool
+		commented, err = merge.GitHubCommentOutcome(ctx, r.Owner, r.Name, prNumber, body, repoLimiter)
+		if commented {
+			verbosity.Debugf("%s/%s - commented on PR: %s", r.Owner, r.Name, body)
+		}
+	}
+	if err != nil {
+		log.Printf("WARNING: %s/%s - failed to comment on PR: %s", r.Owner, r.Name, err.Error())
+	}
+}
+
+// printMergeSummary prints how much the merged repos changed, from the diffstats recorded by plan
+func printMergeSummary(repos []initialize.Repo) {
+	reports := []repoReport{}
+	merged := 0
+	for _, r := range repos {
+		report := getRepoReport(r)
+		if report.Status == "merged" {
+			merged++
+		}
+		reports = append(reports, report)
+	}
+	total := mergedDiffStat(reports)
+	verbosity.Printf("%d of %d repos merged, changing %s", merged, len(repos), total)
+}
+
+// timeoutError reports how far a merge run got before --timeout. The repos in flight have saved their
+// state as failed, so a later run picks them back up.
+func timeoutError(repos []initialize.Repo) error {
+	completed, inFlight, notAttempted := currentMergeRun.timeoutReport(repos)
+	log.Printf("completed (%d): %s", len(completed), strings.Join(completed, ", "))
+	log.Printf("in flight (%d): %s", len(inFlight), strings.Join(inFlight, ", "))
+	log.Printf("never attempted (%d): %s", len(notAttempted), strings.Join(notAttempted, ", "))
+	return fmt.Errorf("merge --timeout of %s reached, %d repo(s) were cut short and %d never attempted", mergeFlagTimeout, len(inFlight), len(notAttempted))
+}
+
+// deleteLingeringBranch deletes the branch of a merged PR, if it couldn't be deleted when the PR was merged
+func deleteLingeringBranch(ctx context.Context, r initialize.Repo) error {
+	var output merge.Output
+	if loadJSON(outputPath(r.Name, "merge"), &output) != nil || output.LingeringBranch == "" || r.Provider != "github" || !deleteBranchFor(r) {
+		return nil
+	}
+	if err := merge.GitHubDeleteBranch(ctx, r.Owner, r.Name, output.LingeringBranch, repoLimiter); err != nil {
+		log.Printf("WARNING: %s/%s - %s", r.Owner, r.Name, err.Error())
+		return nil
+	}
+	verbosity.Printf("%s/%s - deleted lingering branch %s", r.Owner, r.Name, output.LingeringBranch)
+	output.LingeringBranch = ""
+	output.Warnings = nil
+	return writeJSON(output, outputPath(r.Name, "merge"))
+}
+
+// liftedEnforcement is a base branch whose admin enforcement --admin-override lifted, recorded until it's restored
+type liftedEnforcement struct {
+	Branch   string
+	LiftedAt time.Time
+}
+
+func liftedEnforcementPath(r initialize.Repo) string {
+	return filepath.Join(filepath.Dir(outputPath(r.Name, "merge")), "lifted-admin-enforcement.json")
+}
+
+// recordAdminEnforcement saves the base branch whose admin enforcement is lifted in the repo's state,
+// and removes it once restored, see merge.Input.RecordAdminEnforcement
+func recordAdminEnforcement(r initialize.Repo) func(branch string, lifted bool) error {
+	return func(branch string, lifted bool) error {
+		if lifted {
+			return writeJSON(liftedEnforcement{Branch: branch, LiftedAt: time.Now()}, liftedEnforcementPath(r))
+		}
+		if err := os.Remove(liftedEnforcementPath(r)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+}
+
+// restoreLiftedEnforcement restores admin enforcement that an earlier merge lifted but didn't restore,
+// e.g. because it crashed
+func restoreLiftedEnforcement(ctx context.Context, r initialize.Repo) error {
+	var lifted liftedEnforcement
+	if r.Provider != "github" || loadJSON(liftedEnforcementPath(r), &lifted) != nil {
+		return nil
+	}
+	if err := merge.GitHubRestoreAdminEnforcement(ctx, r.Owner, r.Name, lifted.Branch, repoLimiter); err != nil {
+		return fmt.Errorf("%s/%s - failed to restore branch protection for admins on %s, lifted by --admin-override at %s: %s",
+			r.Owner, r.Name, lifted.Branch, lifted.LiftedAt.Format(time.RFC3339), err.Error())
+	}
+	log.Printf("%s/%s - restored branch protection for admins on %s, lifted by --admin-override at %s", r.Owner, r.Name, lifted.Branch, lifted.LiftedAt.Format(time.RFC3339))
+	return recordAdminEnforcement(r)(lifted.Branch, false)
+}
+
+// cleanupRepo removes a repo's local working trees to free up disk space, leaving its state files intact
+func cleanupRepo(r initialize.Repo) error {
+	for _, step := range []string{"clone", "plan"} {
+		var output struct {
+			ClonedIntoDir string
+			PlanDir       string
+		}
+		if loadJSON(outputPath(r.Name, step), &output) != nil {
+			continue
+		}
+		for _, dir := range []string{output.ClonedIntoDir, output.PlanDir} {
+			if dir == "" {
+				continue
+			}
+			if err := os.RemoveAll(dir); err != nil {
+				return fmt.Errorf("%s/%s - error cleaning up %s: %s", r.Owner, r.Name, dir, err.Error())
+			}
+		}
+	}
+	verbosity.Printf("%s/%s - cleaned up local working trees", r.Owner, r.Name)
+	return nil
+}
+
+func mergeWithProvider(ctx context.Context, r initialize.Repo, input merge.Input) (merge.Output, error) {
+	if r.Provider == "gitlab" {
+		return merge.GitlabMerge(ctx, input, repoLimiter, mergeThrottle)
+	} else if r.Provider == "github" {
+		return merge.GitHubMerge(ctx, input, repoLimiter, mergeThrottle)
+	}
+	log.Fatal("Provider must be github or gitlab")
+	return merge.Output{}, nil
+}
+
+// mergeSplit merges each of the PRs opened for a split change.
+// The repo is only merged once all of them are, but each PR is merged as soon as it's ready.
+func mergeSplit(ctx context.Context, r initialize.Repo, pushOutput push.Output) (merge.Output, error) {
+	output := merge.Output{Success: true}
+	errs := []string{}
+	for _, split := range pushOutput.SplitPRs {
+		input, err := mergeInput(r, push.Output{PullRequestURL: split.PullRequestURL, CommitSHA: split.CommitSHA})
+		if err != nil {
+			return merge.Output{Success: false}, err
+		}
+		o, err := mergeWithProvider(ctx, r, input)
+		output.Splits = append(output.Splits, o)
+		output.AdminOverride = output.AdminOverride || o.AdminOverride
+		if err != nil {
+			output.Success = false
+			errs = append(errs, fmt.Sprintf("split %s: %s", split.Group, err.Error()))
+			continue
+		}
+		if o.AutoMergeEnabled {
+			// left for Github to merge, so the repo isn't merged yet
+			output.Success = false
+			output.AutoMergeEnabled = true
+			verbosity.Printf("%s/%s - auto-merge enabled for split %s", r.Owner, r.Name, split.Group)
+			continue
+		}
+		verbosity.Printf("%s/%s - merged split %s", r.Owner, r.Name, split.Group)
+	}
+	if len(errs) > 0 {
+		return output, fmt.Errorf("%d of %d split PRs not merged: %s", len(errs), len(pushOutput.SplitPRs), strings.Join(errs, " | "))
+	}
+	return output, nil
+}
+
+// mergeInput builds the input to merge a repo, from its push output and the merge flags
+func mergeInput(r initialize.Repo, pushOutput push.Output) (merge.Input, error) {
+	segments := strings.Split(pushOutput.PullRequestURL, "/")
+	prNumber, err := strconv.Atoi(strings.TrimSpace(segments[len(segments)-1]))
+	if err != nil {
+		return merge.Input{}, err
+	}
+	var planOutput plan.Output
+	if mergeFlagRebase {
+		if err := loadJSON(outputPath(r.Name, "plan"), &planOutput); err != nil {
+			return merge.Input{}, fmt.Errorf("--rebase needs the planned repo: %s", err.Error())
+		}
+	}
+	override := overrideFor(r)
+	requireApproval := !mergeFlagIgnoreReviewApproval && !override.IgnoreReviewApproval
+	expectedHead := ""
+	if mergeFlagRequirePushedHead {
+		expectedHead = pushOutput.CommitSHA
+	}
+	if requireApproval && requireApprovalAbove != nil && smallChange(r, *requireApprovalAbove) {
+		verbosity.Debugf("%s/%s - planned change is at most %s, so it doesn't need approval", r.Owner, r.Name, requireApprovalAbove)
+		requireApproval = false
+		// the size is of the planned change, so nothing else may have been pushed since
+		expectedHead = pushOutput.CommitSHA
+	}
+	mergeMethod := mergeFlagMergeMethod
+	if override.MergeMethod != "" {
+		mergeMethod = override.MergeMethod
+	}
+	if mergeFlagCoAuthors && mergeMethod != "squash" {
+		return merge.Input{}, fmt.Errorf("--co-authors requires the squash merge method, but the repo is merged with %s", mergeMethod)
+	}
+	return merge.Input{
+		Org:                            r.Owner,
+		Repo:                           r.Name,
+		PRNumber:                       prNumber,
+		CommitSHA:                      pushOutput.CommitSHA,
+		RequireReviewApproval:          requireApproval,
+		MinApprovals:                   mergeFlagMinApprovals,
+		ApprovalsFromProtection:        mergeFlagApprovalsFromProtection,
+		RequireBuildSuccess:            !mergeFlagIgnoreBuildStatus && !override.IgnoreBuildStatus,
+		IgnoreContexts:                 mergeFlagIgnoreContexts,
+		MinExpectedChecks:              mergeFlagMinExpectedChecks,
+		BuildTimeout:                   mergeFlagBuildTimeout,
+		BlockingContexts:               mergeFlagBlockingContexts,
+		MaxCheckAge:                    mergeMaxCheckAge,
+		RequireCleanMergeState:         mergeFlagRequireCleanMergeState,
+		RetargetBaseBranch:             mergeFlagRetargetBase,
+		MarkReadyForReview:             mergeFlagMarkReady,
+		GateCommand:                    mergeFlagGateCommand,
+		RebaseBeforeMerge:              mergeFlagRebase,
+		PlanDir:                        planOutput.PlanDir,
+		AdminOverride:                  mergeFlagAdminOverride,
+		RecordAdminEnforcement:         recordAdminEnforcement(r),
+		AcquireMergeSlot:               func(ctx context.Context) (func(), error) { return mergeOrgLimits.acquire(ctx, r.Owner) },
+		Window:                         mergeWindow,
+		MergeMethod:                    mergeMethod,
+		CoAuthors:                      mergeFlagCoAuthors,
+		EnableAutoMerge:                mergeFlagAutoMerge,
+		ProhibitSelfApproval:           mergeFlagProhibitSelfApproval,
+		NeverMergeWithChangesRequested: mergeFlagNeverWithChangesRequested,
+		Operator:                       mergeFlagOperator,
+		DispatchWorkflow:               mergeFlagDispatchWorkflow,
+		DispatchEvent:                  mergeFlagDispatchEvent,
+		KeepBranch:                     !deleteBranchFor(r),
+		NoChecksPolicy:                 mergeFlagNoChecksPolicy,
+		NoChecksGracePeriod:            mergeFlagNoChecksGrace,
+		ExpectedHeadSHA:                expectedHead,
+		LinkedIssueState:               mergeFlagLinkedIssueState,
+		LinkedIssueLabels:              mergeFlagLinkedIssueLabels,
+		Retry:                          merge.RetryPolicy{MaxAttempts: mergeFlagRetryAttempts, MaxDelay: mergeFlagRetryMaxDelay},
+	}, nil
+}
+
+// smallChange returns whether a repo's planned change is within limit, see --require-approval-above.
+// A change whose size isn't known isn't small.
+func smallChange(r initialize.Repo, limit diffLimit) bool {
+	var planOutput plan.Output
+	if loadJSON(outputPath(r.Name, "plan"), &planOutput) != nil || !planOutput.Success {
+		return false
+	}
+	return limit.size(planOutput.DiffStat) <= limit.max
+}
+
+// onlyApproved filters repos down to those whose PRs are already approved, using a lightweight check.
+// Repos that haven't been pushed, or are already merged, are left for mergeOneRepo to report on.
+func onlyApproved(repos []initialize.Repo) ([]initialize.Repo, error) {
+	var mutex sync.Mutex
+	eligible := []initialize.Repo{}
+	notEligible := 0
+	err := parallelize(repos, func(r initialize.Repo, ctx context.Context) error {
+		var pushOutput push.Output
+		if isMerged(r) || loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil || !pushOutput.Success || pushOutput.DirectCommit {
+			mutex.Lock()
+			eligible = append(eligible, r)
+			mutex.Unlock()
+			return nil
+		}
+		input, err := mergeInput(r, pushOutput)
+		if err != nil {
+			return err
+		}
+		if !input.RequireReviewApproval {
+			// e.g. a small change, see --require-approval-above
+			mutex.Lock()
+			eligible = append(eligible, r)
+			mutex.Unlock()
+			return nil
+		}
+
+		var approvalErr error
+		if r.Provider == "gitlab" {
+			approvalErr, err = merge.GitlabApproval(ctx, input, repoLimiter)
+		} else {
+			approvalErr, err = merge.GitHubApproval(ctx, input, repoLimiter)
+		}
+		if err != nil {
+			return fmt.Errorf("%s/%s - error checking approval: %s", r.Owner, r.Name, err.Error())
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if approvalErr != nil {
+			verbosity.Printf("%s/%s - not yet eligible: %s", r.Owner, r.Name, approvalErr.Error())
+			currentMergeRun.skip(r, fmt.Sprintf("not yet eligible: %s", approvalErr.Error()))
+			notEligible++
+			return nil
+		}
+		eligible = append(eligible, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(initialize.ByName(eligible))
+	verbosity.Printf("%d repo(s) not yet eligible to merge, skipping them", notEligible)
+	return eligible, nil
+}
+
+// mergeDiffs shows what merging each repo's PR would bring into its base branch, without merging,
+// so that the campaign owner can do a final review. Diffs are printed, or written to --diff-dir.
+func mergeDiffs(repos []initialize.Repo) error {
+	if mergeFlagDiffDir != "" {
+		if err := os.MkdirAll(mergeFlagDiffDir, 0755); err != nil {
+			return err
+		}
+	}
+	var mutex sync.Mutex
+	diffs := map[string]string{}
+	err := parallelize(repos, func(r initialize.Repo, ctx context.Context) error {
+		var pushOutput push.Output
+		if isMerged(r) || loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil || !pushOutput.Success ||
+			pushOutput.PullRequestNumber == 0 {
+			return nil
+		}
+		if r.Provider != "github" {
+			log.Printf("%s/%s - --dry-run-diff is only supported for github repos", r.Owner, r.Name)
+			return nil
+		}
+		diff, err := push.GithubPRDiff(ctx, r.Owner, r.Name, pushOutput.PullRequestNumber, repoLimiter)
+		if err != nil {
+			return fmt.Errorf("%s/%s - error fetching diff: %s", r.Owner, r.Name, err.Error())
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		diffs[fmt.Sprintf("%s/%s #%d", r.Owner, r.Name, pushOutput.PullRequestNumber)] = diff
+		if mergeFlagDiffDir != "" {
+			return ioutil.WriteFile(filepath.Join(mergeFlagDiffDir, fmt.Sprintf("%s-%s.diff", r.Owner, r.Name)), []byte(diff), 0644)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for name := range diffs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch {
+		case mergeFlagStat:
+			fmt.Printf("%s: %s\n", name, plan.ParseDiffStat(diffs[name]))
+		case mergeFlagDiffDir == "":
+			fmt.Printf("==> %s\n%s\n", name, diffs[name])
+		}
+	}
+	if mergeFlagDiffDir != "" {
+		verbosity.Printf("wrote %d diff(s) to %s", len(diffs), mergeFlagDiffDir)
+	}
+	return nil
+}
+
+// isMerged checks the saved state to see if a repo has already been merged
+func isMerged(r initialize.Repo) bool {
+	var mergeOutput struct {
+		merge.Output
+		Error string
+	}
+	return loadJSON(outputPath(r.Name, "merge"), &mergeOutput) == nil && mergeOutput.Success
+}
+
+// mergePreflight checks the branch protection of each pushed Github repo before any merges are attempted.
+// If the authenticated user can't merge into some of the repos, it returns an error listing them.
+func mergePreflight(repos []initialize.Repo) error {
+	ctx := context.Background()
+	login, err := merge.GitHubLogin(ctx, ghclient.Campaign, repoLimiter)
+	if err != nil {
+		return fmt.Errorf("preflight: error looking up authenticated user: %s", err.Error())
+	}
+
+	var mutex sync.Mutex
+	blocked := []string{}
+	err = parallelize(repos, func(r initialize.Repo, ctx context.Context) error {
+		if r.Provider != "github" {
+			return nil
+		}
+		var pushOutput push.Output
+		if loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil || !pushOutput.Success || pushOutput.DirectCommit {
+			return nil
+		}
+
+		report, err := merge.GitHubProtectionPreflight(ctx, r.Owner, r.Name, pushedBaseBranch(r), login, repoLimiter)
+		if err != nil {
+			return fmt.Errorf("%s/%s - preflight error: %s", r.Owner, r.Name, err.Error())
+		}
+		for _, gate := range report.Gates {
+			verbosity.Printf("%s/%s - %s is protected: %s", r.Owner, r.Name, report.Branch, gate)
+		}
+		for _, warning := range report.Warnings {
+			log.Printf("%s/%s - preflight warning: %s", r.Owner, r.Name, warning)
+		}
+		if len(report.Blockers) > 0 {
+			log.Printf("%s/%s - preflight blocked: %s", r.Owner, r.Name, strings.Join(report.Blockers, "; "))
+			mutex.Lock()
+			blocked = append(blocked, fmt.Sprintf("%s/%s", r.Owner, r.Name))
+			mutex.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(blocked) > 0 {
+		return fmt.Errorf("preflight: %s can't merge to the base branch in %d repo(s), no merges were attempted: %s",
+			login, len(blocked), strings.Join(blocked, ", "))
+	}
+	verbosity.Printf("preflight: %s can merge in all targeted repos", login)
+	return nil
+}
+
+// waitForMergeWindow checks that the merge window, if any, is open.
+// With --wait, it sleeps until the window opens, or the run is canceled.
+func waitForMergeWindow(ctx context.Context, r initialize.Repo) error {
+	if mergeWindow == nil {
+		return nil
+	}
+	now := time.Now()
+	if mergeWindow.Contains(now) {
+		return nil
+	}
+	next := mergeWindow.NextOpen(now)
+	if !mergeFlagWait {
+		return fmt.Errorf("%s/%s - outside merge window %s, next opens at %s", r.Owner, r.Name, mergeWindow, next)
+	}
+	verbosity.Printf("%s/%s - outside merge window %s, waiting until %s", r.Owner, r.Name, mergeWindow, next)
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%s/%s - stopped waiting for merge window %s: %s", r.Owner, r.Name, mergeWindow, ctx.Err())
+	case <-time.After(next.Sub(now)):
+		return nil
+	}
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/push"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeInputCoAuthors(t *testing.T) {
+	defer func(o map[string]repoOverride) { overrides = o }(overrides)
+	defer func(method string, coAuthors bool) {
+		mergeFlagMergeMethod, mergeFlagCoAuthors = method, coAuthors
+	}(mergeFlagMergeMethod, mergeFlagCoAuthors)
+	overrides = map[string]repoOverride{"Clever/squashed": {MergeMethod: "squash"}}
+	mergeFlagMergeMethod, mergeFlagCoAuthors = "merge", true
+	pushOutput := push.Output{PullRequestURL: "https://github.com/Clever/squashed/pull/7"}
+
+	input, err := mergeInput(initialize.Repo{Owner: "Clever", Name: "squashed"}, pushOutput)
+	assert.NoError(t, err)
+	assert.Equal(t, "squash", input.MergeMethod)
+	assert.True(t, input.CoAuthors)
+
+	_, err = mergeInput(initialize.Repo{Owner: "Clever", Name: "merged"}, pushOutput)
+	assert.EqualError(t, err, "--co-authors requires the squash merge method, but the repo is merged with merge")
+}
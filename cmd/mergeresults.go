@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/merge"
+	"github.com/Clever/microplane/push"
+)
+
+// mergeResult is a repo's outcome in a merge run, see --json. Its fields are a stable schema
+// for automation, so they must not be renamed or removed.
+type mergeResult struct {
+	Repo           string `json:"repo"`
+	Success        bool   `json:"success"`
+	AlreadyMerged  bool   `json:"alreadyMerged"`
+	SkippedReason  string `json:"skippedReason"`
+	Error          string `json:"error"`
+	MergeCommitSHA string `json:"mergeCommitSHA"`
+	PRURL          string `json:"prURL"`
+	// Output is everything recorded by the merge step
+	Output merge.Output `json:"output"`
+}
+
+// mergeRun collects what happened to each repo during a merge run, beyond what's saved in its state
+type mergeRun struct {
+	sync.Mutex
+	alreadyMerged map[string]bool
+	skipped       map[string]string
+	errors        map[string]string
+	// attempted and finished track which repos were in flight when --timeout was reached
+	attempted map[string]bool
+	finished  map[string]bool
+	timedOut  bool
+}
+
+var currentMergeRun = &mergeRun{
+	alreadyMerged: map[string]bool{},
+	skipped:       map[string]string{},
+	errors:        map[string]string{},
+	attempted:     map[string]bool{},
+	finished:      map[string]bool{},
+}
+
+// skip records why a repo wasn't merged this run
+func (m *mergeRun) skip(r initialize.Repo, reason string) {
+	m.Lock()
+	defer m.Unlock()
+	m.skipped[r.Name] = reason
+}
+
+func (m *mergeRun) fail(r initialize.Repo, err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.errors[r.Name] = err.Error()
+}
+
+// begin records that a repo is being merged
+func (m *mergeRun) begin(r initialize.Repo) {
+	m.Lock()
+	defer m.Unlock()
+	m.attempted[r.Name] = true
+}
+
+// end records that a repo is done, unless the run has already timed out, in which case it was cut short
+func (m *mergeRun) end(r initialize.Repo) {
+	m.Lock()
+	defer m.Unlock()
+	if !m.timedOut {
+		m.finished[r.Name] = true
+	}
+}
+
+// timeout records that --timeout was reached, cancelling the repos in flight
+func (m *mergeRun) timeout() {
+	m.Lock()
+	defer m.Unlock()
+	m.timedOut = true
+}
+
+// timeoutReport splits repos into those that completed before --timeout, those in flight when it was reached,
+// and those never attempted
+func (m *mergeRun) timeoutReport(repos []initialize.Repo) (completed, inFlight, notAttempted []string) {
+	m.Lock()
+	defer m.Unlock()
+	for _, r := range repos {
+		if m.finished[r.Name] {
+			completed = append(completed, r.Name)
+		} else if m.attempted[r.Name] {
+			inFlight = append(inFlight, r.Name)
+		} else {
+			notAttempted = append(notAttempted, r.Name)
+		}
+	}
+	return completed, inFlight, notAttempted
+}
+
+// results combines what happened during the run with each repo's saved state
+func (m *mergeRun) results(repos []initialize.Repo) []mergeResult {
+	m.Lock()
+	defer m.Unlock()
+	results := []mergeResult{}
+	for _, r := range repos {
+		result := mergeResult{
+			Repo:          fmt.Sprintf("%s/%s", r.Owner, r.Name),
+			AlreadyMerged: m.alreadyMerged[r.Name],
+			SkippedReason: m.skipped[r.Name],
+		}
+		var pushOutput push.Output
+		if loadJSON(outputPath(r.Name, "push"), &pushOutput) == nil {
+			result.PRURL = pushOutput.PullRequestURL
+		}
+		var mergeOutput struct {
+			merge.Output
+			Error string
+		}
+		// a skipped repo's saved state is from an earlier run
+		if result.SkippedReason == "" && loadJSON(outputPath(r.Name, "merge"), &mergeOutput) == nil {
+			result.Output = mergeOutput.Output
+			result.Success = mergeOutput.Success
+			result.Error = mergeOutput.Error
+			result.MergeCommitSHA = mergeOutput.MergeCommitSHA
+		}
+		if result.Error == "" && !result.Success {
+			result.Error = m.errors[r.Name]
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// writeMergeResults writes the results of a merge run as JSON to a file, or stdout if the file is "-"
+func writeMergeResults(file string, results []mergeResult) error {
+	if file == "-" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(results)
+	}
+	return writeJSON(results, file)
+}
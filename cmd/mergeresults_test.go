@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/merge"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutReport(t *testing.T) {
+	run := &mergeRun{attempted: map[string]bool{}, finished: map[string]bool{}}
+	repos := []initialize.Repo{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}}
+	run.begin(repos[0])
+	run.end(repos[0])
+	run.begin(repos[1])
+	run.begin(repos[2])
+	run.timeout()
+	run.end(repos[1])
+
+	completed, inFlight, notAttempted := run.timeoutReport(repos)
+	assert.Equal(t, []string{"a"}, completed)
+	assert.Equal(t, []string{"b", "c"}, inFlight)
+	assert.Equal(t, []string{"d"}, notAttempted)
+}
+
+func TestWaitForMergeWindowCanceled(t *testing.T) {
+	defer func(w *merge.Window, wait bool) { mergeWindow, mergeFlagWait = w, wait }(mergeWindow, mergeFlagWait)
+	// a one minute window that isn't open now
+	start, end := "00:00", "00:01"
+	if time.Now().UTC().Hour() == 0 {
+		start, end = "12:00", "12:01"
+	}
+	w, err := merge.ParseWindow(start, end, "UTC", "")
+	assert.NoError(t, err)
+	mergeWindow, mergeFlagWait = &w, true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan error)
+	go func() { done <- waitForMergeWindow(ctx, initialize.Repo{Owner: "Clever", Name: "microplane"}) }()
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting for the merge window ignored the canceled context")
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/metrics"
+	"github.com/spf13/cobra"
+)
+
+// metricsAddrFlag and pushgatewayFlag enable Prometheus metrics, served during the run or pushed at its end
+var metricsAddrFlag string
+var pushgatewayFlag string
+
+var runCommand string
+var runStartedAt time.Time
+var endMetricsOnce sync.Once
+
+func metricsEnabled() bool {
+	return metricsAddrFlag != "" || pushgatewayFlag != ""
+}
+
+// startMetrics starts serving metrics, if --metrics-addr is set
+func startMetrics(cmd *cobra.Command) {
+	runCommand = cmd.Name()
+	runStartedAt = time.Now()
+	if metricsAddrFlag != "" {
+		if err := metrics.Serve(metricsAddrFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// recordOutcome counts a repo that a step has processed: failed if it returned an error,
+// succeeded if its saved state says so, and skipped otherwise
+func recordOutcome(step string, r initialize.Repo, err error) {
+	if !metricsEnabled() {
+		return
+	}
+	outcome := "skipped"
+	var output struct{ Success bool }
+	if err != nil {
+		outcome = "failed"
+	} else if loadJSON(outputPath(r.Name, step), &output) == nil && output.Success {
+		outcome = "succeeded"
+	}
+	metrics.Inc(metrics.ReposTotal, "step", step, "outcome", outcome)
+}
+
+// endMetrics records the run's outcome and duration, and pushes the metrics to --pushgateway
+func endMetrics(err error) {
+	if !metricsEnabled() {
+		return
+	}
+	endMetricsOnce.Do(func() {
+		if _, ok := stepVerbs[runCommand]; ok {
+			metrics.Set(metrics.StepDurationSeconds, time.Since(runStartedAt).Seconds(), "step", runCommand)
+		}
+		if remaining, _, ok := ghclient.Quota(); ok {
+			metrics.Set(metrics.RateLimitRemaining, float64(remaining))
+		}
+		success := 1.0
+		if err != nil {
+			success = 0
+		}
+		metrics.Set(metrics.LastRunSuccess, success, "command", runCommand)
+		metrics.Set(metrics.LastRunTimestampSeconds, float64(time.Now().Unix()), "command", runCommand)
+		if pushgatewayFlag == "" {
+			return
+		}
+		grouping := []string{}
+		if campaignFlag != "" {
+			grouping = append(grouping, "campaign", campaignFlag)
+		}
+		if err := metrics.Push(pushgatewayFlag, "microplane", grouping...); err != nil {
+			log.Printf("WARNING: %s", err.Error())
+		}
+	})
+}
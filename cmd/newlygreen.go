@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/merge"
+	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/verbosity"
+)
+
+// buildObservation is the build state of a repo's PR head when merge last checked it, see onlyGreen
+type buildObservation struct {
+	CommitSHA  string
+	State      string
+	ObservedAt time.Time
+}
+
+// newlyGreen returns whether a build is worth merging, and whether it has turned green since it was last observed.
+// A build observed on a different commit, e.g. after a re-push, hasn't been observed before.
+func newlyGreen(last buildObservation, commitSHA, state string) (eligible, newly bool) {
+	if state != "success" {
+		return false, false
+	}
+	return true, last.CommitSHA != commitSHA || last.State != "success"
+}
+
+// onlyGreen filters repos down to those whose build has succeeded, using a lightweight check, and records
+// each build's state for the next run. Repos whose build has newly turned green are merged first.
+// Repos that haven't been pushed, or are already merged, are left for mergeOneRepo to report on.
+func onlyGreen(repos []initialize.Repo) ([]initialize.Repo, error) {
+	var mutex sync.Mutex
+	unchecked := []initialize.Repo{}
+	newly := []initialize.Repo{}
+	stillGreen := []initialize.Repo{}
+	notEligible := 0
+	for _, r := range repos {
+		if err := os.MkdirAll(filepath.Dir(outputPath(r.Name, "build")), 0755); err != nil {
+			return nil, err
+		}
+	}
+	err := parallelize(repos, func(r initialize.Repo, ctx context.Context) error {
+		var pushOutput push.Output
+		if isMerged(r) || loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil || !pushOutput.Success || pushOutput.DirectCommit {
+			mutex.Lock()
+			unchecked = append(unchecked, r)
+			mutex.Unlock()
+			return nil
+		}
+		input, err := mergeInput(r, pushOutput)
+		if err != nil {
+			return err
+		}
+
+		// the build is of the PR's live head, since it may have been pushed to since, e.g. by a rebase
+		var state, head string
+		if r.Provider == "gitlab" {
+			state, head, err = merge.GitlabBuildState(ctx, input, repoLimiter)
+		} else {
+			state, head, err = merge.GitHubBuildState(ctx, input, repoLimiter)
+		}
+		if err != nil {
+			return fmt.Errorf("%s/%s - error checking build status: %s", r.Owner, r.Name, err.Error())
+		}
+
+		var last buildObservation
+		loadJSON(outputPath(r.Name, "build"), &last)
+		if err := writeJSON(buildObservation{CommitSHA: head, State: state, ObservedAt: time.Now()}, outputPath(r.Name, "build")); err != nil {
+			return err
+		}
+
+		eligible, isNew := newlyGreen(last, head, state)
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case !eligible:
+			verbosity.Printf("%s/%s - not yet eligible: build is %s", r.Owner, r.Name, state)
+			currentMergeRun.skip(r, fmt.Sprintf("not yet eligible: build is %s", state))
+			notEligible++
+		case isNew:
+			verbosity.Printf("%s/%s - build is newly green", r.Owner, r.Name)
+			newly = append(newly, r)
+		default:
+			stillGreen = append(stillGreen, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(initialize.ByName(unchecked))
+	sort.Sort(initialize.ByName(newly))
+	sort.Sort(initialize.ByName(stillGreen))
+	verbosity.Printf("%d repo(s) newly green, %d still green, %d not yet eligible to merge", len(newly), len(stillGreen), notEligible)
+	return append(append(newly, stillGreen...), unchecked...), nil
+}
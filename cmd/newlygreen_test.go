@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewlyGreen(t *testing.T) {
+	pending := buildObservation{CommitSHA: "abc", State: "pending"}
+	green := buildObservation{CommitSHA: "abc", State: "success"}
+
+	eligible, newly := newlyGreen(pending, "abc", "pending")
+	assert.False(t, eligible)
+	assert.False(t, newly)
+
+	eligible, newly = newlyGreen(pending, "abc", "success")
+	assert.True(t, eligible)
+	assert.True(t, newly)
+
+	eligible, newly = newlyGreen(green, "abc", "success")
+	assert.True(t, eligible)
+	assert.False(t, newly)
+
+	// a re-pushed commit hasn't been seen green before
+	eligible, newly = newlyGreen(green, "def", "success")
+	assert.True(t, eligible)
+	assert.True(t, newly)
+
+	eligible, newly = newlyGreen(buildObservation{}, "abc", "success")
+	assert.True(t, eligible)
+	assert.True(t, newly)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// orgMergeLimits caps how many merges are in flight at once in each org, see --max-in-flight-per-org.
+// It's on top of --concurrency and --throttle, so a batch across several orgs proceeds in parallel across orgs
+// while staying gentle on each org's webhooks and CI.
+type orgMergeLimits struct {
+	sync.Mutex
+	max  int
+	sems map[string]*semaphore.Weighted
+}
+
+// acquire waits for a slot in the org, returning a func that releases it. Orgs aren't capped if max isn't set.
+func (l *orgMergeLimits) acquire(ctx context.Context, org string) (func(), error) {
+	if l.max <= 0 {
+		return func() {}, nil
+	}
+	org = strings.ToLower(org)
+	l.Lock()
+	sem, ok := l.sems[org]
+	if !ok {
+		sem = semaphore.NewWeighted(int64(l.max))
+		l.sems[org] = sem
+	}
+	l.Unlock()
+	if err := sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	return func() { sem.Release(1) }, nil
+}
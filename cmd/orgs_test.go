@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestOrgMergeLimits(t *testing.T) {
+	limits := &orgMergeLimits{max: 1, sems: map[string]*semaphore.Weighted{}}
+	release, err := limits.acquire(context.Background(), "Clever")
+	assert.NoError(t, err)
+
+	// Other orgs aren't held up
+	releaseOther, err := limits.acquire(context.Background(), "Line-Noise")
+	assert.NoError(t, err)
+	releaseOther()
+
+	// The same org, in any case, waits for the slot
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = limits.acquire(ctx, "clever")
+	assert.Error(t, err)
+
+	release()
+	releaseAgain, err := limits.acquire(context.Background(), "clever")
+	assert.NoError(t, err)
+	releaseAgain()
+}
+
+func TestOrgMergeLimitsUncapped(t *testing.T) {
+	limits := &orgMergeLimits{sems: map[string]*semaphore.Weighted{}}
+	for i := 0; i < 3; i++ {
+		_, err := limits.acquire(context.Background(), "Clever")
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+
+	"github.com/Clever/microplane/clone"
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/verbosity"
+)
+
+// repoOverride are per-repo settings that take precedence over the command line flags,
+// for repos that need special handling. They're read from overrides.json in the workdir, e.g.
+//
+//	{
+//	  "Clever/microplane": {"BaseBranch": "main", "Reviewers": ["alice"], "MergeMethod": "squash"},
+//	  "Clever/legacy-app": {"Skip": true}
+//	}
+type repoOverride struct {
+	// BaseBranch is the branch the PR is opened against
+	BaseBranch string
+	// Reviewers are requested to review the PR
+	Reviewers []string
+	// Labels are added to the PR
+	Labels []string
+	// MergeMethod overrides --merge-method
+	MergeMethod string
+	// IgnoreBuildStatus and IgnoreReviewApproval skip merge gates, like the flags of the same name
+	IgnoreBuildStatus    bool
+	IgnoreReviewApproval bool
+	// DeleteBranch overrides --no-delete-branch, e.g. false to keep a release branch after merging
+	DeleteBranch *bool
+	// Team owns the repo, for --max-merges-per-team. Defaults to the repo's CODEOWNERS
+	Team string
+	// Skip leaves the repo out of clone, plan, push and merge
+	Skip bool
+}
+
+// overrides are keyed by "{org}/{repo}"
+var overrides = map[string]repoOverride{}
+
+func overridesPath() string {
+	return path.Join(workDir, "overrides.json")
+}
+
+// loadOverrides reads the overrides file, if there is one
+func loadOverrides() {
+	if err := loadJSON(overridesPath(), &overrides); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("error loading %s: %s", overridesPath(), err.Error())
+	}
+}
+
+func overrideFor(r initialize.Repo) repoOverride {
+	return overrides[fmt.Sprintf("%s/%s", r.Owner, r.Name)]
+}
+
+// withoutSkipped filters out repos that are skipped in the overrides file
+func withoutSkipped(repos []initialize.Repo) []initialize.Repo {
+	selected := []initialize.Repo{}
+	for _, r := range repos {
+		if overrideFor(r).Skip {
+			verbosity.Printf("%s/%s - skipping, per %s", r.Owner, r.Name, overridesPath())
+			continue
+		}
+		selected = append(selected, r)
+	}
+	return selected
+}
+
+// deleteBranchFor determines whether a repo's branch is deleted after merging,
+// from the DeleteBranch override if set, otherwise --no-delete-branch
+func deleteBranchFor(r initialize.Repo) bool {
+	if o := overrideFor(r); o.DeleteBranch != nil {
+		return *o.DeleteBranch
+	}
+	return !mergeFlagNoDeleteBranch
+}
+
+// baseBranchFor determines the branch a repo's change is based off, and its PR opened against
+// - the BaseBranch override, if set
+// - the branch checked out when cloning, if any
+// - the repo's default branch when it was cloned, if known
+// - push.DefaultBaseBranch otherwise
+func baseBranchFor(r initialize.Repo) string {
+	if o := overrideFor(r); o.BaseBranch != "" {
+		return o.BaseBranch
+	}
+	var cloneOutput clone.Output
+	if loadJSON(outputPath(r.Name, "clone"), &cloneOutput) == nil {
+		if cloneOutput.RefIsBranch {
+			return cloneOutput.Ref
+		}
+		if cloneOutput.DefaultBranch != "" {
+			return cloneOutput.DefaultBranch
+		}
+	}
+	return push.DefaultBaseBranch
+}
+
+// liveBaseBranch is baseBranchFor, but re-resolves the repo's default branch from the API,
+// in case it's been renamed since cloning, e.g. by a master -> main campaign
+func liveBaseBranch(ctx context.Context, r initialize.Repo) string {
+	base := baseBranchFor(r)
+	var cloneOutput clone.Output
+	if overrideFor(r).BaseBranch != "" || loadJSON(outputPath(r.Name, "clone"), &cloneOutput) != nil || cloneOutput.RefIsBranch {
+		return base
+	}
+	live, err := clone.DefaultBranch(ctx, r.Provider, r.Owner, r.Name, repoLimiter)
+	if err != nil || live == "" {
+		if err != nil {
+			log.Printf("WARNING: %s/%s - error finding the default branch, using %s: %s", r.Owner, r.Name, base, err.Error())
+		}
+		return base
+	}
+	if live != base {
+		log.Printf("WARNING: %s/%s - the default branch is now %s, it was %s when cloned", r.Owner, r.Name, live, base)
+	}
+	return live
+}
+
+// pushedBaseBranch is the branch a repo's PR was opened against, falling back to baseBranchFor for older state
+func pushedBaseBranch(r initialize.Repo) string {
+	var pushOutput push.Output
+	if loadJSON(outputPath(r.Name, "push"), &pushOutput) == nil && pushOutput.BaseBranch != "" {
+		return pushOutput.BaseBranch
+	}
+	return baseBranchFor(r)
+}
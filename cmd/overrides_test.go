@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Clever/microplane/clone"
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/push"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-overrides")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(d string) { workDir = d }(workDir)
+	defer func(o map[string]repoOverride) { overrides = o }(overrides)
+	defer func(noDelete bool) { mergeFlagNoDeleteBranch = noDelete }(mergeFlagNoDeleteBranch)
+	workDir = dir
+	overrides = map[string]repoOverride{}
+	mergeFlagNoDeleteBranch = false
+
+	assert.NoError(t, ioutil.WriteFile(overridesPath(), []byte(`{
+		"Clever/main": {"BaseBranch": "main", "DeleteBranch": false},
+		"Clever/legacy": {"Skip": true}
+	}`), 0644))
+	loadOverrides()
+
+	overridden := initialize.Repo{Owner: "Clever", Name: "main"}
+	skipped := initialize.Repo{Owner: "Clever", Name: "legacy"}
+	cloned := initialize.Repo{Owner: "Clever", Name: "cloned"}
+	plain := initialize.Repo{Owner: "Clever", Name: "plain"}
+	assert.NoError(t, os.MkdirAll(filepath.Dir(outputPath(cloned.Name, "clone")), 0755))
+	assert.NoError(t, writeJSON(clone.Output{DefaultBranch: "trunk"}, outputPath(cloned.Name, "clone")))
+
+	assert.Equal(t, []initialize.Repo{overridden, plain}, withoutSkipped([]initialize.Repo{overridden, skipped, plain}))
+	assert.Equal(t, "main", baseBranchFor(overridden))
+	assert.Equal(t, "trunk", baseBranchFor(cloned))
+	assert.Equal(t, push.DefaultBaseBranch, baseBranchFor(plain))
+	assert.False(t, deleteBranchFor(overridden))
+	assert.True(t, deleteBranchFor(plain))
+}
@@ -6,17 +6,42 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"text/tabwriter"
 
 	"github.com/Clever/microplane/clone"
 	"github.com/Clever/microplane/initialize"
 	"github.com/Clever/microplane/merge"
 	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/verbosity"
 	"github.com/spf13/cobra"
 )
 
 var planFlagBranch string
 var planFlagMessage string
+var planFlagCopy []string
+var planFlagPatch string
+var planFlagPreview bool
+var planFlagEnvFile string
+var planFlagShell string
+var planFlagCmds []string
+var planFlagContinueOnError bool
+var planFlagWhen string
+var planFlagWhenFileExists []string
+var planFlagWhenGrep []string
+var planFlagWorkdir string
+var planFlagCIConfig []string
+var planFlagRequireCIConfig bool
+var planFlagIsolated bool
+
+// planEnv is loaded from --env-file
+var planEnv []string
+
+// planWhen are the --when predicates a repo must match to be planned
+var planWhen []plan.Predicate
 
 // TODO: Pass these *not* via globals
 // these variables are set when the cmd starts running
@@ -25,28 +50,76 @@ var (
 	commitMessage string
 	changeCmd     string
 	changeCmdArgs []string
-	isSingleRepo  bool
+	// changeCmds are the --cmd pipeline, run instead of changeCmd
+	changeCmds   []plan.Command
+	isSingleRepo bool
 )
 
 var planCmd = &cobra.Command{
 	Use:   "plan [cmd] [args...]",
-	Args:  cobra.MinimumNArgs(1),
+	Args:  cobra.ArbitraryArgs,
 	Short: "Plan changes by running a command against cloned repos",
 	Example: `mp plan -b microplaning -m 'microplane fun' -r app-service -- sh -c /absolute/path/to/script
-mp plan -b microplaning -m 'microplane fun' -r app-service -- python /absolute/path/to/script`,
+mp plan -b microplaning -m 'microplane fun' -r app-service -- python /absolute/path/to/script
+mp plan -b microplaning -m 'microplane fun' --shell bash -- 'set -o pipefail; /absolute/path/to/script | tee /tmp/log'
+mp plan -b microplaning -m 'microplane fun' --cmd 'go run ./codemod' --cmd 'gofmt -w .' --cmd 'go mod tidy'
+mp plan -b microplaning -m 'microplane fun' --when-grep 'github.com/pkg/errors' -- /absolute/path/to/script
+mp plan -b microplaning -m 'microplane fun' --workdir packages/api -- npm install left-pad@latest
+mp plan -b microplaning -m 'microplane fun' --patch /path/to/change.patch`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
 
-		changeCmd = args[0]
-		if len(args) > 1 {
-			changeCmdArgs = args[1:]
+		if planFlagContinueOnError && len(planFlagCmds) == 0 {
+			log.Fatal("--continue-on-error only applies to --cmd")
+		}
+		if planFlagPatch != "" {
+			if len(args) > 0 || len(planFlagCmds) > 0 {
+				log.Fatal("--patch can't be used with a command")
+			}
+			// the patch is applied from within each repo, so needs an absolute path
+			planFlagPatch, err = filepath.Abs(planFlagPatch)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if _, err := os.Stat(planFlagPatch); err != nil {
+				log.Fatalf("error reading --patch: %s", err.Error())
+			}
+		} else if len(planFlagCmds) > 0 {
+			if len(args) > 0 {
+				log.Fatal("--cmd can't be used with a command argument")
+			}
+			shell := planFlagShell
+			if shell == "" {
+				shell = "auto"
+			}
+			for _, c := range planFlagCmds {
+				changeCmds = append(changeCmds, plan.ShellCommand(shell, []string{c}))
+			}
+		} else if len(args) == 0 {
+			log.Fatal("a command to run, --cmd, or --patch is required")
+		} else if planFlagShell != "" {
+			shellCmd := plan.ShellCommand(planFlagShell, args)
+			changeCmd, changeCmdArgs = shellCmd.Path, shellCmd.Args
+		} else {
+			changeCmd = args[0]
+			if len(args) > 1 {
+				changeCmdArgs = args[1:]
+			}
+		}
+
+		planWhen = whenPredicates()
+		if planFlagWorkdir != "" {
+			planFlagWorkdir = filepath.Clean(planFlagWorkdir)
+			if filepath.IsAbs(planFlagWorkdir) || planFlagWorkdir == ".." || strings.HasPrefix(planFlagWorkdir, "../") {
+				log.Fatal("--workdir must be a directory within each repo, relative to its root")
+			}
 		}
 
 		branchName, err = cmd.Flags().GetString("branch")
 		if err != nil {
 			log.Fatal(err)
 		}
-		if branchName == "" {
+		if branchName == "" && !planFlagPreview {
 			log.Fatal("--branch is required")
 		}
 
@@ -54,30 +127,52 @@ mp plan -b microplaning -m 'microplane fun' -r app-service -- python /absolute/p
 		if err != nil {
 			log.Fatal(err)
 		}
-		if commitMessage == "" {
+		if commitMessage == "" && !planFlagPreview {
 			log.Fatal("--message is required")
 		}
+		if commitMessage != "" {
+			commitMessage = push.WithRunID(commitMessage, campaignRunID())
+		}
+
+		if planFlagEnvFile != "" {
+			planEnv, err = plan.ParseEnvFile(planFlagEnvFile)
+			if err != nil {
+				log.Fatalf("error loading --env-file: %s", err.Error())
+			}
+			for _, kv := range planEnv {
+				verbosity.Printf("--env-file sets %s", strings.SplitN(kv, "=", 2)[0])
+			}
+		}
 
 		repos, err := whichRepos(cmd)
 		if err != nil {
 			log.Fatal(err)
 		}
+		repos = withoutSkipped(repos)
+
+		if planFlagPreview {
+			if err := previewRepos(repos); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
 		isSingleRepo = len(repos) == 1
 
-		err = parallelize(repos, planOneRepo)
+		err = parallelize(repos, trackProgress("plan", planOneRepo))
 		if err != nil {
-			log.Fatalf("%d errors:\n %+v\n", strings.Count(err.Error(), " | ")+1, err)
+			endRun(err)
+			log.Fatal(batchError("plan", err))
 		}
 	},
 }
 
 func planOneRepo(r initialize.Repo, ctx context.Context) error {
-	log.Printf("planning: %s/%s", r.Owner, r.Name)
+	verbosity.Printf("planning: %s/%s", r.Owner, r.Name)
 
 	// Get previous step's output
 	var cloneOutput clone.Output
 	if loadJSON(outputPath(r.Name, "clone"), &cloneOutput) != nil || !cloneOutput.Success {
-		log.Printf("skipping %s/%s, must successfully clone first", r.Owner, r.Name)
+		verbosity.Printf("skipping %s/%s, must successfully clone first", r.Owner, r.Name)
 		return nil
 	}
 
@@ -87,7 +182,7 @@ func planOneRepo(r initialize.Repo, ctx context.Context) error {
 		Error string
 	}
 	if loadJSON(outputPath(r.Name, "merge"), &mergeOutput) == nil && mergeOutput.Success {
-		log.Printf("%s/%s - already merged", r.Owner, r.Name)
+		verbosity.Printf("%s/%s - already merged", r.Owner, r.Name)
 		return nil
 	}
 
@@ -99,15 +194,31 @@ func planOneRepo(r initialize.Repo, ctx context.Context) error {
 	}
 
 	// Execute
-	input := plan.Input{
-		RepoName:      r.Name,
-		RepoDir:       cloneOutput.ClonedIntoDir,
-		WorkDir:       planWorkDir,
-		Command:       plan.Command{Path: changeCmd, Args: changeCmdArgs},
-		CommitMessage: commitMessage,
-		BranchName:    branchName,
+	input := planInput(r, cloneOutput)
+	input.WorkDir = planWorkDir
+	// lay out the copy like the clone, so that e.g. a Go repo's import path matches its directory
+	planDir, err := layoutDir(cloneOutput.Layout, r, "planned")
+	if err != nil {
+		return err
+	}
+	input.PlanDir = planDir
+	if input.LayoutPath, err = layoutPath(cloneOutput.Layout, r); err != nil {
+		return err
 	}
 	output, err := plan.Plan(ctx, input)
+	if cloneOutput.Shallow && clone.IsHistoryError(err) {
+		// the change needed history that the shallow clone doesn't have, e.g. for git log
+		verbosity.Printf("%s/%s - plan failed for lack of history on a shallow clone, fetching full history and retrying", r.Owner, r.Name)
+		if deepenErr := deepenClone(ctx, r, cloneOutput); deepenErr != nil {
+			log.Printf("WARNING: %s/%s - %s", r.Owner, r.Name, deepenErr.Error())
+		} else {
+			output, err = plan.Plan(ctx, input)
+		}
+	}
+	if err == nil && output.SkippedBy != "" {
+		verbosity.Printf("%s/%s - skipped, didn't match %s", r.Owner, r.Name, output.SkippedBy)
+		return writeJSON(output, planOutputPath)
+	}
 	if err != nil {
 		o := struct {
 			plan.Output
@@ -116,9 +227,131 @@ func planOneRepo(r initialize.Repo, ctx context.Context) error {
 		writeJSON(o, planOutputPath)
 		return fmt.Errorf("%s/%s error: %+v", r.Owner, r.Name, err)
 	}
+	for _, failed := range output.FailedCommands {
+		log.Printf("WARNING: %s/%s - command %s failed, continued anyway", r.Owner, r.Name, failed)
+	}
+	if output.NoCIConfig {
+		log.Printf("WARNING: %s/%s - no CI config found, so CI won't validate the change. Use --require-ci-config to skip repos without CI", r.Owner, r.Name)
+	}
 	writeJSON(output, planOutputPath)
 	if isSingleRepo {
 		fmt.Println(output.GitDiff)
 	}
 	return nil
 }
+
+// whenPredicates builds the predicates that decide which repos to change, from --when, --when-file-exists
+// and --when-grep. The cheap file checks go first.
+func whenPredicates() []plan.Predicate {
+	predicates := []plan.Predicate{}
+	for _, f := range planFlagWhenFileExists {
+		predicates = append(predicates, plan.Predicate{FileExists: f})
+	}
+	for _, g := range planFlagWhenGrep {
+		predicates = append(predicates, plan.Predicate{Grep: g})
+	}
+	if planFlagWhen != "" {
+		shell := planFlagShell
+		if shell == "" {
+			shell = "auto"
+		}
+		when := plan.ShellCommand(shell, []string{planFlagWhen})
+		predicates = append(predicates, plan.Predicate{Command: &when})
+	}
+	return predicates
+}
+
+// deepenClone fetches the full history of a shallow clone, recording that it was deepened in the clone state,
+// so that later runs don't retry
+func deepenClone(ctx context.Context, r initialize.Repo, cloneOutput clone.Output) error {
+	if err := clone.Unshallow(ctx, cloneOutput.ClonedIntoDir); err != nil {
+		return err
+	}
+	cloneOutput.Shallow = false
+	cloneOutput.Deepened = true
+	return writeJSON(cloneOutput, outputPath(r.Name, "clone"))
+}
+
+// planInput builds the input to plan a repo, from its clone output and the plan flags
+func planInput(r initialize.Repo, cloneOutput clone.Output) plan.Input {
+	return plan.Input{
+		RepoName:        r.Name,
+		RepoDir:         cloneOutput.ClonedIntoDir,
+		Command:         plan.Command{Path: changeCmd, Args: changeCmdArgs},
+		Commands:        changeCmds,
+		ContinueOnError: planFlagContinueOnError,
+		When:            planWhen,
+		Subdir:          planFlagWorkdir,
+		CIConfigPaths:   planFlagCIConfig,
+		RequireCIConfig: planFlagRequireCIConfig,
+		Isolated:        planFlagIsolated,
+		CommitMessage:   commitMessage,
+		BranchName:      branchName,
+		CopyPaths:       planFlagCopy,
+		PatchPath:       planFlagPatch,
+		Env:             planEnv,
+		Metadata: plan.Metadata{
+			Name:       r.Name,
+			Owner:      r.Owner,
+			CloneURL:   r.CloneURL,
+			Provider:   r.Provider,
+			Topics:     r.Topics,
+			Ref:        cloneOutput.Ref,
+			BaseBranch: baseBranchFor(r),
+		},
+	}
+}
+
+// previewRepos runs the change against a throwaway copy of each repo, and prints the diffstat it would make.
+// No state is saved, and the planned working trees are left as they were.
+func previewRepos(repos []initialize.Repo) error {
+	var mutex sync.Mutex
+	stats := map[string]plan.DiffStat{}
+	errored := 0
+	err := parallelize(repos, func(r initialize.Repo, ctx context.Context) error {
+		var cloneOutput clone.Output
+		if loadJSON(outputPath(r.Name, "clone"), &cloneOutput) != nil || !cloneOutput.Success {
+			verbosity.Printf("skipping %s/%s, must successfully clone first", r.Owner, r.Name)
+			return nil
+		}
+		stat, err := plan.Preview(ctx, planInput(r, cloneOutput))
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err != nil {
+			log.Printf("%s/%s - preview error: %s", r.Owner, r.Name, strings.TrimSpace(err.Error()))
+			errored++
+			return nil
+		}
+		stats[fmt.Sprintf("%s/%s", r.Owner, r.Name)] = stat
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	total := plan.DiffStat{}
+	changed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		stat := stats[name]
+		if stat.FilesChanged == 0 {
+			continue
+		}
+		changed++
+		total.FilesChanged += stat.FilesChanged
+		total.Insertions += stat.Insertions
+		total.Deletions += stat.Deletions
+		fmt.Fprintf(w, "%s\t%s\n", name, stat)
+	}
+	w.Flush()
+	fmt.Printf("\n%d of %d repos would change: %s\n", changed, len(stats), total)
+	if errored > 0 {
+		fmt.Printf("%d repos failed to preview\n", errored)
+	}
+	return nil
+}
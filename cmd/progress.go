@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/tracing"
+)
+
+// progressMarker is written while a step is working on a repo, so that a concurrent `status` can show it
+type progressMarker struct {
+	StartedAt time.Time
+}
+
+func progressPath(repoName, step string) string {
+	return path.Join(workDir, repoName, step, step+".inprogress")
+}
+
+// trackProgress wraps a step's per-repo function, marking the repo as in progress while it runs,
+// and recording its outcome in the metrics and, if it failed, for the summary, see printFailures.
+// A failure that will be retried isn't an outcome yet.
+func trackProgress(step string, f func(initialize.Repo, context.Context) error) func(initialize.Repo, context.Context) error {
+	return func(r initialize.Repo, ctx context.Context) error {
+		p := progressPath(r.Name, step)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err == nil {
+			writeJSON(progressMarker{StartedAt: time.Now()}, p)
+		}
+		defer os.Remove(p)
+		ctx, span := tracing.Start(ctx, step+" "+r.Name)
+		span.SetAttribute("org", r.Owner)
+		span.SetAttribute("repo", r.Name)
+		defer span.End()
+		err := f(r, ctx)
+		span.SetError(err)
+		if willRequeue(ctx, err) {
+			// not the repo's outcome yet, see parallelizeN
+			return err
+		}
+		recordOutcome(step, r, err)
+		if err != nil {
+			runFailures.record(r, err)
+		}
+		return err
+	}
+}
+
+// stepVerbs describe a step that's in progress
+var stepVerbs = map[string]string{
+	"clone": "cloning",
+	"plan":  "planning",
+	"push":  "pushing",
+	"merge": "merging",
+}
+
+// activeStep returns the step currently working on a repo, if any. Markers are only trusted while another
+// process holds the workdir lock, since a crashed run leaves its markers behind.
+func activeStep(repoName string, locked bool) (string, progressMarker) {
+	var marker progressMarker
+	if !locked {
+		return "", marker
+	}
+	for _, step := range []string{"merge", "push", "plan", "clone"} {
+		if loadJSON(progressPath(repoName, step), &marker) == nil {
+			return step, marker
+		}
+	}
+	return "", marker
+}
+
+// workDirLocked returns whether another microplane process holds the workdir lock, see lockWorkDir
+func workDirLocked() bool {
+	f, err := os.Open(path.Join(workDir, ".lock"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		return true
+	}
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return false
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/verbosity"
+	"github.com/spf13/cobra"
+)
+
+var pruneFlagYes bool
+
+// stateSteps are the per-repo state directories, which identify a directory in the workdir as a repo's state
+var stateSteps = []string{"clone", "plan", "push", "merge"}
+
+var pruneStateCmd = &cobra.Command{
+	Use:   "prune-state",
+	Short: "Prune state removes the state of repos that are no longer targeted",
+	Long: `Prune state removes the state of repos that are no longer targeted, e.g. after re-running init
+with tighter filters, so that they don't clutter status and report. Repos still targeted by init are never touched.
+It lists what it would remove and asks for confirmation, unless --yes is set.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var initOutput initialize.Output
+		if err := loadJSON(outputPath("", "init"), &initOutput); err != nil {
+			log.Fatalf("must run init first: %s", err.Error())
+		}
+
+		stale, err := staleRepoDirs(workDir, initOutput.Repos)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(stale) == 0 {
+			verbosity.Printf("no state to prune")
+			return
+		}
+		fmt.Printf("state of %d repo(s) no longer targeted:\n", len(stale))
+		for _, name := range stale {
+			fmt.Printf("  %s\n", name)
+		}
+		if !pruneFlagYes && !confirm("remove it?") {
+			log.Fatal("aborted, nothing was removed")
+		}
+		for _, name := range stale {
+			if err := os.RemoveAll(filepath.Join(workDir, name)); err != nil {
+				log.Fatalf("error removing state of %s: %s", name, err.Error())
+			}
+		}
+		verbosity.Printf("pruned state of %d repo(s)", len(stale))
+	},
+}
+
+// staleRepoDirs returns the directories in the workdir with a repo's state, for repos that aren't targeted.
+// Directories without any step's state, e.g. ones a user created, are left alone.
+func staleRepoDirs(dir string, targeted []initialize.Repo) ([]string, error) {
+	keep := map[string]bool{}
+	for _, r := range targeted {
+		keep[r.Name] = true
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	stale := []string{}
+	for _, e := range entries {
+		if !e.IsDir() || keep[e.Name()] || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		for _, step := range stateSteps {
+			if info, err := os.Stat(filepath.Join(dir, e.Name(), step)); err == nil && info.IsDir() {
+				stale = append(stale, e.Name())
+				break
+			}
+		}
+	}
+	return stale, nil
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
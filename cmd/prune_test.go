@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaleRepoDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-prune")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, p := range []string{"kept/clone", "archived/clone", "archived/plan", "dropped/merge", "notes", ".hidden/clone"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, p), 0755))
+	}
+
+	stale, err := staleRepoDirs(dir, []initialize.Repo{{Name: "kept"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"archived", "dropped"}, stale)
+}
@@ -2,16 +2,23 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
 	"time"
 
+	"github.com/Clever/microplane/clone"
 	"github.com/Clever/microplane/initialize"
 	"github.com/Clever/microplane/merge"
 	"github.com/Clever/microplane/plan"
 	"github.com/Clever/microplane/push"
+	"github.com/Clever/microplane/verbosity"
 	"github.com/spf13/cobra"
 )
 
@@ -19,12 +26,26 @@ import (
 var pushFlagAssignee string
 var pushFlagThrottle string
 var pushFlagBodyFile string
+var pushFlagMaxFilesChanged int
+var pushFlagForce bool
+var pushFlagSplitBy string
+var pushFlagSplitManifest string
+var pushFlagDryRun bool
+var pushFlagCommitMessageFile string
+var pushFlagSupersedePrefix string
+var pushFlagDirect bool
+var pushFlagPushMirror bool
+
+// pushSplitManifest maps group names to path prefixes, see --split-manifest
+var pushSplitManifest map[string][]string
 
 // rate limits the # of git pushes. used to prevent load on CI system
 var pushThrottle *time.Ticker
 
 var prAssignee string
-var prBody string
+var pushRunID string
+var prBodyTemplate *template.Template
+var commitMessageTemplate *template.Template
 
 var pushCmd = &cobra.Command{
 	Use:   "push",
@@ -39,6 +60,7 @@ var pushCmd = &cobra.Command{
 		if prAssignee == "" {
 			log.Fatal("--assignee is required")
 		}
+		pushRunID = campaignRunID()
 
 		prBodyFile, err := cmd.Flags().GetString("body-file")
 		if err != nil {
@@ -49,7 +71,38 @@ var pushCmd = &cobra.Command{
 			if err != nil {
 				log.Fatal(err)
 			}
-			prBody = string(prBodyBytes)
+			// The body file is a template, rendered separately for each repo
+			prBodyTemplate, err = push.NewTemplate(filepath.Base(prBodyFile), string(prBodyBytes))
+			if err != nil {
+				log.Fatalf("error parsing --body-file: %s", err.Error())
+			}
+		}
+
+		if pushFlagCommitMessageFile != "" {
+			commitMessageBytes, err := ioutil.ReadFile(pushFlagCommitMessageFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			commitMessageTemplate, err = push.NewTemplate(filepath.Base(pushFlagCommitMessageFile), string(commitMessageBytes))
+			if err != nil {
+				log.Fatalf("error parsing --commit-message-file: %s", err.Error())
+			}
+		}
+
+		if pushFlagSplitManifest != "" {
+			pushFlagSplitBy = "manifest"
+			if err := loadJSON(pushFlagSplitManifest, &pushSplitManifest); err != nil {
+				log.Fatalf("error loading --split-manifest: %s", err.Error())
+			}
+		}
+		if pushFlagSplitBy != "" && pushFlagSplitBy != "dir" && pushFlagSplitBy != "manifest" {
+			log.Fatalf("invalid --split-by %s, must be 'dir' or 'manifest'", pushFlagSplitBy)
+		}
+		if pushFlagSplitBy == "manifest" && pushFlagSplitManifest == "" {
+			log.Fatal("--split-by manifest needs the manifest, pass it with --split-manifest")
+		}
+		if pushFlagDirect && pushFlagSplitBy != "" {
+			log.Fatal("--direct can't be used with --split-by, since it doesn't open PRs")
 		}
 
 		throttle, err := cmd.Flags().GetString("throttle")
@@ -62,18 +115,19 @@ var pushCmd = &cobra.Command{
 			if err != nil {
 				log.Fatalf("Error parsing --throttle flag: %s", err.Error())
 			}
-			pushThrottle = time.NewTicker(dur)
+			pushThrottle = throttleTicker(dur)
 		}
 
 		repos, err := whichRepos(cmd)
 		if err != nil {
 			log.Fatal(err)
 		}
+		repos = withoutSkipped(repos)
 
-		err = parallelize(repos, pushOneRepo)
+		err = parallelize(repos, trackProgress("push", pushOneRepo))
 		if err != nil {
-			// TODO: dig into errors and display them with more detail
-			log.Fatal(err)
+			endRun(err)
+			log.Fatal(batchError("push", err))
 		}
 
 		// TODO: Fix this, doesn't play well with parallelize fn
@@ -84,7 +138,7 @@ var pushCmd = &cobra.Command{
 }
 
 func pushOneRepo(r initialize.Repo, ctx context.Context) error {
-	log.Printf("pushing: %s/%s", r.Owner, r.Name)
+	verbosity.Printf("pushing: %s/%s", r.Owner, r.Name)
 
 	// Exit early if already merged
 	var mergeOutput struct {
@@ -92,14 +146,18 @@ func pushOneRepo(r initialize.Repo, ctx context.Context) error {
 		Error string
 	}
 	if loadJSON(outputPath(r.Name, "merge"), &mergeOutput) == nil && mergeOutput.Success {
-		log.Printf("%s/%s - already merged", r.Owner, r.Name)
+		verbosity.Printf("%s/%s - already merged", r.Owner, r.Name)
 		return nil
 	}
 
 	// Get previous step's output
 	var planOutput plan.Output
 	if loadJSON(outputPath(r.Name, "plan"), &planOutput) != nil || !planOutput.Success {
-		log.Printf("skipping %s/%s, must successfully plan first", r.Owner, r.Name)
+		if planOutput.SkippedBy != "" {
+			verbosity.Printf("skipping %s/%s, plan skipped it: didn't match %s", r.Owner, r.Name, planOutput.SkippedBy)
+		} else {
+			verbosity.Printf("skipping %s/%s, must successfully plan first", r.Owner, r.Name)
+		}
 		return nil
 	}
 
@@ -110,23 +168,93 @@ func pushOneRepo(r initialize.Repo, ctx context.Context) error {
 		return err
 	}
 
+	// Default branches vary across a fleet and get renamed, so the repo's current one is looked up
+	baseBranch := liveBaseBranch(ctx, r)
+
+	// Guard against change scripts that went haywire
+	if diffStat := plan.ParseDiffStat(planOutput.GitDiff); pushFlagMaxFilesChanged > 0 && diffStat.FilesChanged > pushFlagMaxFilesChanged && !pushFlagForce {
+		err := fmt.Errorf("needs review: %d files changed, which exceeds --max-files-changed=%d. Use --force to push anyway", diffStat.FilesChanged, pushFlagMaxFilesChanged)
+		o := struct {
+			push.Output
+			Error string
+		}{push.Output{Success: false}, err.Error()}
+		writeJSON(o, pushOutputPath)
+		return fmt.Errorf("%s/%s %s", r.Owner, r.Name, err.Error())
+	}
+
+	templateData := push.TemplateData{
+		Repo:          r.Name,
+		Org:           r.Owner,
+		DefaultBranch: baseBranch,
+		BranchName:    planOutput.BranchName,
+		CommitMessage: planOutput.CommitMessage,
+		Diff:          planOutput.GitDiff,
+	}
+
+	commitMessage := planOutput.CommitMessage
+	if commitMessageTemplate != nil {
+		var err error
+		commitMessage, err = push.RenderTemplate(commitMessageTemplate, templateData)
+		commitMessage = push.WithRunID(commitMessage, pushRunID)
+		if err == nil && !pushFlagDryRun {
+			err = push.RewordCommit(ctx, planOutput.PlanDir, commitMessage)
+		}
+		if err != nil {
+			err = fmt.Errorf("error applying --commit-message-file: %s", err.Error())
+			o := struct {
+				push.Output
+				Error string
+			}{push.Output{Success: false}, err.Error()}
+			writeJSON(o, pushOutputPath)
+			return fmt.Errorf("%s/%s %s", r.Owner, r.Name, err.Error())
+		}
+	}
+
+	prBody := ""
+	if prBodyTemplate != nil {
+		var err error
+		prBody, err = push.RenderTemplate(prBodyTemplate, templateData)
+		if err != nil {
+			err = fmt.Errorf("error rendering --body-file: %s", err.Error())
+			o := struct {
+				push.Output
+				Error string
+			}{push.Output{Success: false}, err.Error()}
+			writeJSON(o, pushOutputPath)
+			return fmt.Errorf("%s/%s %s", r.Owner, r.Name, err.Error())
+		}
+		prBody = push.WithRunID(prBody, pushRunID)
+	}
+
 	// Execute
 	input := push.Input{
-		RepoName:      r.Name,
-		PlanDir:       planOutput.PlanDir,
-		WorkDir:       pushWorkDir,
-		CommitMessage: planOutput.CommitMessage,
-		PRBody:        prBody,
-		PRAssignee:    prAssignee,
-		BranchName:    planOutput.BranchName,
-		RepoOwner:     r.Owner,
+		RepoName:        r.Name,
+		PlanDir:         planOutput.PlanDir,
+		WorkDir:         pushWorkDir,
+		CommitMessage:   commitMessage,
+		PRBody:          prBody,
+		PRAssignee:      prAssignee,
+		BranchName:      planOutput.BranchName,
+		BaseBranch:      baseBranch,
+		RepoOwner:       r.Owner,
+		Reviewers:       overrideFor(r).Reviewers,
+		Labels:          overrideFor(r).Labels,
+		SupersedePrefix: pushFlagSupersedePrefix,
+		Direct:          pushFlagDirect,
 	}
+	if pushFlagDryRun {
+		return dryRunPush(ctx, r, input)
+	}
+
 	var output push.Output
 	var err error
-	if r.Provider == "gitlab" {
-		output, err = push.GitlabPush(ctx, input, repoLimiter, pushThrottle)
-	} else if r.Provider == "github" {
-		output, err = push.GithubPush(ctx, input, repoLimiter, pushThrottle)
+	if pushFlagSplitBy != "" {
+		output, err = pushSplit(ctx, r, input)
+	} else {
+		output, err = pushWithProvider(ctx, r, input)
+	}
+	if err == nil && pushFlagPushMirror {
+		err = pushToMirror(ctx, r, input, &output)
 	}
 	if err != nil {
 		o := struct {
@@ -136,6 +264,160 @@ func pushOneRepo(r initialize.Repo, ctx context.Context) error {
 		writeJSON(o, pushOutputPath)
 		return err
 	}
+	if output.DirectCommit {
+		log.Printf("WARNING: %s/%s - committed directly to %s, bypassing review", r.Owner, r.Name, output.DirectBranch)
+	}
+	for _, n := range output.SupersededPRs {
+		verbosity.Printf("%s/%s - closed superseded PR #%d", r.Owner, r.Name, n)
+	}
+	if output.SupersedeError != "" {
+		log.Printf("WARNING: %s/%s - opened PR #%d, but %s", r.Owner, r.Name, output.PullRequestNumber, output.SupersedeError)
+	}
+	output.BaseBranch = baseBranch
 	writeJSON(output, pushOutputPath)
 	return nil
 }
+
+// pushToMirror pushes the change's branches to the mirror remote added by clone --mirror-remote,
+// recording the outcome of each. It fails if any branch couldn't be pushed, so that the push is retried.
+func pushToMirror(ctx context.Context, r initialize.Repo, input push.Input, output *push.Output) error {
+	var cloneOutput clone.Output
+	if loadJSON(outputPath(r.Name, "clone"), &cloneOutput) != nil || cloneOutput.MirrorURL == "" {
+		return fmt.Errorf("--push-mirror needs a mirror remote, clone with --mirror-remote first")
+	}
+	branches := map[string]string{input.BranchName: output.CommitSHA}
+	if len(output.SplitPRs) > 0 {
+		branches = map[string]string{}
+		for _, split := range output.SplitPRs {
+			branches[split.BranchName] = split.CommitSHA
+		}
+	}
+	if output.DirectCommit {
+		branches = map[string]string{output.DirectBranch: output.CommitSHA}
+	}
+
+	failed := []string{}
+	for name, sha := range branches {
+		result := push.PushToRemote(ctx, input.PlanDir, clone.MirrorRemote, sha, name)
+		output.Remotes = append(output.Remotes, result)
+		if !result.Success {
+			failed = append(failed, fmt.Sprintf("%s: %s", name, result.Error))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to push to %s: %s", cloneOutput.MirrorURL, strings.Join(failed, "; "))
+	}
+	verbosity.Printf("%s/%s - pushed %d branch(es) to %s", r.Owner, r.Name, len(branches), cloneOutput.MirrorURL)
+	return nil
+}
+
+func pushWithProvider(ctx context.Context, r initialize.Repo, input push.Input) (push.Output, error) {
+	if r.Provider == "gitlab" {
+		return push.GitlabPush(ctx, input, repoLimiter, pushThrottle)
+	}
+	if input.Direct {
+		return push.GithubPushDirect(ctx, input, repoLimiter, pushThrottle)
+	}
+	return push.GithubPush(ctx, input, repoLimiter, pushThrottle)
+}
+
+// pushSplit splits the planned change into groups of files, and opens a PR for each group
+func pushSplit(ctx context.Context, r initialize.Repo, input push.Input) (push.Output, error) {
+	files, err := push.ChangedFiles(ctx, input.PlanDir)
+	if err != nil {
+		return push.Output{Success: false}, err
+	}
+	var groups map[string][]push.FileChange
+	if pushFlagSplitBy == "manifest" {
+		groups = push.GroupByManifest(files, pushSplitManifest)
+	} else {
+		groups = push.GroupByTopLevelDir(files)
+	}
+	names := []string{}
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	output := push.Output{Success: true}
+	for i, name := range names {
+		// e.g. "microplane fun (api)"
+		msg := strings.SplitN(input.CommitMessage, "\n", 2)
+		msg[0] = fmt.Sprintf("%s (%s)", msg[0], name)
+		commitMessage := strings.Join(msg, "\n")
+
+		sha, err := push.SplitCommit(ctx, input.PlanDir, groups[name], commitMessage)
+		if err != nil {
+			return push.Output{Success: false, SplitPRs: output.SplitPRs}, fmt.Errorf("split %s: %s", name, err.Error())
+		}
+		splitInput := input
+		splitInput.BranchName = push.SplitBranchName(input.BranchName, name)
+		splitInput.CommitMessage = commitMessage
+		splitInput.Ref = sha
+		o, err := pushWithProvider(ctx, r, splitInput)
+		if err != nil {
+			return push.Output{Success: false, SplitPRs: output.SplitPRs}, fmt.Errorf("split %s: %s", name, err.Error())
+		}
+		verbosity.Printf("%s/%s - pushed split %s: %s", r.Owner, r.Name, name, o.PullRequestURL)
+
+		if i == 0 {
+			// the first PR is also used for the repo's overall status
+			output = o
+			output.SplitPRs = []push.SplitPR{}
+		}
+		output.SplitPRs = append(output.SplitPRs, push.SplitPR{
+			Group:             name,
+			BranchName:        splitInput.BranchName,
+			CommitSHA:         o.CommitSHA,
+			PullRequestURL:    o.PullRequestURL,
+			PullRequestNumber: o.PullRequestNumber,
+		})
+	}
+	return output, nil
+}
+
+// dryRunPush checks that the planned commit exists, and prints the PR that would be opened,
+// without pushing or opening anything. No state is saved, so a real push can follow.
+func dryRunPush(ctx context.Context, r initialize.Repo, input push.Input) error {
+	gitRevParse := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "HEAD")
+	gitRevParse.Dir = input.PlanDir
+	if output, err := gitRevParse.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s/%s - dry run: no planned commit: %s", r.Owner, r.Name, string(output))
+	}
+
+	heads := []string{input.BranchName}
+	if pushFlagSplitBy != "" {
+		files, err := push.ChangedFiles(ctx, input.PlanDir)
+		if err != nil {
+			return fmt.Errorf("%s/%s - dry run: %s", r.Owner, r.Name, err.Error())
+		}
+		groups := push.GroupByTopLevelDir(files)
+		if pushFlagSplitBy == "manifest" {
+			groups = push.GroupByManifest(files, pushSplitManifest)
+		}
+		heads = []string{}
+		for group := range groups {
+			heads = append(heads, push.SplitBranchName(input.BranchName, group))
+		}
+		sort.Strings(heads)
+	}
+
+	title, body := push.PRTitleAndBody(input)
+	base := input.BaseBranch
+	if base == "" {
+		base = push.DefaultBaseBranch
+	}
+	if input.Direct {
+		fmt.Printf("%s/%s - dry run, would commit directly to %s without a PR: %s\n", r.Owner, r.Name, base, title)
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s/%s - dry run, would open PR:\n", r.Owner, r.Name)
+	fmt.Fprintf(&b, "  title: %s\n", title)
+	fmt.Fprintf(&b, "  base:  %s\n", base)
+	fmt.Fprintf(&b, "  head:  %s\n", strings.Join(heads, ", "))
+	fmt.Fprintf(&b, "  assignee: %s\n", input.PRAssignee)
+	fmt.Fprintf(&b, "  body:\n    %s\n", strings.Replace(strings.TrimSpace(body), "\n", "\n    ", -1))
+	fmt.Print(b.String())
+	return nil
+}
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/clone"
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/merge"
+	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/push"
+	"github.com/spf13/cobra"
+)
+
+var reportFlagFormat string
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report summarizes a workflow's outcome, e.g. for sharing with stakeholders",
+	Args:  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		if reportFlagFormat != "markdown" {
+			log.Fatalf("unsupported --format %s, must be one of: markdown", reportFlagFormat)
+		}
+
+		repos, err := whichRepos(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		reports := []repoReport{}
+		for _, r := range repos {
+			reports = append(reports, getRepoReport(r))
+		}
+		writeMarkdownReport(os.Stdout, reports)
+	},
+}
+
+// repoReport is the outcome of each step for a single repo
+type repoReport struct {
+	Repo   initialize.Repo
+	Status string
+	Error  string
+	Clone  clone.Output
+	Plan   plan.Output
+	Push   push.Output
+	Merge  merge.Output
+}
+
+func getRepoReport(r initialize.Repo) repoReport {
+	report := repoReport{Repo: r, Status: "initialized"}
+
+	var cloneOutput struct {
+		clone.Output
+		Error string
+	}
+	if !(loadJSON(outputPath(r.Name, "clone"), &cloneOutput) == nil && cloneOutput.Success) {
+		report.Error = cloneOutput.Error
+		return report
+	}
+	report.Status = "cloned"
+	report.Clone = cloneOutput.Output
+
+	var planOutput struct {
+		plan.Output
+		Error string
+	}
+	if !(loadJSON(outputPath(r.Name, "plan"), &planOutput) == nil && planOutput.Success) {
+		report.Error = planOutput.Error
+		return report
+	}
+	report.Status = "planned"
+	report.Plan = planOutput.Output
+
+	var pushOutput struct {
+		push.Output
+		Error string
+	}
+	if !(loadJSON(outputPath(r.Name, "push"), &pushOutput) == nil && pushOutput.Success) {
+		report.Error = pushOutput.Error
+		return report
+	}
+	report.Status = "pushed"
+	report.Push = pushOutput.Output
+
+	var mergeOutput struct {
+		merge.Output
+		Error string
+	}
+	if !(loadJSON(outputPath(r.Name, "merge"), &mergeOutput) == nil && mergeOutput.Success) {
+		report.Error = mergeOutput.Error
+		return report
+	}
+	report.Status = "merged"
+	report.Merge = mergeOutput.Output
+	return report
+}
+
+// markdownReplacer escapes the characters that would end a table cell or be read as formatting
+var markdownReplacer = strings.NewReplacer(`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`)
+
+// markdownEscape escapes text for use within a markdown table cell
+func markdownEscape(s string) string {
+	return markdownReplacer.Replace(strings.Join(strings.Fields(s), " "))
+}
+
+// markdownRepo is a repo's org/name, escaped for a markdown table cell
+func markdownRepo(r initialize.Repo) string {
+	return markdownEscape(r.Owner + "/" + r.Name)
+}
+
+func writeMarkdownReport(w io.Writer, reports []repoReport) {
+	steps := []string{"initialized", "cloned", "planned", "pushed", "merged"}
+	counts := map[string]int{}
+	errored := []repoReport{}
+	for _, r := range reports {
+		counts[r.Status]++
+		if r.Error != "" {
+			errored = append(errored, r)
+		}
+	}
+
+	fmt.Fprintf(w, "# Microplane Report\n\n")
+	fmt.Fprintf(w, "## Summary\n\n")
+	fmt.Fprintf(w, "Total repos: %d\n\n", len(reports))
+	fmt.Fprintf(w, "| Status | Repos |\n")
+	fmt.Fprintf(w, "| --- | --- |\n")
+	for _, step := range steps {
+		fmt.Fprintf(w, "| %s | %d |\n", step, counts[step])
+	}
+	fmt.Fprintf(w, "| errored | %d |\n\n", len(errored))
+
+	if merged := mergedDiffStat(reports); counts["merged"] > 0 {
+		fmt.Fprintf(w, "This campaign changed %d file(s) across %d repo(s): %d insertion(s)(+), %d deletion(s)(-)\n\n",
+			merged.FilesChanged, counts["merged"], merged.Insertions, merged.Deletions)
+	}
+
+	fmt.Fprintf(w, "## Pull Requests\n\n")
+	fmt.Fprintf(w, "| Repo | Pull Request | Build | Merge Status | Merged By | Merged At |\n")
+	fmt.Fprintf(w, "| --- | --- | --- | --- | --- | --- |\n")
+	for _, r := range reports {
+		if r.Push.PullRequestURL == "" {
+			continue
+		}
+		mergeStatus := "open"
+		if r.Status == "merged" {
+			mergeStatus = "merged"
+			if r.Merge.MergeCommitSHA != "" {
+				mergeStatus = fmt.Sprintf("merged (%s)", r.Merge.MergeCommitSHA)
+			}
+		}
+		mergedAt := ""
+		if !r.Merge.MergedAt.IsZero() {
+			mergedAt = r.Merge.MergedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "| %s | [#%d](%s) | %s | %s | %s | %s |\n", markdownRepo(r.Repo),
+			r.Push.PullRequestNumber, r.Push.PullRequestURL, r.Push.PullRequestCombinedStatus, mergeStatus,
+			markdownEscape(r.Merge.MergedBy), mergedAt)
+	}
+	fmt.Fprintln(w)
+
+	if len(errored) > 0 {
+		fmt.Fprintf(w, "## Errors\n\n")
+		fmt.Fprintf(w, "| Repo | Status | Error |\n")
+		fmt.Fprintf(w, "| --- | --- | --- |\n")
+		for _, r := range errored {
+			fmt.Fprintf(w, "| %s | %s | %s |\n", markdownRepo(r.Repo), r.Status, markdownEscape(r.Error))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// mergedDiffStat totals the planned diffstats of merged repos
+func mergedDiffStat(reports []repoReport) plan.DiffStat {
+	total := plan.DiffStat{}
+	for _, r := range reports {
+		if r.Status != "merged" {
+			continue
+		}
+		total.FilesChanged += r.Plan.DiffStat.FilesChanged
+		total.Insertions += r.Plan.DiffStat.Insertions
+		total.Deletions += r.Plan.DiffStat.Deletions
+	}
+	return total
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRepoReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-report")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(d string) { workDir = d }(workDir)
+	workDir = dir
+
+	states := map[string]map[string]string{
+		"fresh":     {},
+		"unplanned": {"clone": `{"Success": true}`, "plan": `{"Success": false, "Error": "exit status 1"}`},
+		"pushed":    {"clone": `{"Success": true}`, "plan": `{"Success": true}`, "push": `{"Success": true, "PullRequestNumber": 3}`},
+		"merged": {"clone": `{"Success": true}`, "plan": `{"Success": true}`, "push": `{"Success": true}`,
+			"merge": `{"Success": true, "MergedBy": "octocat"}`},
+	}
+	for repo, steps := range states {
+		for step, state := range steps {
+			assert.NoError(t, os.MkdirAll(filepath.Join(dir, repo, step), 0755))
+			assert.NoError(t, ioutil.WriteFile(outputPath(repo, step), []byte(state), 0644))
+		}
+	}
+
+	tests := []struct {
+		repo   string
+		status string
+		err    string
+	}{
+		{"fresh", "initialized", ""},
+		{"unplanned", "cloned", "exit status 1"},
+		{"pushed", "pushed", ""},
+		{"merged", "merged", ""},
+	}
+	for _, test := range tests {
+		report := getRepoReport(initialize.Repo{Owner: "Clever", Name: test.repo})
+		assert.Equal(t, test.status, report.Status, test.repo)
+		assert.Equal(t, test.err, report.Error, test.repo)
+	}
+	assert.Equal(t, 3, getRepoReport(initialize.Repo{Name: "pushed"}).Push.PullRequestNumber)
+	assert.Equal(t, "octocat", getRepoReport(initialize.Repo{Name: "merged"}).Merge.MergedBy)
+}
+
+func TestWriteMarkdownReport(t *testing.T) {
+	reports := []repoReport{
+		{Repo: initialize.Repo{Owner: "Clever", Name: "fresh"}, Status: "initialized"},
+		{Repo: initialize.Repo{Owner: "Clever", Name: "my_repo"}, Status: "cloned", Error: "plan failed:\n`make` | exit status 2"},
+	}
+	merged := repoReport{Repo: initialize.Repo{Owner: "Clever", Name: "microplane"}, Status: "merged"}
+	merged.Push.PullRequestNumber = 12
+	merged.Push.PullRequestURL = "https://github.com/Clever/microplane/pull/12"
+	merged.Push.PullRequestCombinedStatus = "success"
+	merged.Plan.DiffStat.FilesChanged, merged.Plan.DiffStat.Insertions, merged.Plan.DiffStat.Deletions = 2, 3, 1
+	merged.Merge.MergeCommitSHA = "abc123"
+	merged.Merge.MergedBy = "octocat"
+	merged.Merge.MergedAt = time.Date(2019, 8, 14, 9, 0, 0, 0, time.UTC)
+	reports = append(reports, merged)
+
+	var b bytes.Buffer
+	writeMarkdownReport(&b, reports)
+	report := b.String()
+
+	for _, line := range []string{
+		"Total repos: 3\n",
+		"| initialized | 1 |\n",
+		"| cloned | 1 |\n",
+		"| merged | 1 |\n",
+		"| errored | 1 |\n",
+		"This campaign changed 2 file(s) across 1 repo(s): 3 insertion(s)(+), 1 deletion(s)(-)\n",
+		"| Clever/microplane | [#12](https://github.com/Clever/microplane/pull/12) | success | merged (abc123) | octocat | 2019-08-14T09:00:00Z |\n",
+		// the repo name and error are escaped, so they stay within their cells and aren't formatted
+		"| Clever/my\\_repo | cloned | plan failed: \\`make\\` \\| exit status 2 |\n",
+	} {
+		assert.Contains(t, report, line)
+	}
+	// only repos with a PR are in the PR table
+	assert.NotContains(t, report, "| Clever/fresh |")
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/Clever/microplane/initialize"
+)
+
+// retryBudgetFlag is how many more times parallelize attempts a repo that failed with a transient error
+var retryBudgetFlag int
+
+// requeueDelay is how long a requeued repo waits, per attempt so far, in case it comes up again right away
+var requeueDelay = 10 * time.Second
+
+// primaryRateLimitPattern matches Github's primary rate limit error, which only clears once the quota resets,
+// unlike its secondary rate limits, e.g. abuse detection
+var primaryRateLimitPattern = regexp.MustCompile(`(?i)API rate limit exceeded`)
+
+// transientErrorPatterns match errors that are likely to clear up by themselves, e.g. Github's rate limits,
+// 5xx responses from Github's API or git's HTTP transport, and network timeouts
+var transientErrorPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)rate limit`),
+	regexp.MustCompile(`(?i)abuse detection`),
+	regexp.MustCompile(`: 5\d\d \w`),
+	regexp.MustCompile(`returned error: 5\d\d`),
+	regexp.MustCompile(`(?i)i/o timeout|TLS handshake timeout|connection reset by peer|Client\.Timeout exceeded`),
+}
+
+// transientError returns whether a repo's error is worth another attempt later in the run
+func transientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, pattern := range transientErrorPatterns {
+		if pattern.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// requeueWait is how long a repo that failed with a transient error waits before it's attempted again:
+// until the Github quota resets for a primary rate limit, or requeueDelay per attempt so far otherwise
+func requeueWait(err error, attempt int) time.Duration {
+	wait := time.Duration(attempt) * requeueDelay
+	if !primaryRateLimitPattern.MatchString(err.Error()) {
+		return wait
+	}
+	if _, reset, ok := ghclient.Quota(); ok {
+		if untilReset := time.Until(reset) + time.Second; untilReset > wait {
+			return untilReset
+		}
+	}
+	return wait
+}
+
+type attemptKey struct{}
+
+// attempt is a repo's place in its retry budget, carried in the context of each attempt
+type attempt struct {
+	number int
+	budget int
+}
+
+// willRequeue returns whether a repo's failure will be retried later in the run, in which case it isn't its
+// outcome yet, see trackProgress
+func willRequeue(ctx context.Context, err error) bool {
+	a, ok := ctx.Value(attemptKey{}).(attempt)
+	return ok && a.number <= a.budget && ctx.Err() == nil && transientError(err)
+}
+
+// runAttempts are how many times each repo was attempted in this run, for those attempted more than once
+var runAttempts = &attempts{byRepo: map[string]int{}}
+
+type attempts struct {
+	sync.Mutex
+	byRepo map[string]int
+}
+
+func (a *attempts) record(r initialize.Repo, n int) {
+	a.Lock()
+	defer a.Unlock()
+	a.byRepo[fmt.Sprintf("%s/%s", r.Owner, r.Name)] = n
+}
+
+// of is how many times a repo, by org/name, was attempted
+func (a *attempts) of(repo string) int {
+	a.Lock()
+	defer a.Unlock()
+	if n, ok := a.byRepo[repo]; ok {
+		return n
+	}
+	return 1
+}
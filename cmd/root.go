@@ -2,13 +2,20 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/Clever/microplane/ghclient"
 	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/merge"
+	"github.com/Clever/microplane/plan"
+	"github.com/Clever/microplane/verbosity"
 	"github.com/spf13/cobra"
 )
 
@@ -22,64 +29,359 @@ var repoLimiter = time.NewTicker(720 * time.Millisecond)
 var rootCmd = &cobra.Command{
 	Use:   "mp",
 	Short: "Microplane makes git changes across many repos",
-}
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if verboseFlag && quietFlag {
+			log.Fatal("--verbose and --quiet can't both be set")
+		} else if verboseFlag {
+			verbosity.Set(verbosity.Verbose)
+		} else if quietFlag {
+			verbosity.Set(verbosity.Quiet)
+		}
+		if campaignFlag == "" {
+			campaignFlag = os.Getenv("MICROPLANE_CAMPAIGN")
+		}
+		ghclient.SetUserAgent(cliVersion, campaignFlag)
+		startTracing(cmd)
+		startMetrics(cmd)
+		if cmd == versionCmd {
+			// doesn't need a token
+			return
+		}
 
-func init() {
-	if os.Getenv("GITLAB_API_TOKEN") != "" && os.Getenv("GITHUB_API_TOKEN") != "" {
-		log.Fatalf("GITLAB_API_TOKEN and GITHUB_API_TOKEN can't be set both")
-	} else if os.Getenv("GITHUB_API_TOKEN") != "" {
-		repoProviderFlag = "github"
-	} else if os.Getenv("GITLAB_API_TOKEN") != "" {
-		repoProviderFlag = "gitlab"
-	} else {
-		log.Fatalf(`Neither GITHUB_API_TOKEN or GITLAB_API_TOKEN env var is not set.
-		    In order to use microplane with Github, create a token (https://help.github.com/articles/creating-a-personal-access-token-for-the-command-line/) then set the env var.
+		setupWorkDir()
+		if !readOnlyCommands[cmd.Name()] {
+			lockWorkDir(cmd.CommandPath())
+			startRunLog(cmd.CommandPath())
+		}
+		loadOverrides()
+
+		// Flags take precedence over env vars, so must be applied before picking the provider
+		ghclient.Configure(githubURLFlag, resolveGithubToken())
+		ghclient.SetToken(ghclient.Campaign, githubCampaignTokenFlag)
+		ghclient.SetAPIVersion(githubAPIVersionFlag)
+		configureTLS()
+		if adaptiveRateLimitFlag {
+			repoLimiter.Stop()
+			repoLimiter = adaptiveTicker(720*time.Millisecond, adaptiveMinInterval)
+		}
+		githubToken := ghclient.Token(ghclient.Discovery)
+		if os.Getenv("GITLAB_API_TOKEN") != "" && githubToken != "" {
+			log.Fatalf("GITLAB_API_TOKEN and GITHUB_API_TOKEN can't be set both")
+		} else if githubToken != "" {
+			repoProviderFlag = "github"
+			verbosity.Printf("using Github at %s", ghclient.Describe(ghclient.Campaign))
+			if v := ghclient.APIVersion(); v != "" {
+				verbosity.Printf("using Github API version %s", v)
+			} else {
+				verbosity.Printf("using Github's default API version")
+			}
+		} else if os.Getenv("GITLAB_API_TOKEN") != "" {
+			repoProviderFlag = "gitlab"
+		} else {
+			log.Fatalf(`Neither GITHUB_API_TOKEN or GITLAB_API_TOKEN env var is not set.
+		    In order to use microplane with Github, create a token (https://help.github.com/articles/creating-a-personal-access-token-for-the-command-line/) then set the env var, or pass it with --github-token.
 		    In order to use microplane with Gitlab, create a token (https://docs.gitlab.com/ee/user/profile/personal_access_tokens.html) then set the env var.`)
-	}
+		}
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		endRun(nil)
+	},
+}
+
+var verboseFlag bool
+var quietFlag bool
+
+// githubURLFlag and githubTokenFlag override the GITHUB_URL and GITHUB_API_TOKEN env vars
+var githubURLFlag string
+var githubTokenFlag string
+
+// githubAPIVersionFlag pins the Github REST API version, see ghclient.SetAPIVersion
+var githubAPIVersionFlag string
+
+// githubTokenFileFlag and githubTokenCommandFlag are alternatives to --github-token, that keep the token
+// out of the environment and process listings
+var githubTokenFileFlag string
+var githubTokenCommandFlag string
 
+// githubCampaignTokenFlag overrides the GITHUB_CAMPAIGN_TOKEN env var, the token that opens and merges PRs
+var githubCampaignTokenFlag string
+
+// stateDirFlag is where state files and clones are kept, see setupWorkDir
+var stateDirFlag string
+
+// caCertFlag and insecureSkipTLSVerifyFlag configure TLS for Github, see configureTLS
+var caCertFlag string
+var insecureSkipTLSVerifyFlag bool
+
+// adaptiveRateLimitFlag paces API calls, and push and merge throttles, by the remaining Github quota, see adaptiveTicker
+var adaptiveRateLimitFlag bool
+
+// campaignFlag identifies the campaign, e.g. in the User-Agent of API requests
+var campaignFlag string
+
+func init() {
 	rootCmd.PersistentFlags().StringP("repo", "r", "", "single repo to operate on")
+	rootCmd.PersistentFlags().String("repos-from", "", "only operate on repos whose last run of a step had an outcome, e.g. 'plan:failed'. Outcomes are succeeded, failed, pending, or incomplete (failed or pending)")
+	rootCmd.PersistentFlags().BoolVarP(&verboseFlag, "verbose", "v", false, "print details for debugging, e.g. API call timing and why each repo was or wasn't merged")
+	rootCmd.PersistentFlags().BoolVarP(&quietFlag, "quiet", "q", false, "only print errors and warnings")
+	rootCmd.PersistentFlags().StringVar(&stateDirFlag, "state-dir", "", "directory for state files and clones, so that campaigns can be kept apart (default $MICROPLANE_STATE_DIR, or ./mp)")
+	rootCmd.PersistentFlags().StringVar(&githubURLFlag, "github-url", "", "Github API URL, e.g. for Github Enterprise 'https://github.example.com/api/v3/' (default $GITHUB_URL, or github.com)")
+	rootCmd.PersistentFlags().StringVar(&githubAPIVersionFlag, "github-api-version", "", "Github REST API version to request with the X-GitHub-Api-Version header, e.g. '2022-11-28' for an older Github Enterprise (default $GITHUB_API_VERSION, or the server's default)")
+	rootCmd.PersistentFlags().StringVar(&githubTokenFlag, "github-token", "", "Github API token (default $GITHUB_API_TOKEN)")
+	rootCmd.PersistentFlags().StringVar(&githubTokenFileFlag, "github-token-file", "", "file containing the Github API token, instead of --github-token")
+	rootCmd.PersistentFlags().StringVar(&githubTokenCommandFlag, "github-token-command", "", "command that prints the Github API token, e.g. a credential helper, instead of --github-token")
+	rootCmd.PersistentFlags().StringVar(&githubCampaignTokenFlag, "github-campaign-token", "", "Github token that opens and merges PRs (default $GITHUB_CAMPAIGN_TOKEN, or the Github API token)")
+	rootCmd.PersistentFlags().StringVar(&caCertFlag, "ca-cert", "", "PEM bundle of CA certificates to trust for Github, e.g. for Github Enterprise behind an internal CA (default $GITHUB_CA_CERT)")
+	rootCmd.PersistentFlags().BoolVar(&insecureSkipTLSVerifyFlag, "insecure-skip-tls-verify", false, "DEVELOPMENT ONLY: don't verify Github's TLS certificate")
+	rootCmd.PersistentFlags().IntVar(&retryBudgetFlag, "retry-budget", 2, "how many more times to attempt a repo that failed with a transient error, e.g. a rate limit or a 502. It's retried after the other repos, so that the condition has time to clear, or once the quota resets for a Github rate limit. 0 disables")
+	rootCmd.PersistentFlags().BoolVar(&adaptiveRateLimitFlag, "adaptive-rate-limit", false, "pace Github API calls to spread the remaining rate limit quota evenly until it resets, rather than 1 call per 720ms. A --throttle of push or merge is then the least time between them")
+	rootCmd.PersistentFlags().StringVar(&campaignFlag, "campaign", "", "campaign identifier, included in the User-Agent of API requests (default $MICROPLANE_CAMPAIGN)")
+	rootCmd.PersistentFlags().StringVar(&otlpEndpointFlag, "otlp-endpoint", "", "OpenTelemetry collector to export traces of the run to over OTLP/HTTP, e.g. 'http://localhost:4318' (default $OTEL_EXPORTER_OTLP_ENDPOINT, or no tracing)")
+	rootCmd.PersistentFlags().StringVar(&metricsAddrFlag, "metrics-addr", "", "serve Prometheus metrics at this address during the run, e.g. ':9090', at /metrics")
+	rootCmd.PersistentFlags().StringVar(&pushgatewayFlag, "pushgateway", "", "Prometheus Pushgateway to push metrics to at the end of the run, e.g. 'http://pushgateway:9091'")
+	rootCmd.AddCommand(approveCmd)
+	approveCmd.Flags().BoolVar(&approveFlagRequireBuildSuccess, "require-build-success", false, "Only approve PRs whose build has succeeded")
+	approveCmd.Flags().IntVar(&approveFlagMaxDiffLines, "max-diff-lines", 0, "Only approve PRs changing at most this many lines, counting additions and deletions. By default PRs of any size are approved")
+	approveCmd.Flags().StringVarP(&approveFlagMessage, "message", "m", "", "Text of the approving review")
+	approveCmd.Flags().BoolVarP(&approveFlagYes, "yes", "y", false, "Approve without asking for confirmation")
+	approveCmd.Flags().StringVar(&approveFlagApproverToken, "approver-token", "", "Github token of the approver, who must not be the user that opened the PRs (default $GITHUB_APPROVER_TOKEN)")
+
+	rootCmd.AddCommand(archiveCmd)
+	archiveCmd.Flags().BoolVar(&archiveFlagIncludeWorkingTrees, "include-working-trees", false, "Include the cloned and planned repos, which can be large")
+	rootCmd.AddCommand(restoreCmd)
 	rootCmd.AddCommand(cloneCmd)
+	cloneCmd.Flags().StringVar(&cloneFlagRef, "ref", "", "Tag, branch, or commit SHA to check out after cloning. Changes are based off this ref")
+	cloneCmd.Flags().IntVar(&cloneFlagDepth, "depth", 0, "Make shallow clones with this many commits of history, which is faster for large repos. Repos are deepened on demand, e.g. if plan fails with a git error about missing history")
+	cloneCmd.Flags().StringVar(&cloneFlagMirrorRemote, "mirror-remote", "", "URL of a mirror to add as the 'mirror' remote of each repo, with {org} and {repo} replaced, e.g. 'git@gitlab.example.com:{org}/{repo}.git'")
+	cloneCmd.Flags().StringVar(&cloneFlagLayout, "clone-layout", layoutDefault, "Where repos are checked out in the workdir: 'default' (in each repo's state), 'flat' (cloned/{repo}), 'org-repo' (cloned/{org}/{repo}) or 'host-org-repo' (cloned/{host}/{org}/{repo}, like a GOPATH). Plan lays out its copies under planned/ the same way")
 	rootCmd.AddCommand(docsCmd)
+	rootCmd.AddCommand(exportPRsCmd)
+	exportPRsCmd.Flags().StringVar(&exportPRsFlagFormat, "format", "text", "Output format: text, csv or json")
+
+	rootCmd.AddCommand(versionCmd)
+	versionCmd.Flags().BoolVar(&versionFlagCheck, "check", false, "Check github.com for a newer release")
+
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().BoolVar(&diffFlagStat, "stat", false, "Show a diffstat instead of the full diff")
+	diffCmd.Flags().BoolVar(&diffFlagColor, "color", false, "Colorize the diff")
+	diffCmd.Flags().BoolVar(&diffFlagPR, "pr", false, "Show the diff of the open pull request, instead of the planned commit")
 
 	rootCmd.AddCommand(mergeCmd)
 	mergeCmd.Flags().StringVarP(&mergeFlagThrottle, "throttle", "t", "1ms", "Throttle number of merges, e.g. '30s' means 1 merge per 30 seconds")
+	mergeCmd.Flags().IntVar(&mergeFlagRetryAttempts, "retry-attempts", merge.DefaultRetryPolicy.MaxAttempts, "How many times to try Github API calls that fail with a transient error, e.g. a 502")
+	mergeCmd.Flags().DurationVar(&mergeFlagRetryMaxDelay, "retry-max-delay", merge.DefaultRetryPolicy.MaxDelay, "Longest wait between retries, which back off exponentially from 1s. Also the longest wait between polls of a rebased PR's CI")
+	mergeCmd.Flags().IntVar(&mergeFlagConcurrency, "concurrency", defaultConcurrency, "Number of repos to work on at once. Only the merge call itself waits for --throttle, so a higher concurrency lets other repos' checks proceed meanwhile")
+	mergeCmd.Flags().IntVar(&mergeFlagMaxInFlightPerOrg, "max-in-flight-per-org", 0, "Most merges in flight at once in each org, on top of --concurrency, to go easy on an org's webhooks and CI. Only the merge call holds a slot, not the checks before it. By default orgs aren't capped")
+	mergeCmd.Flags().DurationVar(&mergeFlagTimeout, "timeout", 0, "Stop the whole merge run after this long, e.g. 30m, reporting which repos completed, were in flight, or were never attempted. By default there's no limit")
+	mergeCmd.Flags().StringVar(&mergeFlagMaxTotalDiff, "max-total-diff", "", "Refuse to merge anything if the repos to merge change more than this in total, according to plan, e.g. '5000 lines' or '200 files'")
+	mergeCmd.Flags().StringVar(&mergeFlagRequireApprovalAbove, "require-approval-above", "", "Only require approval for PRs whose planned change is bigger than this, e.g. '5 lines' or '1 file'. Smaller PRs merge once their build passes, as long as nothing else was pushed to them, so it can't be used with --rebase")
+	mergeCmd.Flags().IntVar(&mergeFlagMinExpectedChecks, "min-expected-checks", 0, "Wait for at least this many status checks and check runs to be present before checking a PR's build, so it isn't merged before CI has registered them (Github only)")
+	mergeCmd.Flags().DurationVar(&mergeFlagBuildTimeout, "build-timeout", merge.DefaultBuildTimeout, "How long to wait for --min-expected-checks")
+	mergeCmd.Flags().BoolVar(&mergeFlagForce, "force", false, "Merge even if safety checks such as --max-total-diff fail")
 	mergeCmd.Flags().BoolVar(&mergeFlagIgnoreReviewApproval, "ignore-review-approval", false, "Ignore whether or not the review has been approved")
 	mergeCmd.Flags().BoolVar(&mergeFlagIgnoreBuildStatus, "ignore-build-status", false, "Ignore whether or not builds are passing")
+	mergeCmd.Flags().StringSliceVar(&mergeFlagIgnoreContexts, "ignore-context", []string{}, "Status check contexts to ignore when checking whether builds are passing, e.g. unrelated path-scoped checks")
+	mergeCmd.Flags().StringSliceVar(&mergeFlagBlockingContexts, "blocking-context", []string{}, "Status check contexts or check run names, e.g. of a Github Actions job, that block merging if they fail, even with --ignore-build-status")
+	mergeCmd.Flags().StringVar(&mergeFlagMaxCheckAge, "max-check-age", "", "Don't merge if the newest passing status check or check run is older than this, e.g. '24h', to avoid merging on stale builds")
+	mergeCmd.Flags().StringVar(&mergeFlagWindowStart, "merge-window-start", "", "Only merge after this time of day, e.g. '09:00'")
+	mergeCmd.Flags().StringVar(&mergeFlagWindowEnd, "merge-window-end", "", "Only merge before this time of day, e.g. '17:00'. It's checked again just before each merge call, so a PR whose gates outlast the window is left for a later run")
+	mergeCmd.Flags().StringVar(&mergeFlagWindowTimezone, "merge-window-timezone", "", "Timezone of the merge window, e.g. 'America/Los_Angeles' (default local time)")
+	mergeCmd.Flags().StringVar(&mergeFlagWindowDays, "merge-window-days", "", "Comma-separated weekdays on which the merge window opens, e.g. 'mon,tue,wed,thu,fri' (default every day)")
+	mergeCmd.Flags().BoolVar(&mergeFlagWait, "wait", false, "Wait rather than give up, e.g. until the merge window opens")
+	mergeCmd.Flags().BoolVar(&mergeFlagRequireCleanMergeState, "require-clean-merge-state", false, "Only merge PRs whose mergeable state is 'clean', e.g. not behind the base branch or with failing non-required checks")
+	mergeCmd.Flags().BoolVar(&mergeFlagOnlyApproved, "only-approved", false, "Only attempt to merge PRs that are already approved, reporting the rest as not yet eligible")
+	mergeCmd.Flags().BoolVar(&mergeFlagOnlyGreen, "only-green", false, "Only attempt to merge PRs whose build has succeeded, reporting the rest as not yet eligible. PRs whose build turned green since the last run are merged first, e.g. for periodic merge runs")
+	mergeCmd.Flags().BoolVar(&mergeFlagAdminOverride, "admin-override", false, "DANGER: merge as a repo admin, bypassing branch protection. Requires admin access, use only for emergencies")
+	mergeCmd.Flags().BoolVar(&mergeFlagRebase, "rebase", false, "Rebase PRs that are behind their base branch locally and force-push them, then wait for CI before merging")
+	mergeCmd.Flags().StringVar(&mergeFlagGateCommand, "gate-command", "", "Command run per PR after the built-in gates, with MICROPLANE_ORG, MICROPLANE_REPO, MICROPLANE_PR_NUMBER etc. set. Non-zero exit skips the merge, with its output as the reason")
+	mergeCmd.Flags().BoolVar(&mergeFlagMarkReady, "mark-ready", false, "Mark draft PRs that pass all gates as ready for review, then merge them. Otherwise drafts aren't merged")
+	mergeCmd.Flags().BoolVar(&mergeFlagRetargetBase, "retarget-base", false, "If a PR's base branch was deleted or renamed, retarget the PR to the repo's default branch")
+	mergeCmd.Flags().BoolVar(&mergeFlagCleanup, "cleanup", false, "Remove each repo's local clone once it's merged, to free up disk space. State files are kept")
+	mergeCmd.Flags().StringVar(&mergeFlagMergeMethod, "merge-method", "merge", "How to merge PRs: merge, squash or rebase")
+	mergeCmd.Flags().BoolVar(&mergeFlagCoAuthors, "co-authors", false, "When squash merging, list the authors of the PR's commits as 'Co-authored-by' in the commit message")
+	mergeCmd.Flags().BoolVar(&mergeFlagAutoMerge, "auto-merge", false, "Enable Github's auto-merge on each PR that passes the other gates rather than merging it, so Github merges it once its build passes instead of microplane waiting for it")
+	mergeCmd.Flags().BoolVar(&mergeFlagLabelOutcomes, "label-outcomes", false, "Label each PR with why it wasn't merged, e.g. 'mp-awaiting-review', updating the label on each run")
+	mergeCmd.Flags().BoolVar(&mergeFlagCommentOutcomes, "comment-outcomes", false, "Comment on each PR when it's merged or skipped, e.g. 'Skipped by microplane: PR awaiting review'. An outcome isn't commented again if it hasn't changed")
+	mergeCmd.Flags().StringVar(&mergeFlagCommentTemplate, "comment-template", "", "Template file for --comment-outcomes comments, with .Org, .Repo, .PRNumber, .Campaign, .Outcome (merged, auto-merge or skipped) and .Reason")
+	mergeCmd.Flags().StringVar(&mergeFlagLinkedIssueState, "linked-issue-state", "", "Only merge PRs whose linked issues, e.g. 'Fixes #123' in the PR body, are in this state: open or closed")
+	mergeCmd.Flags().StringSliceVar(&mergeFlagLinkedIssueLabels, "linked-issue-label", []string{}, "Only merge PRs whose linked issues have all of these labels")
+	mergeCmd.Flags().BoolVar(&mergeFlagNeverWithChangesRequested, "never-merge-with-changes-requested", false, "Don't merge a PR while any reviewer's latest review requests changes, even with --ignore-review-approval")
+	mergeCmd.Flags().BoolVar(&mergeFlagProhibitSelfApproval, "prohibit-self-approval", false, "Require an approval from someone other than the PR's author and the token user, for separation of duties")
+	mergeCmd.Flags().IntVar(&mergeFlagMinApprovals, "min-approvals", 1, "Number of distinct reviewers who must approve a PR")
+	mergeCmd.Flags().BoolVar(&mergeFlagApprovalsFromProtection, "approvals-from-protection", false, "Require the number of approvals set by each repo's base branch protection, falling back to --min-approvals if it can't be read")
+	mergeCmd.Flags().StringVar(&mergeFlagOperator, "operator", "", "With --prohibit-self-approval, the login of the person running the merge, whose approvals also don't count")
+	mergeCmd.Flags().StringVar(&mergeFlagDispatchWorkflow, "dispatch-workflow", "", "After merging, run this Github Actions workflow (file name or ID) on the base branch, e.g. 'deploy.yml'. Failures are only warnings")
+	mergeCmd.Flags().StringVar(&mergeFlagDispatchEvent, "dispatch-event", "", "After merging, send a repository_dispatch event of this type, with the base branch and PR number as its payload. Failures are only warnings")
+	mergeCmd.Flags().BoolVar(&mergeFlagNoDeleteBranch, "no-delete-branch", false, "Keep each PR's branch after merging, rather than deleting it. The DeleteBranch override sets this per repo")
+	mergeCmd.Flags().IntVar(&mergeFlagMaxMergesPerTeam, "max-merges-per-team", 0, "Merge at most this many repos per owning team in a run, deferring the rest, e.g. to avoid flooding one team with deploys. Teams come from CODEOWNERS or the Team override")
+	mergeCmd.Flags().StringVar(&mergeFlagJSON, "json", "", "Write each repo's outcome as a JSON array to this file, or '-' for stdout, e.g. for follow-up automation")
+	mergeCmd.Flags().BoolVar(&mergeFlagDryRunDiff, "dry-run-diff", false, "Don't merge, instead show the diff each PR would bring into its base branch, for a final review. Use --repo to limit to one repo")
+	mergeCmd.Flags().StringVar(&mergeFlagDiffDir, "diff-dir", "", "With --dry-run-diff, write each diff to a file in this directory rather than printing it")
+	mergeCmd.Flags().BoolVar(&mergeFlagStat, "stat", false, "With --dry-run-diff, print a diffstat per repo rather than the full diff")
+	mergeCmd.Flags().StringVar(&mergeFlagNoChecksPolicy, "no-checks-policy", "pending", "How to treat a PR with no status checks or check runs once --no-checks-grace has passed: pending (keep waiting), success (the repo has no CI) or failure")
+	mergeCmd.Flags().DurationVar(&mergeFlagNoChecksGrace, "no-checks-grace", 10*time.Minute, "How long after a commit is pushed to wait for its checks to be created, see --no-checks-policy")
+	mergeCmd.Flags().BoolVar(&mergeFlagRequirePushedHead, "require-pushed-head", false, "Only merge a PR if its head is still the commit microplane pushed, e.g. not if extra commits were pushed after review")
+	mergeCmd.Flags().BoolVar(&mergeFlagPreflight, "preflight", false, "Before merging, check each repo's branch protection and abort if any repo can't be merged by you")
 
 	rootCmd.AddCommand(planCmd)
 	planCmd.Flags().StringVarP(&planFlagBranch, "branch", "b", "", "Git branch to commit to")
 	planCmd.Flags().StringVarP(&planFlagMessage, "message", "m", "", "Commit message")
+	planCmd.Flags().BoolVar(&planFlagPreview, "preview", false, "Run the change against a throwaway copy of each repo and report the diffstat it would make, without saving anything")
+	planCmd.Flags().StringVar(&planFlagPatch, "patch", "", "Apply a patch file to each repo with 'git apply', instead of running a command")
+	planCmd.Flags().StringVar(&planFlagShell, "shell", "", "Run the command as a script with this shell: bash, sh, pwsh, cmd, any executable that takes -c, or 'auto' (sh, or powershell on Windows). By default the command is run directly")
+	planCmd.Flags().StringArrayVar(&planFlagCmds, "cmd", []string{}, "A command to run in each repo, with --shell (default sh). Repeat it to run a pipeline of commands in order, which stops at the first that fails")
+	planCmd.Flags().BoolVar(&planFlagContinueOnError, "continue-on-error", false, "Keep running the rest of the --cmd pipeline when a command fails, and commit whatever changed")
+	planCmd.Flags().StringVar(&planFlagWhen, "when", "", "Only change repos where this command, run first with --shell (default sh), exits zero. Other repos are skipped")
+	planCmd.Flags().StringArrayVar(&planFlagWhenFileExists, "when-file-exists", []string{}, "Only change repos with a file matching this glob, e.g. 'go.mod'")
+	planCmd.Flags().StringArrayVar(&planFlagWhenGrep, "when-grep", []string{}, "Only change repos with a tracked file matching this regexp, e.g. 'github.com/pkg/errors'")
+	planCmd.Flags().StringVar(&planFlagWorkdir, "workdir", "", "Run the command from this directory, relative to each repo's root, e.g. a package in a monorepo. The diff is still of the whole repo. Repos without it are skipped")
+	planCmd.Flags().StringSliceVar(&planFlagCIConfig, "ci-config", plan.DefaultCIConfigPaths, "Globs of CI config files. Repos without any are recorded in their plan state, and warned about")
+	planCmd.Flags().BoolVar(&planFlagRequireCIConfig, "require-ci-config", false, "Skip repos without any --ci-config, since CI can't validate the change")
+	planCmd.Flags().BoolVar(&planFlagIsolated, "isolated", false, "Run the command on a scratch copy of each repo, and only bring its diff back to the planned repo, so that anything else it leaves behind, e.g. ignored build output, doesn't affect later steps. Slower, since each repo is copied twice")
+	planCmd.Flags().StringVar(&planFlagEnvFile, "env-file", "", "File of KEY=VALUE lines, exported to the command in every repo, e.g. a campaign's target version")
+	planCmd.Flags().StringSliceVar(&planFlagCopy, "copy", []string{}, "Local files or directories to copy into each repo before running the command, at $MICROPLANE_COPY_DIR. They're removed before committing")
 
 	rootCmd.AddCommand(pushCmd)
 	pushCmd.Flags().StringVarP(&pushFlagThrottle, "throttle", "t", "1ms", "Throttle number of pushes, e.g. '30s' means 1 push per 30 seconds")
 	pushCmd.Flags().StringVarP(&pushFlagAssignee, "assignee", "a", "", "Github user to assign the PR to")
-	pushCmd.Flags().StringVarP(&pushFlagBodyFile, "body-file", "b", "", "body of PR")
+	pushCmd.Flags().IntVar(&pushFlagMaxFilesChanged, "max-files-changed", 0, "Refuse to push repos whose planned change touches more than this many files (0 means no limit)")
+	pushCmd.Flags().BoolVar(&pushFlagForce, "force", false, "Push even if safety checks such as --max-files-changed fail")
+	pushCmd.Flags().StringVar(&pushFlagSplitBy, "split-by", "", "Split each repo's change into several PRs. 'dir' opens a PR per top-level directory, 'manifest' a PR per group of --split-manifest")
+	pushCmd.Flags().StringVar(&pushFlagSplitManifest, "split-manifest", "", "Split each repo's change into several PRs, using a JSON file mapping group names to path prefixes, e.g. {\"api\": [\"api/\"]}")
+	pushCmd.Flags().BoolVar(&pushFlagDryRun, "dry-run", false, "Print the PR that would be opened for each repo, without pushing or opening PRs")
+	pushCmd.Flags().BoolVar(&pushFlagDirect, "direct", false, "DANGER: commit directly to the base branch rather than opening a PR, bypassing review. Refused for branches whose protection requires reviews or status checks")
+	pushCmd.Flags().BoolVar(&pushFlagPushMirror, "push-mirror", false, "Also push the change's branch to the mirror remote added by clone --mirror-remote. Set $MICROPLANE_MIRROR_TOKEN to authenticate to an https mirror")
+	pushCmd.Flags().StringVar(&pushFlagSupersedePrefix, "supersede-prefix", "", "Close your open PRs from previous runs whose branch starts with this prefix, e.g. 'go-upgrade-', commenting that they were superseded")
+	pushCmd.Flags().StringVar(&pushFlagCommitMessageFile, "commit-message-file", "", "commit message, rendered per repo as a Go template like --body-file. Rewords the planned commit before pushing")
+	pushCmd.Flags().StringVarP(&pushFlagBodyFile, "body-file", "b", "", "body of PR, rendered per repo as a Go template, e.g. {{.Org}}/{{.Repo}} or {{diffstat .Diff}}")
+
+	rootCmd.AddCommand(abandonCmd)
+	abandonCmd.Flags().StringSliceVar(&abandonFlagRepos, "repos", nil, "Only abandon the PRs of these repos, e.g. --repos=foo,bar")
+	abandonCmd.Flags().BoolVarP(&abandonFlagYes, "yes", "y", false, "Don't ask for confirmation")
+	abandonCmd.Flags().StringVarP(&abandonFlagMessage, "message", "m", "", "Comment on each PR before closing it, e.g. to say why the campaign was abandoned")
+
+	rootCmd.AddCommand(pruneStateCmd)
+	pruneStateCmd.Flags().BoolVarP(&pruneFlagYes, "yes", "y", false, "Don't ask for confirmation")
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.Flags().StringVar(&reportFlagFormat, "format", "markdown", "Output format: markdown")
 
 	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringVar(&statusFlagFormat, "format", "", "Output format: 'table' for a compact, one line per repo view")
+	statusCmd.Flags().BoolVar(&statusFlagColor, "color", false, "Colorize the table")
+	statusCmd.Flags().BoolVar(&statusFlagStale, "stale", false, "Also check open PRs on Github, and list those that are behind their base branch, failing CI, or older than --stale-age")
+	statusCmd.Flags().DurationVar(&statusFlagStaleAge, "stale-age", 14*24*time.Hour, "How old a PR, or its CI results, can be before --stale lists it")
+	statusCmd.Flags().BoolVar(&statusFlagLive, "live", false, "also re-fetch each pushed PR's state, CI status and merge status from Github, ignoring the saved state, and list the repos where they differ")
+	statusCmd.Flags().BoolVar(&statusFlagLive, "force-recompute", false, "same as --live")
 
 	rootCmd.AddCommand(initCmd)
 	initCmd.Flags().StringVarP(&initFlagReposFile, "file", "f", "", "get repos from a file instead of searching")
+	initCmd.Flags().StringSliceVar(&initFlagTopics, "topic", []string{}, "only target repos that have all of these Github topics")
+	initCmd.Flags().StringSliceVar(&initFlagExcludeTopics, "exclude-topic", []string{}, "don't target repos that have any of these Github topics")
+	initCmd.Flags().StringVar(&initFlagOwnedBy, "owned-by", "", "only target repos where this team or user, e.g. '@Clever/infra', is a top-level owner in CODEOWNERS")
+	initCmd.Flags().BoolVar(&initFlagDependencies, "dependencies", false, "find which repos depend on each other, from their go.mod and package.json, so that merge merges them in dependency order")
+	initCmd.Flags().DurationVar(&initFlagCacheTTL, "cache-ttl", time.Hour, "reuse the repos discovered by an earlier init with the same query, filters and token, if it was within this long. 0 disables the cache")
+	initCmd.Flags().BoolVar(&initFlagRefresh, "refresh", false, "discover the repos again, rather than reusing the cache")
+	initCmd.Flags().StringVar(&initFlagRunID, "run-id", "", "ID of the campaign, added as a 'microplane-run: <id>' footer to its commits and PRs. Defaults to the ID of the previous init in the workdir, or a new one")
+}
 
-	workDir, err := filepath.Abs("./mp")
-	if err != nil {
-		log.Fatalf("error finding workDir: %s\n", err.Error())
+// resolveGithubToken returns the token from --github-token, --github-token-file or --github-token-command,
+// or "" to fall back to the env vars
+func resolveGithubToken() string {
+	set := 0
+	for _, f := range []string{githubTokenFlag, githubTokenFileFlag, githubTokenCommandFlag} {
+		if f != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		log.Fatal("only one of --github-token, --github-token-file and --github-token-command can be set")
 	}
 
-	// Create workDir, if doesn't yet exist
-	if _, err := os.Stat(workDir); os.IsNotExist(err) {
-		if err := os.Mkdir(workDir, 0755); err != nil {
-			log.Fatalf("error creating workDir: %s\n", err.Error())
+	switch {
+	case githubTokenFileFlag != "":
+		info, err := os.Stat(githubTokenFileFlag)
+		if err != nil {
+			log.Fatalf("error reading --github-token-file: %s", err.Error())
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			log.Printf("WARNING: --github-token-file %s is readable by other users, consider 'chmod 600'", githubTokenFileFlag)
+		}
+		b, err := ioutil.ReadFile(githubTokenFileFlag)
+		if err != nil {
+			log.Fatalf("error reading --github-token-file: %s", err.Error())
 		}
+		return strings.TrimSpace(string(b))
+	case githubTokenCommandFlag != "":
+		cmd := exec.Command("sh", "-c", githubTokenCommandFlag)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			log.Fatalf("error running --github-token-command: %s", err.Error())
+		}
+		token := strings.TrimSpace(string(out))
+		if token == "" {
+			log.Fatal("--github-token-command printed an empty token")
+		}
+		return token
 	}
+	return githubTokenFlag
 }
 
-// Execute starts the CLI
-func Execute(version string) error {
-	cliVersion = version
+// configureTLS applies --ca-cert and --insecure-skip-tls-verify to Github API calls,
+// and to git, so that clones and pushes over https work too
+func configureTLS() {
+	caCert := caCertFlag
+	if caCert == "" {
+		caCert = os.Getenv("GITHUB_CA_CERT")
+	}
+	if caCert != "" {
+		abs, err := filepath.Abs(caCert)
+		if err != nil {
+			log.Fatalf("error finding --ca-cert: %s", err.Error())
+		}
+		caCert = abs
+	}
+	if err := ghclient.ConfigureTLS(caCert, insecureSkipTLSVerifyFlag); err != nil {
+		log.Fatal(err)
+	}
+	if caCert != "" {
+		os.Setenv("GIT_SSL_CAINFO", caCert)
+	}
+	if insecureSkipTLSVerifyFlag {
+		log.Printf("WARNING: --insecure-skip-tls-verify is set, Github's TLS certificate is not verified. Only use this for development")
+		os.Setenv("GIT_SSL_NO_VERIFY", "true")
+	}
+}
+
+// setupWorkDir resolves the workdir from --state-dir, creates it if needed, and checks it's usable
+func setupWorkDir() {
+	dir := stateDirFlag
+	if dir == "" {
+		dir = os.Getenv("MICROPLANE_STATE_DIR")
+	}
+	if dir == "" {
+		dir = "./mp"
+	}
+	var err error
+	workDir, err = filepath.Abs(dir)
+	if err != nil {
+		log.Fatalf("error finding workDir: %s\n", err.Error())
+	}
+
+	// Create workDir, if doesn't yet exist
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		log.Fatalf("error creating workDir: %s\n", err.Error())
+	}
+	f, err := ioutil.TempFile(workDir, ".write-check")
+	if err != nil {
+		log.Fatalf("workDir %s is not writable: %s\n", workDir, err.Error())
+	}
+	f.Close()
+	os.Remove(f.Name())
 
 	// Check if your current workdir was created with an incompatible version of microplane
 	var initOutput initialize.Output
-	err := loadJSON(outputPath("", "init"), &initOutput)
+	err = loadJSON(outputPath("", "init"), &initOutput)
 	if err != nil {
 		// If there's no file, that's OK
 		if !os.IsNotExist(err) {
@@ -87,10 +389,14 @@ func Execute(version string) error {
 		}
 	} else {
 		if initOutput.Version != cliVersion {
-			log.Fatalf("A workdir (%s) exists, created with microplane version %s. This is incompatible with your version %s. Either run again using a compatible version, or remove the workdir and restart.", workDir, initOutput.Version, version)
+			log.Fatalf("A workdir (%s) exists, created with microplane version %s. This is incompatible with your version %s. Either run again using a compatible version, or remove the workdir and restart.", workDir, initOutput.Version, cliVersion)
 		}
 	}
+}
 
+// Execute starts the CLI
+func Execute(version string) error {
+	cliVersion = version
 	return rootCmd.Execute()
 }
 
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/Clever/microplane/initialize"
+)
+
+var validRunID = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// initRunID is the run ID for init: the one passed with --run-id, else the one of the previous init in the
+// workdir, so that re-running init doesn't lose track of a campaign's PRs, else a new one
+func initRunID(flag string) (string, error) {
+	if flag != "" {
+		if !validRunID.MatchString(flag) {
+			return "", fmt.Errorf("invalid --run-id %s, must only contain letters, digits, '.', '_' and '-'", flag)
+		}
+		return flag, nil
+	}
+	var previous initialize.Output
+	if loadJSON(outputPath("", "init"), &previous) == nil && previous.RunID != "" {
+		return previous.RunID, nil
+	}
+	return newRunID(time.Now())
+}
+
+// newRunID is the date, so that IDs sort roughly by when their campaign started, and some random hex
+func newRunID(now time.Time) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return now.Format("20060102") + "-" + hex.EncodeToString(b), nil
+}
+
+// campaignRunID is the run ID recorded by init, or "" for a workdir initialized before run IDs
+func campaignRunID() string {
+	var initOutput initialize.Output
+	if loadJSON(outputPath("", "init"), &initOutput) != nil {
+		return ""
+	}
+	return initOutput.RunID
+}
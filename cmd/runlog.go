@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"time"
+)
+
+// runLogPath is where the log of each run that modifies state is appended, so that a campaign's history
+// is kept with its state, e.g. for 'mp archive'
+func runLogPath() string {
+	return path.Join(workDir, "mp.log")
+}
+
+// startRunLog copies the log to runLogPath, as well as stderr. The command line isn't logged, since its flags
+// may include a token.
+func startRunLog(command string) {
+	f, err := os.OpenFile(runLogPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("WARNING: error opening %s, this run won't be logged to it: %s", runLogPath(), err.Error())
+		return
+	}
+	fmt.Fprintf(f, "--- %s, %s\n", command, time.Now().UTC().Format(time.RFC3339))
+	log.SetOutput(io.MultiWriter(os.Stderr, f))
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Clever/microplane/initialize"
+	"github.com/Clever/microplane/merge"
+	"github.com/Clever/microplane/push"
+)
+
+var statusFlagStale bool
+var statusFlagStaleAge time.Duration
+
+// printStale checks the open PRs of pushed repos, and lists those that have drifted, see merge.Drift.
+// Unlike the rest of status, this reads live PR and CI state from Github.
+func printStale(repos []initialize.Repo) {
+	var mutex sync.Mutex
+	stale := map[string][]string{}
+	checked := 0
+	now := time.Now()
+	err := parallelize(repos, func(r initialize.Repo, ctx context.Context) error {
+		var pushOutput push.Output
+		if r.Provider != "github" || isMerged(r) || loadJSON(outputPath(r.Name, "push"), &pushOutput) != nil ||
+			!pushOutput.Success || pushOutput.PullRequestNumber == 0 {
+			return nil
+		}
+		drift, err := merge.GitHubDrift(ctx, merge.Input{Org: r.Owner, Repo: r.Name, PRNumber: pushOutput.PullRequestNumber}, repoLimiter)
+		if err != nil {
+			log.Printf("WARNING: %s/%s - error checking PR #%d: %s", r.Owner, r.Name, pushOutput.PullRequestNumber, err.Error())
+			return nil
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if drift.Open {
+			checked++
+		}
+		if reasons := drift.Reasons(now, statusFlagStaleAge); len(reasons) > 0 {
+			stale[fmt.Sprintf("%s/%s#%d", r.Owner, r.Name, pushOutput.PullRequestNumber)] = reasons
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("\n%d of %d open PR(s) have drifted\n", len(stale), checked)
+	if len(stale) == 0 {
+		return
+	}
+	prs := []string{}
+	for pr := range stale {
+		prs = append(prs, pr)
+	}
+	sort.Strings(prs)
+	out := tabWriterWithDefaults()
+	fmt.Fprintln(out, joinWithTab("PR", "DRIFT"))
+	for _, pr := range prs {
+		fmt.Fprintln(out, joinWithTab(pr, strings.Join(stale[pr], ", ")))
+	}
+	out.Flush()
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/Clever/microplane/clone"
 	"github.com/Clever/microplane/initialize"
@@ -17,6 +18,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var statusFlagFormat string
+var statusFlagColor bool
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Status shows a workflow's progress",
@@ -51,16 +55,90 @@ var statusCmd = &cobra.Command{
 		}
 
 		repos := []string{}
+		targeted := []initialize.Repo{}
 		for _, r := range initOutput.Repos {
 			if singleRepo != "" && r.Name != singleRepo {
 				continue
 			}
 			repos = append(repos, r.Name)
+			targeted = append(targeted, r)
+		}
+		switch statusFlagFormat {
+		case "":
+			printStatus(repos)
+		case "table":
+			printStatusTable(targeted)
+		default:
+			log.Fatalf("unsupported --format %s, must be one of: table", statusFlagFormat)
+		}
+		if statusFlagStale {
+			printStale(targeted)
+		}
+		if statusFlagLive {
+			printLive(targeted)
 		}
-		printStatus(repos)
 	},
 }
 
+// maxTableRepoWidth is the widest repo name shown by `status --format table`, so rows fit in a terminal
+const maxTableRepoWidth = 40
+
+// elide shortens s to at most width characters, replacing its middle with "..."
+func elide(s string, width int) string {
+	if len(s) <= width {
+		return s
+	}
+	keep := width - 3
+	return s[:keep-keep/2] + "..." + s[len(s)-keep/2:]
+}
+
+// printStatusTable prints a compact, one line per repo, view of a workflow's progress
+func printStatusTable(repos []initialize.Repo) {
+	if !statusFlagColor {
+		color.NoColor = true
+	}
+	width := len("REPO")
+	for _, r := range repos {
+		if n := len(r.Owner + "/" + r.Name); n > width {
+			width = n
+		}
+	}
+	if width > maxTableRepoWidth {
+		width = maxTableRepoWidth
+	}
+
+	// padding is done before coloring, since color codes would throw off the alignment
+	fmt.Printf("%-*s  %-11s  %-8s  %s\n", width, "REPO", "STEP", "STATE", "PR")
+	locked := workDirLocked()
+	for _, r := range repos {
+		report := getRepoReport(r)
+		state := "ok"
+		if report.Error != "" {
+			state = "error"
+		} else if report.Status == "pushed" && report.Push.PullRequestCombinedStatus != "" {
+			state = report.Push.PullRequestCombinedStatus
+		}
+		if step, _ := activeStep(r.Name, locked); step != "" {
+			report.Status = stepVerbs[step]
+			state = "running"
+		}
+		stateCol := fmt.Sprintf("%-8s", state)
+		switch state {
+		case "error", "failure":
+			stateCol = color.RedString(stateCol)
+		case "pending", "running":
+			stateCol = color.YellowString(stateCol)
+		default:
+			stateCol = color.GreenString(stateCol)
+		}
+		pr := ""
+		if report.Push.PullRequestNumber != 0 {
+			pr = fmt.Sprintf("#%d", report.Push.PullRequestNumber)
+		}
+		fmt.Printf("%-*s  %-11s  %s  %s\n", width, elide(r.Owner+"/"+r.Name, width), report.Status, stateCol, pr)
+	}
+}
+
 func tabWriterWithDefaults() *tabwriter.Writer {
 	w := new(tabwriter.Writer)
 	minWidth := 0
@@ -79,8 +157,13 @@ func joinWithTab(s ...string) string {
 func printStatus(repos []string) {
 	out := tabWriterWithDefaults()
 	fmt.Fprintln(out, joinWithTab("REPO", "STATUS", "DETAILS"))
+	locked := workDirLocked()
 	for _, r := range repos {
 		status, details := getRepoStatus(r)
+		if step, marker := activeStep(r, locked); step != "" {
+			status = stepVerbs[step]
+			details = color.YellowString("(in progress) ") + fmt.Sprintf("started %s ago", time.Since(marker.StartedAt).Round(time.Second))
+		}
 		d2 := strings.TrimSpace(details)
 		d3 := strings.Join(strings.Split(d2, "\n"), " ")
 		if len(d3) > 150 {
@@ -113,6 +196,8 @@ func getRepoStatus(repo string) (status, details string) {
 	if !(loadJSON(outputPath(repo, "plan"), &planOutput) == nil && planOutput.Success) {
 		if planOutput.Error != "" {
 			details = color.RedString("(plan error) ") + planOutput.Error
+		} else if planOutput.SkippedBy != "" {
+			details = "(plan skipped) didn't match " + planOutput.SkippedBy
 		}
 		return
 	}
@@ -121,6 +206,9 @@ func getRepoStatus(repo string) (status, details string) {
 	if err == nil {
 		details = fmt.Sprintf("%d file(s) modified", len(diff.Files))
 	}
+	if planOutput.NoCIConfig {
+		details += ", no CI config"
+	}
 	if isSingleRepo {
 		fmt.Println(planOutput.GitDiff)
 	}
@@ -146,6 +234,11 @@ func getRepoStatus(repo string) (status, details string) {
 		if mergeOutput.Error != "" {
 			details = color.RedString("(merge error) ") + mergeOutput.Error
 		}
+		var abandoned abandonOutput
+		if loadJSON(outputPath(repo, "abandon"), &abandoned) == nil && abandoned.Success {
+			status = "abandoned"
+			details = ""
+		}
 		return
 	}
 	status = "merged"
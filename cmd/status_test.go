@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElide(t *testing.T) {
+	assert.Equal(t, "Clever/microplane", elide("Clever/microplane", 40))
+	assert.Equal(t, "Clever...plane", elide("Clever/microplane", 14))
+	assert.Equal(t, 14, len(elide("Clever/microplane", 14)))
+}
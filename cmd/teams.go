@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/Clever/microplane/clone"
+	"github.com/Clever/microplane/initialize"
+)
+
+// teamFor determines the team that owns a repo, for --max-merges-per-team:
+// - the Team override, if set
+// - the first owner of the catch-all (*) rule in the cloned repo's CODEOWNERS
+// It returns "" if the repo has no owner.
+func teamFor(r initialize.Repo) string {
+	if o := overrideFor(r); o.Team != "" {
+		return o.Team
+	}
+	var cloneOutput clone.Output
+	if loadJSON(outputPath(r.Name, "clone"), &cloneOutput) != nil || cloneOutput.ClonedIntoDir == "" {
+		return ""
+	}
+	for _, p := range initialize.CodeownersPaths {
+		b, err := ioutil.ReadFile(filepath.Join(cloneOutput.ClonedIntoDir, p))
+		if err == nil {
+			return defaultCodeowner(string(b))
+		}
+	}
+	return ""
+}
+
+// defaultCodeowner returns the first top-level owner in a CODEOWNERS file, see initialize.TopLevelOwners
+func defaultCodeowner(codeowners string) string {
+	if owners := initialize.TopLevelOwners(codeowners); len(owners) > 0 {
+		return owners[0]
+	}
+	return ""
+}
+
+// teamMergeCaps limits how many repos each team has merged in a run, see --max-merges-per-team
+type teamMergeCaps struct {
+	sync.Mutex
+	max    int
+	merged map[string]int
+}
+
+// reserve claims one of a team's merges, returning false if the team is at its cap.
+// Repos without an owning team aren't capped.
+func (c *teamMergeCaps) reserve(team string) bool {
+	if c.max <= 0 || team == "" {
+		return true
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.merged[team] >= c.max {
+		return false
+	}
+	c.merged[team]++
+	return true
+}
+
+// release gives back a merge reserved by a repo that didn't merge, e.g. because it failed a gate
+func (c *teamMergeCaps) release(team string) {
+	if c.max <= 0 || team == "" {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.merged[team]--
+}
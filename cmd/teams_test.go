@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultCodeowner(t *testing.T) {
+	assert.Equal(t, "", defaultCodeowner("/docs/ @Clever/docs\n"))
+	assert.Equal(t, "@Clever/infra", defaultCodeowner("# owners\n* @Clever/eng\n*.go @Clever/go\n*   @Clever/infra @alice\n"))
+}
+
+func TestTeamMergeCaps(t *testing.T) {
+	caps := &teamMergeCaps{max: 1, merged: map[string]int{}}
+	assert.True(t, caps.reserve("@Clever/infra"))
+	assert.False(t, caps.reserve("@Clever/infra"))
+	assert.True(t, caps.reserve("@Clever/eng"))
+	assert.True(t, caps.reserve(""))
+	caps.release("@Clever/infra")
+	assert.True(t, caps.reserve("@Clever/infra"))
+}
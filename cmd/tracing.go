@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/Clever/microplane/tracing"
+	"github.com/spf13/cobra"
+)
+
+// otlpEndpointFlag enables tracing, exporting spans to an OpenTelemetry collector, see startTracing
+var otlpEndpointFlag string
+
+// runCtx carries the span of the current run and step, so that per-repo spans and API calls are its children
+var runCtx = context.Background()
+
+var runSpan, stepSpan *tracing.Span
+var endTracingOnce sync.Once
+
+// startTracing starts the root span of a run and, for a step, the step's span.
+// Each repo's part of the step gets a child span in trackProgress, and each Github API call one below that.
+func startTracing(cmd *cobra.Command) {
+	endpoint := otlpEndpointFlag
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	tracing.Configure(endpoint)
+	if !tracing.Enabled() {
+		return
+	}
+	runCtx, runSpan = tracing.Start(context.Background(), "mp "+cmd.Name())
+	runSpan.SetAttribute("command", cmd.Name())
+	if campaignFlag != "" {
+		runSpan.SetAttribute("campaign", campaignFlag)
+	}
+	if _, ok := stepVerbs[cmd.Name()]; ok {
+		runCtx, stepSpan = tracing.Start(runCtx, cmd.Name())
+		stepSpan.SetAttribute("step", cmd.Name())
+	}
+}
+
+// endRun finishes the run's tracing and metrics, recording err as its outcome.
+// Steps call it before exiting with log.Fatal, which skips PersistentPostRun.
+func endRun(err error) {
+	endTracing(err)
+	endMetrics(err)
+}
+
+// endTracing ends the run's spans, recording err as the step's outcome, and exports them
+func endTracing(err error) {
+	endTracingOnce.Do(func() {
+		stepSpan.SetError(err)
+		stepSpan.End()
+		runSpan.SetError(err)
+		runSpan.End()
+		if err := tracing.Flush(); err != nil {
+			log.Printf("WARNING: %s", err.Error())
+		}
+	})
+}
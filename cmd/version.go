@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/spf13/cobra"
+)
+
+var versionFlagCheck bool
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print microplane's version",
+	Args:  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(cliVersion)
+		if !versionFlagCheck {
+			return
+		}
+
+		// Advisory only, so a failure (e.g. when offline) isn't fatal
+		latest, err := latestRelease()
+		if err != nil {
+			log.Printf("unable to check for updates: %s", err.Error())
+			return
+		}
+		if compareVersions(latest, cliVersion) > 0 {
+			fmt.Printf("a newer version is available: %s (running %s), see https://github.com/Clever/microplane/releases\n", latest, cliVersion)
+		} else {
+			fmt.Printf("up to date (latest release is %s)\n", latest)
+		}
+	},
+}
+
+// latestRelease looks up microplane's latest release. Like every other Github call it goes through ghclient,
+// so that the User-Agent, TLS settings and GITHUB_URL apply, e.g. to reach a Github Enterprise mirror of microplane.
+func latestRelease() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := ghclient.New(ctx, ghclient.Discovery)
+	release, _, err := client.Repositories.GetLatestRelease(ctx, "Clever", "microplane")
+	if err != nil {
+		return "", err
+	}
+	return release.GetTagName(), nil
+}
+
+// compareVersions compares dotted versions like "v0.0.15", returning -1, 0, or 1.
+// Non-numeric parts, e.g. in a dev build, compare as 0.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x > y {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
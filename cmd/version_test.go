@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 1, compareVersions("v0.0.16", "0.0.15"))
+	assert.Equal(t, 0, compareVersions("v0.0.15", "0.0.15"))
+	assert.Equal(t, -1, compareVersions("v0.0.9", "0.0.15"))
+	assert.Equal(t, 1, compareVersions("v0.1", "0.0.15"))
+	assert.Equal(t, 1, compareVersions("v0.0.15", "dev"))
+}
+
+func TestLatestRelease(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/Clever/microplane/releases/latest", r.URL.Path)
+		assert.Contains(t, r.Header.Get("User-Agent"), "microplane")
+		fmt.Fprint(w, `{"tag_name": "v0.0.16"}`)
+	}))
+	defer server.Close()
+	ghclient.Configure(server.URL+"/", "token")
+	defer ghclient.Configure("", "")
+
+	latest, err := latestRelease()
+	assert.NoError(t, err)
+	assert.Equal(t, "v0.0.16", latest)
+}
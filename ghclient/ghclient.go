@@ -0,0 +1,187 @@
+package ghclient
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Clever/microplane/metrics"
+	"github.com/Clever/microplane/tracing"
+	"github.com/Clever/microplane/verbosity"
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+// userAgent identifies microplane's requests to Github admins, e.g. in audit logs
+var userAgent = "microplane"
+
+// SetUserAgent sets the User-Agent of Github clients to "microplane/{version}".
+// If campaign is set, it's appended to identify the campaign, e.g. "microplane/0.0.15 (campaign: go-upgrade)".
+func SetUserAgent(version, campaign string) {
+	if version == "" {
+		version = "dev"
+	}
+	userAgent = fmt.Sprintf("microplane/%s", version)
+	if campaign != "" {
+		userAgent += fmt.Sprintf(" (campaign: %s)", campaign)
+	}
+}
+
+// apiVersion, if set, is sent as the X-GitHub-Api-Version header of every request, see SetAPIVersion
+var apiVersion string
+
+// SetAPIVersion pins the Github REST API version, e.g. "2022-11-28", for a Github Enterprise instance that
+// doesn't support the default. If it's empty, GITHUB_API_VERSION is used, and if that's empty, no version is sent
+// and the server uses its default.
+func SetAPIVersion(version string) {
+	if version == "" {
+		version = os.Getenv("GITHUB_API_VERSION")
+	}
+	apiVersion = version
+}
+
+// APIVersion returns the pinned Github REST API version, or "" for the server's default
+func APIVersion() string {
+	return apiVersion
+}
+
+// Identity selects which token a Github client authenticates with
+type Identity int
+
+const (
+	// Discovery is the identity used for read-only operations, e.g. searching for repos in init
+	Discovery Identity = iota
+	// Campaign is the identity used for write operations, e.g. opening and merging PRs
+	Campaign
+	// Approver is the identity that approves the campaign's PRs, see 'mp approve'. It must differ from Campaign,
+	// since Github doesn't allow approving your own PRs.
+	Approver
+)
+
+// urlOverride and tokenOverrides take precedence over the env vars, see Configure and SetToken
+var urlOverride string
+var tokenOverrides = map[Identity]string{}
+
+// Configure overrides the GITHUB_URL and GITHUB_API_TOKEN env vars, e.g. from command line flags.
+// The token is only Discovery's, see Token. Empty values fall back to the env vars.
+func Configure(githubURL, token string) {
+	if githubURL != "" && !strings.HasSuffix(githubURL, "/") {
+		githubURL += "/"
+	}
+	urlOverride = githubURL
+	SetToken(Discovery, token)
+}
+
+// SetToken overrides the env var of an identity's token. An empty token falls back to the env var.
+func SetToken(id Identity, token string) {
+	tokenOverrides[id] = token
+}
+
+// URL returns the Github API URL, or "" for github.com
+func URL() string {
+	if urlOverride != "" {
+		return urlOverride
+	}
+	return os.Getenv("GITHUB_URL")
+}
+
+// Hostname returns the host that repos are cloned from, e.g. "github.com"
+func Hostname() string {
+	if URL() == "" {
+		return "github.com"
+	}
+	baseEndpoint, _ := url.Parse(URL())
+	return baseEndpoint.Hostname()
+}
+
+// Describe summarizes which Github instance and token an identity uses, with the token redacted,
+// so that operators can confirm they're using the intended instance
+func Describe(id Identity) string {
+	apiURL := URL()
+	if apiURL == "" {
+		apiURL = "https://api.github.com/"
+	}
+	return fmt.Sprintf("%s (token %s)", apiURL, redact(Token(id)))
+}
+
+// redact hides all but the last 4 characters of a token
+func redact(token string) string {
+	if token == "" {
+		return "not set"
+	}
+	if len(token) <= 8 {
+		return strings.Repeat("*", len(token))
+	}
+	return strings.Repeat("*", 8) + token[len(token)-4:]
+}
+
+// Token returns the Github token for an identity. A token passed to SetToken overrides the identity's env var:
+// - Discovery uses GITHUB_API_TOKEN
+// - Campaign uses GITHUB_CAMPAIGN_TOKEN, falling back to Discovery's token if it's not set
+// - Approver uses GITHUB_APPROVER_TOKEN, without a fallback
+func Token(id Identity) string {
+	if token := tokenOverrides[id]; token != "" {
+		return token
+	}
+	if id == Approver {
+		return os.Getenv("GITHUB_APPROVER_TOKEN")
+	}
+	if id == Campaign {
+		if token := os.Getenv("GITHUB_CAMPAIGN_TOKEN"); token != "" {
+			return token
+		}
+		return Token(Discovery)
+	}
+	return os.Getenv("GITHUB_API_TOKEN")
+}
+
+// New creates a Github client for an identity.
+// The GITHUB_URL env var (or Configure) can be set to use a Github Enterprise setup.
+func New(ctx context.Context, id Identity) *github.Client {
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: Token(id)},
+	)
+	if httpClient != nil {
+		// oauth2 wraps the client in the context, rather than http.DefaultClient
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	}
+	tc := oauth2.NewClient(ctx, ts)
+	tc.Transport = quotaTransport{base: metrics.Transport{Base: tracing.Transport{Base: tc.Transport}}}
+	if apiVersion != "" {
+		tc.Transport = apiVersionTransport{base: tc.Transport, version: apiVersion}
+	}
+	if verbosity.IsVerbose() {
+		tc.Transport = loggingTransport{base: tc.Transport}
+	}
+	client := github.NewClient(tc)
+	client.UserAgent = userAgent
+
+	if URL() != "" {
+		if baseEndpoint, uploadEndpoint, err := endpoints(URL()); err == nil {
+			client.BaseURL = baseEndpoint
+			client.UploadURL = uploadEndpoint
+		}
+	}
+	return client
+}
+
+// endpoints resolves the API and upload URLs from a Github API URL. Github Enterprise may be under a path prefix,
+// e.g. "https://corp.example.com/github/api/v3/", so URLs are resolved relative to it rather than concatenated.
+// Github Enterprise's uploads are at /api/uploads/, alongside /api/v3/.
+func endpoints(apiURL string) (base, upload *url.URL, err error) {
+	base, err = url.Parse(apiURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	uploadRef := "upload/"
+	if strings.HasSuffix(base.Path, "/api/v3/") {
+		uploadRef = "../uploads/"
+	}
+	upload = base.ResolveReference(&url.URL{Path: uploadRef})
+	return base, upload, nil
+}
@@ -0,0 +1,78 @@
+package ghclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpoints(t *testing.T) {
+	for _, tc := range []struct {
+		apiURL, base, upload string
+	}{
+		{"https://github.example.com/api/v3/", "https://github.example.com/api/v3/", "https://github.example.com/api/uploads/"},
+		{"https://corp.example.com/github/api/v3/", "https://corp.example.com/github/api/v3/", "https://corp.example.com/github/api/uploads/"},
+		{"https://corp.example.com/github/api/v3", "https://corp.example.com/github/api/v3/", "https://corp.example.com/github/api/uploads/"},
+		{"https://corp.example.com/github/", "https://corp.example.com/github/", "https://corp.example.com/github/upload/"},
+	} {
+		base, upload, err := endpoints(tc.apiURL)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.base, base.String())
+		assert.Equal(t, tc.upload, upload.String())
+	}
+}
+
+func TestAPIVersionTransport(t *testing.T) {
+	var sent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.Header.Get("X-GitHub-Api-Version")
+	}))
+	defer server.Close()
+
+	client := http.Client{Transport: apiVersionTransport{base: http.DefaultTransport, version: "2022-11-28"}}
+	req, err := http.NewRequest("GET", server.URL, nil)
+	assert.NoError(t, err)
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "2022-11-28", sent)
+	assert.Equal(t, "", req.Header.Get("X-GitHub-Api-Version"))
+}
+
+func TestTokenOverrides(t *testing.T) {
+	defer os.Setenv("GITHUB_API_TOKEN", os.Getenv("GITHUB_API_TOKEN"))
+	defer os.Setenv("GITHUB_CAMPAIGN_TOKEN", os.Getenv("GITHUB_CAMPAIGN_TOKEN"))
+	defer Configure("", "")
+	defer SetToken(Campaign, "")
+	os.Setenv("GITHUB_API_TOKEN", "api")
+	os.Setenv("GITHUB_CAMPAIGN_TOKEN", "campaign")
+
+	Configure("", "flag")
+	assert.Equal(t, "flag", Token(Discovery))
+	assert.Equal(t, "campaign", Token(Campaign))
+
+	os.Setenv("GITHUB_CAMPAIGN_TOKEN", "")
+	assert.Equal(t, "flag", Token(Campaign))
+
+	SetToken(Campaign, "campaign flag")
+	assert.Equal(t, "campaign flag", Token(Campaign))
+	assert.Equal(t, "flag", Token(Discovery))
+}
+
+func TestApproverToken(t *testing.T) {
+	defer os.Setenv("GITHUB_API_TOKEN", os.Getenv("GITHUB_API_TOKEN"))
+	defer os.Setenv("GITHUB_APPROVER_TOKEN", os.Getenv("GITHUB_APPROVER_TOKEN"))
+	defer SetToken(Approver, "")
+	os.Setenv("GITHUB_API_TOKEN", "api")
+	os.Setenv("GITHUB_APPROVER_TOKEN", "")
+
+	// the approver must be someone else, so it doesn't fall back to the campaign's token
+	assert.Equal(t, "", Token(Approver))
+	os.Setenv("GITHUB_APPROVER_TOKEN", "approver")
+	assert.Equal(t, "approver", Token(Approver))
+	SetToken(Approver, "approver flag")
+	assert.Equal(t, "approver flag", Token(Approver))
+}
@@ -0,0 +1,41 @@
+package ghclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// httpClient, if set, is the base HTTP client for Github API calls, see ConfigureTLS
+var httpClient *http.Client
+
+// ConfigureTLS sets up TLS for Github API calls, e.g. for Github Enterprise behind an internal CA.
+// caCertPath is a PEM bundle trusted in addition to the system roots.
+// insecure skips certificate verification entirely, and is only meant for development.
+func ConfigureTLS(caCertPath string, insecure bool) error {
+	if caCertPath == "" && !insecure {
+		return nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if caCertPath != "" {
+		pem, err := ioutil.ReadFile(caCertPath)
+		if err != nil {
+			return fmt.Errorf("error reading CA cert: %s", err.Error())
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no PEM certificates found in %s", caCertPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	httpClient = &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}}
+	return nil
+}
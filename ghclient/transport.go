@@ -0,0 +1,83 @@
+package ghclient
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Clever/microplane/verbosity"
+)
+
+// loggingTransport logs the timing and remaining rate limit of each API call
+type loggingTransport struct {
+	base http.RoundTripper
+}
+
+func (t loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		verbosity.Debugf("github: %s %s failed after %s: %s", req.Method, req.URL.Path, time.Since(start), err.Error())
+		return resp, err
+	}
+	verbosity.Debugf("github: %s %s %d (%s) rate limit remaining: %s", req.Method, req.URL.Path, resp.StatusCode,
+		time.Since(start), resp.Header.Get("X-RateLimit-Remaining"))
+	return resp, nil
+}
+
+// apiVersionTransport sets the X-GitHub-Api-Version header of each API call, see SetAPIVersion
+type apiVersionTransport struct {
+	base    http.RoundTripper
+	version string
+}
+
+func (t apiVersionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper mustn't modify the request, so the header is set on a copy
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("X-GitHub-Api-Version", t.version)
+	return t.base.RoundTrip(r)
+}
+
+// quota is the most recently observed Github rate limit, see Quota
+var quota struct {
+	sync.Mutex
+	remaining int
+	reset     time.Time
+	observed  bool
+}
+
+// Quota returns the remaining requests and reset time of the Github rate limit, as of the latest API call.
+// ok is false if no API call has reported it yet.
+func Quota() (remaining int, reset time.Time, ok bool) {
+	quota.Lock()
+	defer quota.Unlock()
+	return quota.remaining, quota.reset, quota.observed
+}
+
+// quotaTransport records the rate limit headers of each API call, see Quota
+type quotaTransport struct {
+	base http.RoundTripper
+}
+
+func (t quotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	remaining, err1 := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	reset, err2 := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err1 == nil && err2 == nil {
+		quota.Lock()
+		quota.remaining = remaining
+		quota.reset = time.Unix(reset, 0)
+		quota.observed = true
+		quota.Unlock()
+	}
+	return resp, nil
+}
@@ -0,0 +1,73 @@
+package initialize
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+)
+
+// cacheFile is where discovery results are cached in the workdir, see Input.CacheTTL
+const cacheFile = "init-cache.json"
+
+type cachedDiscovery struct {
+	Key      string
+	CachedAt time.Time
+	Output   Output
+}
+
+// cacheKey identifies the repos an Input discovers: its query and filters, the contents of its repos file,
+// and the Github or Gitlab instance searched and the token it's searched with, since tokens may see different
+// repos. Changing any of them invalidates the cache. The key is a hash, so the token isn't stored.
+func cacheKey(input Input) string {
+	reposFile := []byte{}
+	if input.ReposFromFile != "" {
+		reposFile, _ = ioutil.ReadFile(input.ReposFromFile)
+	}
+	b, _ := json.Marshal(struct {
+		Query         string
+		RepoProvider  string
+		ReposFile     []byte
+		Topics        []string
+		ExcludeTopics []string
+		Codeowner     string
+		Dependencies  bool
+		GithubURL     string
+		GitlabURL     string
+		GithubToken   string
+		GitlabToken   string
+	}{input.Query, input.RepoProvider, reposFile, input.Topics, input.ExcludeTopics, input.Codeowner, input.Dependencies,
+		ghclient.URL(), os.Getenv("GITLAB_URL"), ghclient.Token(ghclient.Discovery), os.Getenv("GITLAB_API_TOKEN")})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// readCache returns the cached discovery results for an Input, if they're younger than its CacheTTL
+func readCache(input Input, now time.Time) (Output, time.Time, bool) {
+	b, err := ioutil.ReadFile(path.Join(input.WorkDir, cacheFile))
+	if err != nil {
+		return Output{}, time.Time{}, false
+	}
+	var cached cachedDiscovery
+	if err := json.Unmarshal(b, &cached); err != nil || cached.Key != cacheKey(input) || now.Sub(cached.CachedAt) > input.CacheTTL {
+		return Output{}, time.Time{}, false
+	}
+	return cached.Output, cached.CachedAt, true
+}
+
+// writeCache caches the discovery results for an Input
+func writeCache(input Input, output Output, now time.Time) error {
+	b, err := json.MarshalIndent(cachedDiscovery{Key: cacheKey(input), CachedAt: now, Output: output}, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(input.WorkDir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(input.WorkDir, cacheFile), b, 0644)
+}
@@ -0,0 +1,48 @@
+package initialize
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "init-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	input := Input{WorkDir: dir, Query: "org:Clever filename:go.mod", RepoProvider: "github", Topics: []string{"go"}, CacheTTL: time.Hour}
+	output := Output{Repos: []Repo{{Owner: "Clever", Name: "microplane", Provider: "github"}}}
+	_, _, ok := readCache(input, now)
+	assert.False(t, ok)
+
+	assert.NoError(t, writeCache(input, output, now))
+	cached, cachedAt, ok := readCache(input, now.Add(time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, output, cached)
+	assert.True(t, cachedAt.Equal(now))
+
+	// expired
+	_, _, ok = readCache(input, now.Add(2*time.Hour))
+	assert.False(t, ok)
+
+	// a different token, which may not see the same repos
+	defer os.Setenv("GITHUB_API_TOKEN", os.Getenv("GITHUB_API_TOKEN"))
+	os.Setenv("GITHUB_API_TOKEN", "other")
+	_, _, ok = readCache(input, now)
+	assert.False(t, ok)
+	b, err := ioutil.ReadFile(path.Join(dir, cacheFile))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "other")
+
+	// a different filter
+	assert.NoError(t, writeCache(input, output, now))
+	input.Topics = []string{"go", "cli"}
+	_, _, ok = readCache(input, now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,92 @@
+package initialize
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/google/go-github/github"
+)
+
+// CodeownersPaths are where Github looks for a CODEOWNERS file, in order
+var CodeownersPaths = []string{"CODEOWNERS", ".github/CODEOWNERS", "docs/CODEOWNERS"}
+
+// TopLevelOwners returns the owners of the last catch-all (*) rule in a CODEOWNERS file,
+// since later rules take precedence. These own everything not claimed by a more specific rule.
+func TopLevelOwners(codeowners string) []string {
+	owners := []string{}
+	for _, line := range strings.Split(codeowners, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 1 && fields[0] == "*" {
+			owners = fields[1:]
+		}
+	}
+	return owners
+}
+
+// isOwner returns whether owner is one of owners, ignoring case and a leading "@",
+// e.g. "clever/infra" matches "@Clever/infra"
+func isOwner(owners []string, owner string) bool {
+	owner = strings.TrimPrefix(owner, "@")
+	for _, o := range owners {
+		if strings.EqualFold(strings.TrimPrefix(o, "@"), owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterByCodeowner keeps only repos whose CODEOWNERS, on the default branch, has owner as a top-level owner.
+// Repos without a CODEOWNERS file are dropped. It records each kept repo's top-level owners.
+func filterByCodeowner(repos []Repo, owner string) ([]Repo, error) {
+	ctx := context.Background()
+	client := ghclient.New(ctx, ghclient.Discovery)
+
+	filtered := []Repo{}
+	for _, r := range repos {
+		if r.Provider != "github" {
+			return []Repo{}, fmt.Errorf("filtering by CODEOWNERS is only supported for github repos")
+		}
+		codeowners, err := fetchCodeowners(ctx, client, r)
+		if err != nil {
+			return []Repo{}, fmt.Errorf("error reading CODEOWNERS of %s/%s: %s", r.Owner, r.Name, err.Error())
+		}
+		owners := TopLevelOwners(codeowners)
+		if isOwner(owners, owner) {
+			r.Codeowners = owners
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered, nil
+}
+
+// fetchCodeowners returns the first CODEOWNERS file found in CodeownersPaths, or "" if there isn't one
+func fetchCodeowners(ctx context.Context, client *github.Client, r Repo) (string, error) {
+	for _, p := range CodeownersPaths {
+		content, err := fetchFile(ctx, client, r, p)
+		if err != nil || content != "" {
+			return content, err
+		}
+	}
+	return "", nil
+}
+
+// fetchFile returns a file on the repo's default branch, or "" if there isn't one
+func fetchFile(ctx context.Context, client *github.Client, r Repo, path string) (string, error) {
+	file, _, resp, err := client.Repositories.GetContents(ctx, r.Owner, r.Name, path, nil)
+	if resp != nil && resp.StatusCode == 404 {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if file == nil {
+		// a directory
+		return "", nil
+	}
+	return file.GetContent()
+}
@@ -0,0 +1,20 @@
+package initialize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopLevelOwners(t *testing.T) {
+	assert.Equal(t, []string{}, TopLevelOwners("/docs/ @Clever/docs\n"))
+	assert.Equal(t, []string{"@Clever/infra", "@alice"}, TopLevelOwners("# owners\n* @Clever/eng\n*.go @Clever/go\n*   @Clever/infra @alice # default\n"))
+}
+
+func TestIsOwner(t *testing.T) {
+	owners := []string{"@Clever/infra", "@alice"}
+	assert.True(t, isOwner(owners, "clever/infra"))
+	assert.True(t, isOwner(owners, "@Alice"))
+	assert.False(t, isOwner(owners, "@Clever/eng"))
+	assert.False(t, isOwner(nil, "alice"))
+}
@@ -0,0 +1,195 @@
+package initialize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/Clever/microplane/ghclient"
+)
+
+// manifest is what a repo's go.mod and package.json say it provides and requires
+type manifest struct {
+	Provides []string
+	Requires []string
+}
+
+// addDependencies records, on each repo, the other repos it depends on according to their go.mod and package.json.
+// Cycles are broken with a warning, so that the repos can always be merged in dependency order.
+func addDependencies(repos []Repo) ([]Repo, error) {
+	ctx := context.Background()
+	client := ghclient.New(ctx, ghclient.Discovery)
+
+	manifests := map[string]manifest{}
+	for _, r := range repos {
+		if r.Provider != "github" {
+			return []Repo{}, fmt.Errorf("finding dependencies is only supported for github repos")
+		}
+		var m manifest
+		goMod, err := fetchFile(ctx, client, r, "go.mod")
+		if err != nil {
+			return []Repo{}, fmt.Errorf("error reading go.mod of %s/%s: %s", r.Owner, r.Name, err.Error())
+		}
+		if goMod != "" {
+			module, requires := parseGoMod(goMod)
+			if module != "" {
+				m.Provides = append(m.Provides, module)
+			}
+			m.Requires = append(m.Requires, requires...)
+		}
+		packageJSON, err := fetchFile(ctx, client, r, "package.json")
+		if err != nil {
+			return []Repo{}, fmt.Errorf("error reading package.json of %s/%s: %s", r.Owner, r.Name, err.Error())
+		}
+		if packageJSON != "" {
+			name, requires, err := parsePackageJSON(packageJSON)
+			if err != nil {
+				return []Repo{}, fmt.Errorf("error parsing package.json of %s/%s: %s", r.Owner, r.Name, err.Error())
+			}
+			if name != "" {
+				m.Provides = append(m.Provides, name)
+			}
+			m.Requires = append(m.Requires, requires...)
+		}
+		manifests[r.Name] = m
+	}
+
+	linkDependencies(repos, manifests)
+	for _, warning := range breakCycles(repos) {
+		log.Printf("WARNING: %s", warning)
+	}
+	return repos, nil
+}
+
+// parseGoMod returns the module path and required modules of a go.mod
+func parseGoMod(goMod string) (string, []string) {
+	module := ""
+	requires := []string{}
+	inRequire := false
+	for _, line := range strings.Split(goMod, "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case inRequire && fields[0] == ")":
+			inRequire = false
+		case inRequire:
+			requires = append(requires, strings.Trim(fields[0], `"`))
+		case fields[0] == "module" && len(fields) > 1:
+			module = strings.Trim(fields[1], `"`)
+		case fields[0] == "require" && len(fields) > 1 && fields[1] == "(":
+			inRequire = true
+		case fields[0] == "require" && len(fields) > 1:
+			requires = append(requires, strings.Trim(fields[1], `"`))
+		}
+	}
+	return module, requires
+}
+
+// parsePackageJSON returns the package name and all of the packages it depends on, including dev dependencies
+func parsePackageJSON(packageJSON string) (string, []string, error) {
+	var pkg struct {
+		Name                 string
+		Dependencies         map[string]string
+		DevDependencies      map[string]string
+		PeerDependencies     map[string]string
+		OptionalDependencies map[string]string
+	}
+	if err := json.Unmarshal([]byte(packageJSON), &pkg); err != nil {
+		return "", nil, err
+	}
+	requires := []string{}
+	for _, deps := range []map[string]string{pkg.Dependencies, pkg.DevDependencies, pkg.PeerDependencies, pkg.OptionalDependencies} {
+		for name := range deps {
+			requires = append(requires, name)
+		}
+	}
+	sort.Strings(requires)
+	return pkg.Name, requires, nil
+}
+
+// linkDependencies sets each repo's DependsOn to the repos providing what its manifest requires.
+// A Go module also provides its subpackages and nested modules, e.g. example.com/lib provides example.com/lib/v2.
+func linkDependencies(repos []Repo, manifests map[string]manifest) {
+	providers := map[string]string{}
+	for _, r := range repos {
+		for _, p := range manifests[r.Name].Provides {
+			providers[p] = r.Name
+		}
+	}
+	for i, r := range repos {
+		dependsOn := map[string]struct{}{}
+		for _, req := range manifests[r.Name].Requires {
+			for p, provider := range providers {
+				if provider != r.Name && (req == p || strings.HasPrefix(req, p+"/")) {
+					dependsOn[provider] = struct{}{}
+				}
+			}
+		}
+		repos[i].DependsOn = nil
+		for name := range dependsOn {
+			repos[i].DependsOn = append(repos[i].DependsOn, name)
+		}
+		sort.Strings(repos[i].DependsOn)
+	}
+}
+
+// breakCycles removes dependencies that close a cycle, returning a warning for each.
+// Repos are visited in order, so the dependency that's dropped is the same from run to run.
+func breakCycles(repos []Repo) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	index := map[string]int{}
+	for i, r := range repos {
+		index[r.Name] = i
+	}
+	state := map[string]int{}
+	stack := []string{}
+	warnings := []string{}
+
+	var visit func(i int)
+	visit = func(i int) {
+		name := repos[i].Name
+		state[name] = visiting
+		stack = append(stack, name)
+		var kept []string
+		for _, dep := range repos[i].DependsOn {
+			switch state[dep] {
+			case visiting:
+				cycle := []string{}
+				for j := len(stack) - 1; j >= 0; j-- {
+					if stack[j] == dep {
+						cycle = append(append(cycle, stack[j:]...), dep)
+						break
+					}
+				}
+				warnings = append(warnings, fmt.Sprintf("dependency cycle %s, ignoring that %s depends on %s", strings.Join(cycle, " -> "), name, dep))
+				continue
+			case unvisited:
+				if j, ok := index[dep]; ok {
+					visit(j)
+				}
+			}
+			kept = append(kept, dep)
+		}
+		repos[i].DependsOn = kept
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+	}
+	for i, r := range repos {
+		if state[r.Name] == unvisited {
+			visit(i)
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,64 @@
+package initialize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGoMod(t *testing.T) {
+	module, requires := parseGoMod(`module github.com/Clever/app // the app
+
+go 1.12
+
+require github.com/Clever/kayvee-go/v7 v7.1.0
+
+require (
+	// logging
+	github.com/Clever/wag v1.2.3
+	"golang.org/x/sync" v0.0.0 // indirect
+)
+`)
+	assert.Equal(t, "github.com/Clever/app", module)
+	assert.Equal(t, []string{"github.com/Clever/kayvee-go/v7", "github.com/Clever/wag", "golang.org/x/sync"}, requires)
+}
+
+func TestParsePackageJSON(t *testing.T) {
+	name, requires, err := parsePackageJSON(`{"name": "@clever/app", "dependencies": {"react": "^16", "@clever/components": "^2"}, "devDependencies": {"@clever/lint": "^1"}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "@clever/app", name)
+	assert.Equal(t, []string{"@clever/components", "@clever/lint", "react"}, requires)
+
+	_, _, err = parsePackageJSON("{")
+	assert.Error(t, err)
+}
+
+func TestLinkDependencies(t *testing.T) {
+	repos := []Repo{{Name: "app"}, {Name: "components"}, {Name: "kayvee-go"}}
+	linkDependencies(repos, map[string]manifest{
+		"app": {
+			Provides: []string{"github.com/Clever/app", "@clever/app"},
+			Requires: []string{"github.com/Clever/kayvee-go/v7/logger", "@clever/components", "react"},
+		},
+		"components": {Provides: []string{"@clever/components"}, Requires: []string{"react"}},
+		"kayvee-go":  {Provides: []string{"github.com/Clever/kayvee-go/v7"}, Requires: []string{"github.com/Clever/kayvee-go/v7/logger"}},
+	})
+	assert.Equal(t, []string{"components", "kayvee-go"}, repos[0].DependsOn)
+	assert.Nil(t, repos[1].DependsOn)
+	assert.Nil(t, repos[2].DependsOn)
+}
+
+func TestBreakCycles(t *testing.T) {
+	repos := []Repo{
+		{Name: "a", DependsOn: []string{"b"}},
+		{Name: "b", DependsOn: []string{"c"}},
+		{Name: "c", DependsOn: []string{"a", "d"}},
+		{Name: "d"},
+	}
+	warnings := breakCycles(repos)
+	assert.Equal(t, []string{"dependency cycle a -> b -> c -> a, ignoring that c depends on a"}, warnings)
+	assert.Equal(t, []string{"b"}, repos[0].DependsOn)
+	assert.Equal(t, []string{"c"}, repos[1].DependsOn)
+	assert.Equal(t, []string{"d"}, repos[2].DependsOn)
+	assert.Nil(t, repos[3].DependsOn)
+}
@@ -7,12 +7,12 @@ import (
 	"log"
 	"os"
 	"sort"
-  "strings"
-	"net/url"
+	"strings"
+	"time"
 
+	"github.com/Clever/microplane/ghclient"
 	"github.com/google/go-github/github"
 	gitlab "github.com/xanzy/go-gitlab"
-	"golang.org/x/oauth2"
 )
 
 // Repo describes a GithubRepository
@@ -21,6 +21,14 @@ type Repo struct {
 	Owner    string
 	CloneURL string
 	Provider string
+	// Topics of the repo, if filtering by topic
+	Topics []string `json:",omitempty"`
+	// Source is where the repo was first found, e.g. "file" or "search"
+	Source string `json:",omitempty"`
+	// Codeowners are the repo's top-level CODEOWNERS, if filtering by owner
+	Codeowners []string `json:",omitempty"`
+	// DependsOn are the other repos that this one depends on, if finding dependencies
+	DependsOn []string `json:",omitempty"`
 }
 
 // Input for Initialize
@@ -30,12 +38,33 @@ type Input struct {
 	Version       string
 	RepoProvider  string
 	ReposFromFile string
+	// Topics that repos must all have
+	Topics []string
+	// ExcludeTopics that repos must not have
+	ExcludeTopics []string
+	// RepoLimiter, if set, paces the per-repo API calls of filtering by topic
+	RepoLimiter *time.Ticker
+	// Codeowner, if set, is a team or user that must be a top-level owner in repos' CODEOWNERS,
+	// e.g. "@Clever/infra"
+	Codeowner string
+	// Dependencies finds which repos depend on each other, from their go.mod and package.json
+	Dependencies bool
+	// CacheTTL, if set, reuses the repos discovered by an earlier run with the same query and filters,
+	// if it was within this long. Refresh discovers them again regardless.
+	CacheTTL time.Duration
+	Refresh  bool
 }
 
 // Output for Initialize
 type Output struct {
 	Version string
 	Repos   []Repo
+	// Duplicates is the number of repos found more than once, e.g. by both the file and the search
+	Duplicates int `json:",omitempty"`
+	// RunID identifies the campaign in the footer of the PRs and commits it creates, see push.RunIDFooter
+	RunID string `json:",omitempty"`
+	// CachedAt is when the repos were discovered, if they came from the cache, see Input.CacheTTL
+	CachedAt time.Time `json:"-"`
 }
 
 // ByName allows sorting repos by name
@@ -45,47 +74,103 @@ func (a ByName) Len() int           { return len(a) }
 func (a ByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByName) Less(i, j int) bool { return a[i].Name < a[j].Name }
 
-// Initialize searches Github for matching repos
+// Initialize searches Github for matching repos, and/or reads them from a file.
+// The results are cached, see Input.CacheTTL.
 func Initialize(input Input) (Output, error) {
-	var repos []Repo
-	var err error
+	if input.CacheTTL > 0 && !input.Refresh {
+		if output, cachedAt, ok := readCache(input, time.Now()); ok {
+			output.Version = input.Version
+			output.CachedAt = cachedAt
+			return output, nil
+		}
+	}
+	output, err := discover(input)
+	if err != nil || input.CacheTTL <= 0 {
+		return output, err
+	}
+	if err := writeCache(input, output, time.Now()); err != nil {
+		log.Printf("WARNING: failed to cache discovered repos: %s", err.Error())
+	}
+	return output, nil
+}
+
+// discover finds the repos to target, see Initialize
+func discover(input Input) (Output, error) {
+	repos := []Repo{}
 	if input.ReposFromFile != "" {
 		// Read repos from file
-		repos, err = reposFromFile(input)
-	} else {
+		fromFile, err := reposFromFile(input)
+		if err != nil {
+			return Output{}, err
+		}
+		repos = append(repos, fromFile...)
+	}
+	if input.Query != "" {
 		// Do code search
+		var found []Repo
+		var err error
 		if input.RepoProvider == "github" {
-			repos, err = githubSearch(input.Query)
+			found, err = githubSearch(input.Query)
 		} else if input.RepoProvider == "gitlab" {
-			repos, err = gitlabSearch(input.Query)
+			found, err = gitlabSearch(input.Query)
 		}
+		if err != nil {
+			return Output{}, err
+		}
+		for i := range found {
+			found[i].Source = "search"
+		}
+		repos = append(repos, found...)
 	}
 
-	if err != nil {
-		return Output{}, err
-	}
-
+	// dedupe before sorting, so that the first source a repo was found in is kept
+	repos, duplicates := dedupe(repos)
 	sort.Sort(ByName(repos))
-	repos = dedupe(repos)
+
+	if len(input.Topics) > 0 || len(input.ExcludeTopics) > 0 {
+		filtered, err := filterByTopics(repos, input.Topics, input.ExcludeTopics, input.RepoLimiter)
+		if err != nil {
+			return Output{}, err
+		}
+		repos = filtered
+	}
+	if input.Codeowner != "" {
+		filtered, err := filterByCodeowner(repos, input.Codeowner)
+		if err != nil {
+			return Output{}, err
+		}
+		repos = filtered
+	}
+	if input.Dependencies {
+		withDependencies, err := addDependencies(repos)
+		if err != nil {
+			return Output{}, err
+		}
+		repos = withDependencies
+	}
 	return Output{
-		Version: input.Version,
-		Repos:   repos,
+		Version:    input.Version,
+		Repos:      repos,
+		Duplicates: duplicates,
 	}, nil
 }
 
-func dedupe(repos []Repo) []Repo {
+// dedupe removes repos that appear more than once, keeping the first.
+// Repos are compared case-insensitively, like Github does.
+func dedupe(repos []Repo) ([]Repo, int) {
 	out := []Repo{}
-	seen := map[Repo]struct{}{}
+	seen := map[string]struct{}{}
 
 	for _, r := range repos {
-		_, isDupe := seen[r]
+		key := strings.ToLower(fmt.Sprintf("%s/%s", r.Owner, r.Name))
+		_, isDupe := seen[key]
 		if isDupe {
 			continue
 		}
-		seen[r] = struct{}{}
+		seen[key] = struct{}{}
 		out = append(out, r)
 	}
-	return out
+	return out, len(repos) - len(out)
 }
 
 func reposFromFile(input Input) ([]Repo, error) {
@@ -111,6 +196,7 @@ func reposFromFile(input Input) ([]Repo, error) {
 			Name:     parts[1],
 			CloneURL: fmt.Sprintf("git@%s.com:%s", input.RepoProvider, item),
 			Provider: input.RepoProvider,
+			Source:   "file",
 		})
 	}
 	return repos, nil
@@ -121,20 +207,7 @@ func reposFromFile(input Input) ([]Repo, error) {
 // GitHub Code Search Syntax:
 // https://help.github.com/articles/searching-code/
 func githubSearch(query string) ([]Repo, error) {
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: os.Getenv("GITHUB_API_TOKEN")},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-
-	client := github.NewClient(tc)
-
-	if os.Getenv("GITHUB_URL") != "" {
-		baseEndpoint, _ := url.Parse(os.Getenv("GITHUB_URL"))
-		client.BaseURL = baseEndpoint
-		uploadEndpoint, _ := url.Parse(os.Getenv("GITHUB_URL") + "upload/")
-		client.UploadURL = uploadEndpoint
-	}
+	client := ghclient.New(context.Background(), ghclient.Discovery)
 
 	opts := &github.SearchOptions{}
 	allRepos := map[string]*github.Repository{}
@@ -148,7 +221,7 @@ func githubSearch(query string) ([]Repo, error) {
 		for _, codeResult := range result.CodeResults {
 			numProcessedResults = numProcessedResults + 1
 			repoCopy := *codeResult.Repository
-			allRepos[*codeResult.Repository.Name] = &repoCopy
+			allRepos[strings.ToLower(codeResult.Repository.GetFullName())] = &repoCopy
 		}
 
 		incompleteResults := result.GetIncompleteResults()
@@ -163,11 +236,7 @@ func githubSearch(query string) ([]Repo, error) {
 		opts.Page = resp.NextPage
 	}
 
-	hostname := "github.com"
-	if os.Getenv("GITHUB_URL") != "" {
-		baseEndpoint, _ := url.Parse(os.Getenv("GITHUB_URL"))
-		hostname = baseEndpoint.Hostname()
-	}
+	hostname := ghclient.Hostname()
 
 	repos := []Repo{}
 	for _, r := range allRepos {
@@ -0,0 +1,22 @@
+package initialize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupe(t *testing.T) {
+	repos, duplicates := dedupe([]Repo{
+		{Owner: "Clever", Name: "microplane", Source: "file"},
+		{Owner: "clever", Name: "Microplane", Source: "search"},
+		{Owner: "Clever", Name: "other", Source: "search"},
+		{Owner: "Other", Name: "microplane", Source: "search"},
+	})
+	assert.Equal(t, 1, duplicates)
+	assert.Equal(t, []Repo{
+		{Owner: "Clever", Name: "microplane", Source: "file"},
+		{Owner: "Clever", Name: "other", Source: "search"},
+		{Owner: "Other", Name: "microplane", Source: "search"},
+	}, repos)
+}
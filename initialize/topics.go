@@ -0,0 +1,66 @@
+package initialize
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+)
+
+// filterByTopics keeps only repos that have all of the topics, and none of the excluded topics.
+// It records each kept repo's topics. Each repo's topics are a separate API call, so they wait for repoLimiter.
+func filterByTopics(repos []Repo, topics, excludeTopics []string, repoLimiter *time.Ticker) ([]Repo, error) {
+	ctx := context.Background()
+	client := ghclient.New(ctx, ghclient.Discovery)
+	// Github stores topics in lowercase
+	topics, excludeTopics = lowercase(topics), lowercase(excludeTopics)
+
+	filtered := []Repo{}
+	for _, r := range repos {
+		if r.Provider != "github" {
+			return []Repo{}, fmt.Errorf("filtering by topic is only supported for github repos")
+		}
+		if repoLimiter != nil {
+			<-repoLimiter.C
+		}
+		// Topics are a preview API, which go-github requests with the required Accept header
+		repoTopics, _, err := client.Repositories.ListAllTopics(ctx, r.Owner, r.Name)
+		if err != nil {
+			return []Repo{}, fmt.Errorf("error listing topics of %s/%s: %s", r.Owner, r.Name, err.Error())
+		}
+		if hasTopics(repoTopics, topics, excludeTopics) {
+			r.Topics = repoTopics
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered, nil
+}
+
+func lowercase(values []string) []string {
+	lowered := []string{}
+	for _, v := range values {
+		lowered = append(lowered, strings.ToLower(v))
+	}
+	return lowered
+}
+
+// hasTopics returns whether repoTopics includes all of topics, and none of excludeTopics
+func hasTopics(repoTopics, topics, excludeTopics []string) bool {
+	has := map[string]bool{}
+	for _, t := range repoTopics {
+		has[t] = true
+	}
+	for _, t := range topics {
+		if !has[t] {
+			return false
+		}
+	}
+	for _, t := range excludeTopics {
+		if has[t] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package initialize
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasTopics(t *testing.T) {
+	repoTopics := []string{"tier-1", "go"}
+	assert.True(t, hasTopics(repoTopics, nil, nil))
+	assert.True(t, hasTopics(repoTopics, []string{"tier-1"}, nil))
+	assert.True(t, hasTopics(repoTopics, []string{"tier-1", "go"}, []string{"deprecated"}))
+	assert.False(t, hasTopics(repoTopics, []string{"tier-1", "node"}, nil))
+	assert.False(t, hasTopics(repoTopics, []string{"tier-1"}, []string{"go"}))
+	assert.False(t, hasTopics(nil, []string{"tier-1"}, nil))
+}
+
+func TestFilterByTopics(t *testing.T) {
+	topics := map[string]string{
+		"/repos/Clever/microplane/topics": `{"names": ["tier-1", "go"]}`,
+		"/repos/Clever/sphinx/topics":     `{"names": ["go", "deprecated"]}`,
+	}
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprint(w, topics[r.URL.Path])
+	}))
+	defer server.Close()
+	ghclient.Configure(server.URL+"/", "token")
+	defer ghclient.Configure("", "")
+	limiter := time.NewTicker(time.Millisecond)
+	defer limiter.Stop()
+
+	repos := []Repo{{Owner: "Clever", Name: "microplane", Provider: "github"}, {Owner: "Clever", Name: "sphinx", Provider: "github"}}
+	// flag values match regardless of case, since Github stores topics in lowercase
+	filtered, err := filterByTopics(repos, []string{"Go"}, []string{"DEPRECATED"}, limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, []Repo{{Owner: "Clever", Name: "microplane", Provider: "github", Topics: []string{"tier-1", "go"}}}, filtered)
+	assert.Equal(t, 2, calls)
+
+	_, err = filterByTopics([]Repo{{Owner: "Clever", Name: "microplane", Provider: "gitlab"}}, []string{"go"}, nil, limiter)
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/Clever/microplane/push"
+	"github.com/google/go-github/github"
+)
+
+// AbandonOutput is what abandoning a PR did. Closing and deleting are skipped if they were already done,
+// so abandoning again is safe.
+type AbandonOutput struct {
+	Number int
+	// Closed records that the PR was closed by this run, rather than already closed
+	Closed bool
+	// AlreadyMerged records that the PR was merged, so it was left alone
+	AlreadyMerged bool `json:",omitempty"`
+	// DeletedBranch is the PR's head branch, if it was deleted by this run
+	DeletedBranch string `json:",omitempty"`
+	// AlreadyDeletedBranch is the PR's head branch, if it was already deleted, so it was skipped
+	AlreadyDeletedBranch string `json:",omitempty"`
+}
+
+func (o AbandonOutput) String() string {
+	if o.AlreadyMerged {
+		return fmt.Sprintf("#%d already merged, left alone", o.Number)
+	}
+	s := fmt.Sprintf("#%d already closed", o.Number)
+	if o.Closed {
+		s = fmt.Sprintf("closed #%d", o.Number)
+	}
+	if o.DeletedBranch != "" {
+		s += ", deleted branch " + o.DeletedBranch
+	}
+	if o.AlreadyDeletedBranch != "" {
+		s += ", branch " + o.AlreadyDeletedBranch + " already deleted"
+	}
+	return s
+}
+
+// GitHubAbandon closes a PR, commenting why if comment is set, and deletes its head branch.
+// The PR's head branch must start with branchPrefix, or its body must have runID's footer, so that a PR number
+// that was reused or mistyped never closes someone else's PR.
+func GitHubAbandon(ctx context.Context, org, repo string, number int, branchPrefix, runID, comment string, repoLimiter *time.Ticker) (AbandonOutput, error) {
+	client := ghclient.New(ctx, ghclient.Campaign)
+	output := AbandonOutput{Number: number}
+
+	<-repoLimiter.C
+	pr, _, err := client.PullRequests.Get(ctx, org, repo, number)
+	if err != nil {
+		return output, err
+	}
+	branch := pr.GetHead().GetRef()
+	fromRun := runID != "" && push.ParseRunID(pr.GetBody()) == runID
+	fromBranch := branchPrefix != "" && strings.HasPrefix(branch, branchPrefix)
+	if !fromBranch && !fromRun {
+		return output, fmt.Errorf("PR #%d is from branch %s, not microplane's %s", number, branch, branchPrefix)
+	}
+	if pr.GetMerged() {
+		output.AlreadyMerged = true
+		return output, nil
+	}
+
+	if pr.GetState() == "open" {
+		if comment != "" {
+			<-repoLimiter.C
+			if _, _, err := client.Issues.CreateComment(ctx, org, repo, number, &github.IssueComment{Body: &comment}); err != nil {
+				return output, err
+			}
+		}
+		state := "closed"
+		<-repoLimiter.C
+		if _, _, err := client.PullRequests.Edit(ctx, org, repo, number, &github.PullRequest{State: &state}); err != nil {
+			return output, err
+		}
+		output.Closed = true
+	}
+
+	// a PR from a fork's branch isn't ours to delete
+	if pr.GetHead().GetRepo().GetFullName() != pr.GetBase().GetRepo().GetFullName() {
+		return output, nil
+	}
+	deleted, err := deleteBranch(ctx, client, org, repo, branch, DefaultRetryPolicy, repoLimiter)
+	if err != nil {
+		return output, fmt.Errorf("closed PR #%d, but failed to delete branch %s: %s", number, branch, err.Error())
+	}
+	if deleted {
+		output.DeletedBranch = branch
+	} else {
+		output.AlreadyDeletedBranch = branch
+	}
+	return output, nil
+}
@@ -0,0 +1,68 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/google/go-github/github"
+)
+
+// adminRestoreTimeout bounds restoring admin enforcement. The restore has its own context, so that it
+// still happens if the run's context was canceled mid-merge, e.g. by --timeout or Ctrl-C.
+const adminRestoreTimeout = 30 * time.Second
+
+// liftAdminEnforcement stops enforcing a branch's protection rules for admins, so that an admin's merge bypasses them.
+// It returns a func that restores the previous enforcement, which must always be called.
+// The lifted enforcement is recorded with input.RecordAdminEnforcement until it's restored.
+func liftAdminEnforcement(ctx context.Context, client *github.Client, input Input, branch string, repoLimiter *time.Ticker) (restore func() error, err error) {
+	noop := func() error { return nil }
+
+	<-repoLimiter.C
+	enforcement, resp, err := client.Repositories.GetAdminEnforcement(ctx, input.Org, input.Repo, branch)
+	if err != nil {
+		if notProtected(resp) {
+			return noop, nil
+		}
+		return nil, err
+	}
+	if !enforcement.Enabled {
+		// admins already bypass protection
+		return noop, nil
+	}
+
+	record := input.RecordAdminEnforcement
+	if record == nil {
+		record = func(string, bool) error { return nil }
+	}
+	if err := record(branch, true); err != nil {
+		return nil, fmt.Errorf("failed to record lifting branch protection for admins: %s", err.Error())
+	}
+	<-repoLimiter.C
+	if _, err := client.Repositories.RemoveAdminEnforcement(ctx, input.Org, input.Repo, branch); err != nil {
+		record(branch, false)
+		return nil, err
+	}
+	return func() error {
+		restoreCtx, cancel := context.WithTimeout(context.Background(), adminRestoreTimeout)
+		defer cancel()
+		if err := restoreAdminEnforcement(restoreCtx, client, input.Org, input.Repo, branch, repoLimiter); err != nil {
+			return err
+		}
+		return record(branch, false)
+	}, nil
+}
+
+func restoreAdminEnforcement(ctx context.Context, client *github.Client, org, repo, branch string, repoLimiter *time.Ticker) error {
+	<-repoLimiter.C
+	_, _, err := client.Repositories.AddAdminEnforcement(ctx, org, repo, branch)
+	return err
+}
+
+// GitHubRestoreAdminEnforcement restores the admin enforcement of a branch that an earlier merge lifted,
+// but didn't restore, e.g. because it crashed, see Input.RecordAdminEnforcement
+func GitHubRestoreAdminEnforcement(ctx context.Context, org, repo, branch string, repoLimiter *time.Ticker) error {
+	client := ghclient.New(ctx, ghclient.Campaign)
+	return restoreAdminEnforcement(ctx, client, org, repo, branch, repoLimiter)
+}
@@ -0,0 +1,79 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// testGitHubClient is a client for a fake Github API served by handler. close stops the server.
+func testGitHubClient(handler http.Handler) (client *github.Client, close func()) {
+	server := httptest.NewServer(handler)
+	client = github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, server.Close
+}
+
+func TestLiftAdminEnforcementRestoresAfterCancel(t *testing.T) {
+	enforced := true
+	client, close := testGitHubClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/Clever/microplane/branches/main/protection/enforce_admins", r.URL.Path)
+		switch r.Method {
+		case "GET":
+			fmt.Fprintf(w, `{"enabled": %t}`, enforced)
+		case "DELETE":
+			enforced = false
+			w.WriteHeader(http.StatusNoContent)
+		case "POST":
+			enforced = true
+			fmt.Fprint(w, `{"enabled": true}`)
+		}
+	}))
+	defer close()
+	limiter := time.NewTicker(time.Millisecond)
+	defer limiter.Stop()
+
+	recorded := []bool{}
+	input := Input{Org: "Clever", Repo: "microplane", RecordAdminEnforcement: func(branch string, lifted bool) error {
+		assert.Equal(t, "main", branch)
+		recorded = append(recorded, lifted)
+		return nil
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	restore, err := liftAdminEnforcement(ctx, client, input, "main", limiter)
+	assert.NoError(t, err)
+	assert.False(t, enforced)
+	assert.Equal(t, []bool{true}, recorded)
+
+	// e.g. --timeout was reached while merging
+	cancel()
+	assert.NoError(t, restore())
+	assert.True(t, enforced)
+	assert.Equal(t, []bool{true, false}, recorded)
+}
+
+func TestUnprotectedBranch(t *testing.T) {
+	client, close := testGitHubClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Branch not protected"}`)
+	}))
+	defer close()
+	limiter := time.NewTicker(time.Millisecond)
+	defer limiter.Stop()
+	input := Input{Org: "Clever", Repo: "microplane", MinApprovals: 2, Retry: RetryPolicy{MaxAttempts: 1}, RecordAdminEnforcement: func(branch string, lifted bool) error {
+		t.Errorf("recorded enforcement of an unprotected branch")
+		return nil
+	}}
+
+	restore, err := liftAdminEnforcement(context.Background(), client, input, "main", limiter)
+	assert.NoError(t, err)
+	assert.NoError(t, restore())
+	assert.Equal(t, 2, requiredApprovals(context.Background(), client, input, "main", limiter))
+}
@@ -0,0 +1,79 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// selfApprovalError returns an error unless the PR has been approved by someone other than the excluded users,
+// e.g. the PR's author and the token user, so that automated changes get a real second pair of eyes
+func selfApprovalError(reviews []*github.PullRequestReview, excluded []string) error {
+	for _, r := range reviews {
+		if r.GetState() != "APPROVED" {
+			continue
+		}
+		self := false
+		for _, login := range excluded {
+			if login != "" && strings.EqualFold(r.GetUser().GetLogin(), login) {
+				self = true
+			}
+		}
+		if !self {
+			return nil
+		}
+	}
+	return fmt.Errorf("PR is not approved by anyone other than its author or operator (%s)", strings.Join(nonEmpty(excluded), ", "))
+}
+
+// changesRequestedError returns an error if any reviewer's latest review requests changes.
+// Comments don't change a reviewer's state, and a dismissed review clears it.
+func changesRequestedError(reviews []*github.PullRequestReview) error {
+	latest := map[string]string{}
+	order := []string{}
+	for _, r := range reviews {
+		state := r.GetState()
+		if state == "COMMENTED" || state == "PENDING" {
+			continue
+		}
+		login := strings.ToLower(r.GetUser().GetLogin())
+		if _, ok := latest[login]; !ok {
+			order = append(order, login)
+		}
+		latest[login] = state
+	}
+	requested := []string{}
+	for _, login := range order {
+		if latest[login] == "CHANGES_REQUESTED" {
+			requested = append(requested, login)
+		}
+	}
+	if len(requested) > 0 {
+		return fmt.Errorf("changes requested by %s", strings.Join(requested, ", "))
+	}
+	return nil
+}
+
+func nonEmpty(ss []string) []string {
+	out := []string{}
+	for _, s := range ss {
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// selfApprovers are the users whose approvals don't count when Input.ProhibitSelfApproval is set:
+// the PR's author, the token user and the operator
+func selfApprovers(ctx context.Context, client *github.Client, input Input, pr *github.PullRequest, repoLimiter *time.Ticker) ([]string, error) {
+	<-repoLimiter.C
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return []string{pr.GetUser().GetLogin(), user.GetLogin(), input.Operator}, nil
+}
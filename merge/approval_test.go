@@ -0,0 +1,40 @@
+package merge
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func review(login, state string) *github.PullRequestReview {
+	return &github.PullRequestReview{User: &github.User{Login: &login}, State: &state}
+}
+
+func TestSelfApprovalError(t *testing.T) {
+	excluded := []string{"mp-bot", "operator", ""}
+
+	assert.Error(t, selfApprovalError(nil, excluded))
+	assert.Error(t, selfApprovalError([]*github.PullRequestReview{review("mp-bot", "APPROVED"), review("Operator", "APPROVED")}, excluded))
+	assert.Error(t, selfApprovalError([]*github.PullRequestReview{review("reviewer", "COMMENTED")}, excluded))
+	assert.NoError(t, selfApprovalError([]*github.PullRequestReview{review("operator", "APPROVED"), review("reviewer", "APPROVED")}, excluded))
+}
+
+func TestChangesRequestedError(t *testing.T) {
+	assert.NoError(t, changesRequestedError(nil))
+	assert.NoError(t, changesRequestedError([]*github.PullRequestReview{review("a", "CHANGES_REQUESTED"), review("a", "APPROVED")}))
+	assert.NoError(t, changesRequestedError([]*github.PullRequestReview{review("a", "CHANGES_REQUESTED"), review("a", "DISMISSED")}))
+	err := changesRequestedError([]*github.PullRequestReview{review("a", "APPROVED"), review("B", "CHANGES_REQUESTED"), review("b", "COMMENTED")})
+	if assert.Error(t, err) {
+		assert.Equal(t, "changes requested by b", err.Error())
+	}
+}
+
+func TestApprovalError(t *testing.T) {
+	assert.EqualError(t, approvalError(nil, 1), "PR awaiting review")
+	assert.EqualError(t, approvalError([]*github.PullRequestReview{review("a", "APPROVED"), review("b", "COMMENTED")}, 1), "PR is not approved. Review state is COMMENTED")
+	assert.NoError(t, approvalError([]*github.PullRequestReview{review("a", "APPROVED")}, 0))
+	assert.NoError(t, approvalError([]*github.PullRequestReview{review("a", "APPROVED")}, 1))
+	assert.EqualError(t, approvalError([]*github.PullRequestReview{review("a", "APPROVED"), review("A", "APPROVED")}, 2), "PR awaiting review: 1 of 2 required approvals")
+	assert.NoError(t, approvalError([]*github.PullRequestReview{review("a", "APPROVED"), review("b", "APPROVED")}, 2))
+}
@@ -0,0 +1,113 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/google/go-github/github"
+)
+
+// ApproveCriteria are what a PR must meet for GitHubApprove to approve it
+type ApproveCriteria struct {
+	// RequireBuildSuccess only approves PRs whose build is green, see Input.RequireBuildSuccess
+	RequireBuildSuccess bool
+	// MaxDiffLines, if set, only approves PRs changing at most this many lines, counting additions and deletions
+	MaxDiffLines int
+	// Body is the text of the approving review
+	Body string
+}
+
+// diffSizeError returns why a PR is too big to approve, or nil if it isn't
+func diffSizeError(pr *github.PullRequest, maxLines int) error {
+	lines := pr.GetAdditions() + pr.GetDeletions()
+	if maxLines > 0 && lines > maxLines {
+		return fmt.Errorf("PR changes %d lines, more than the maximum of %d", lines, maxLines)
+	}
+	return nil
+}
+
+// approvedBy returns whether a user's latest review approves a commit
+func approvedBy(reviews []*github.PullRequestReview, login, sha string) bool {
+	approved := false
+	for _, r := range reviews {
+		if !strings.EqualFold(r.GetUser().GetLogin(), login) {
+			continue
+		}
+		switch r.GetState() {
+		case "APPROVED":
+			approved = r.GetCommitID() == sha
+		case "CHANGES_REQUESTED", "DISMISSED":
+			approved = false
+		}
+	}
+	return approved
+}
+
+// GitHubApprove submits an approving review on a PR, as the ghclient.Approver user, whose login is given,
+// if it meets the criteria. It returns false without approving if the approver has already approved the PR's
+// head commit. An error means the PR wasn't approved, e.g. because it doesn't meet the criteria.
+func GitHubApprove(ctx context.Context, input Input, criteria ApproveCriteria, login string, repoLimiter *time.Ticker) (bool, error) {
+	client := ghclient.New(ctx, ghclient.Approver)
+	pr, err := getPR(ctx, client, input, repoLimiter)
+	if err != nil {
+		return false, err
+	}
+	if pr.GetState() != "open" {
+		return false, fmt.Errorf("PR is %s", pr.GetState())
+	}
+	head := pr.GetHead().GetSHA()
+	if input.ExpectedHeadSHA != "" && head != input.ExpectedHeadSHA {
+		return false, fmt.Errorf("PR head is %s, not the pushed commit %s, so it may contain changes microplane didn't make", head, input.ExpectedHeadSHA)
+	}
+	if err := diffSizeError(pr, criteria.MaxDiffLines); err != nil {
+		return false, err
+	}
+
+	if strings.EqualFold(pr.GetUser().GetLogin(), login) {
+		return false, fmt.Errorf("%s opened this PR, and Github doesn't allow approving your own PR. Use another user's token as the approver's", login)
+	}
+
+	input.CommitSHA = head
+	if criteria.RequireBuildSuccess {
+		status, err := combinedStatus(ctx, client, input, repoLimiter)
+		if err != nil {
+			return false, err
+		}
+		state, reason, err := buildStateWithChecks(ctx, client, input, status, func() (time.Time, error) {
+			return headPushedAt(ctx, client, input, pr, repoLimiter)
+		}, repoLimiter)
+		if err != nil {
+			return false, err
+		}
+		if state != "success" {
+			if reason != "" {
+				return false, fmt.Errorf("status was not 'success', instead was '%s': %s", state, reason)
+			}
+			return false, fmt.Errorf("status was not 'success', instead was '%s'", state)
+		}
+	}
+
+	reviews, err := listReviews(ctx, client, input, repoLimiter)
+	if err != nil {
+		return false, err
+	}
+	if approvedBy(reviews, login, head) {
+		return false, nil
+	}
+
+	review := &github.PullRequestReviewRequest{
+		CommitID: github.String(head),
+		Event:    github.String("APPROVE"),
+	}
+	if criteria.Body != "" {
+		review.Body = github.String(criteria.Body)
+	}
+	<-repoLimiter.C
+	if _, _, err := client.PullRequests.CreateReview(ctx, input.Org, input.Repo, input.PRNumber, review); err != nil {
+		return false, err
+	}
+	return true, nil
+}
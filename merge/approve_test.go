@@ -0,0 +1,27 @@
+package merge
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSizeError(t *testing.T) {
+	pr := &github.PullRequest{Additions: github.Int(30), Deletions: github.Int(25)}
+	assert.NoError(t, diffSizeError(pr, 0))
+	assert.NoError(t, diffSizeError(pr, 55))
+	assert.EqualError(t, diffSizeError(pr, 50), "PR changes 55 lines, more than the maximum of 50")
+}
+
+func TestApprovedBy(t *testing.T) {
+	review := func(login, state, sha string) *github.PullRequestReview {
+		return &github.PullRequestReview{User: &github.User{Login: github.String(login)}, State: github.String(state), CommitID: github.String(sha)}
+	}
+	assert.False(t, approvedBy(nil, "alice", "abc"))
+	assert.True(t, approvedBy([]*github.PullRequestReview{review("bob", "CHANGES_REQUESTED", "abc"), review("Alice", "APPROVED", "abc")}, "alice", "abc"))
+	// an approval of an earlier commit doesn't count
+	assert.False(t, approvedBy([]*github.PullRequestReview{review("alice", "APPROVED", "old")}, "alice", "abc"))
+	assert.True(t, approvedBy([]*github.PullRequestReview{review("alice", "APPROVED", "abc"), review("alice", "COMMENTED", "abc")}, "alice", "abc"))
+	assert.False(t, approvedBy([]*github.PullRequestReview{review("alice", "APPROVED", "abc"), review("alice", "DISMISSED", "abc")}, "alice", "abc"))
+}
@@ -0,0 +1,47 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const enableAutoMergeMutation = `mutation($id: ID!, $method: PullRequestMergeMethod!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method}) {
+    pullRequest { number }
+  }
+}`
+
+// enableAutoMerge turns on Github's native auto-merge for a PR, so that Github merges it once its
+// required checks and reviews pass
+func enableAutoMerge(ctx context.Context, client *github.Client, pr *github.PullRequest, method string, repoLimiter *time.Ticker) error {
+	if method == "" {
+		method = "merge"
+	}
+	err := graphQL(ctx, client, enableAutoMergeMutation, map[string]interface{}{
+		"id":     pr.GetNodeID(),
+		"method": strings.ToUpper(method),
+	}, repoLimiter)
+	if err != nil {
+		return fmt.Errorf("failed to enable auto-merge: %s", err.Error())
+	}
+	return nil
+}
+
+const markReadyForReviewMutation = `mutation($id: ID!) {
+  markPullRequestReadyForReview(input: {pullRequestId: $id}) {
+    pullRequest { number }
+  }
+}`
+
+// markReadyForReview converts a draft PR into one that's ready for review, so that it can be merged
+func markReadyForReview(ctx context.Context, client *github.Client, pr *github.PullRequest, repoLimiter *time.Ticker) error {
+	err := graphQL(ctx, client, markReadyForReviewMutation, map[string]interface{}{"id": pr.GetNodeID()}, repoLimiter)
+	if err != nil {
+		return fmt.Errorf("failed to mark draft PR ready for review: %s", err.Error())
+	}
+	return nil
+}
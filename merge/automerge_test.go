@@ -0,0 +1,53 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoMergeRunsGates(t *testing.T) {
+	reviews := `[]`
+	enabled := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/Clever/microplane/pulls/7":
+			fmt.Fprint(w, `{"number": 7, "node_id": "PR_7", "state": "open", "mergeable": true, "mergeable_state": "blocked", "head": {"sha": "abc"}}`)
+		case "/repos/Clever/microplane/commits/abc/status":
+			// the build is still running, which Github waits for with auto-merge
+			fmt.Fprint(w, `{"state": "pending", "statuses": [{"context": "ci", "state": "pending"}]}`)
+		case "/repos/Clever/microplane/pulls/7/reviews":
+			fmt.Fprint(w, reviews)
+		case "/graphql":
+			enabled = true
+			fmt.Fprint(w, `{"data": {}}`)
+		default:
+			t.Errorf("unexpected request for %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ghclient.Configure(server.URL+"/", "token")
+	defer ghclient.Configure("", "")
+	limiter := time.NewTicker(time.Millisecond)
+	defer limiter.Stop()
+
+	input := Input{Org: "Clever", Repo: "microplane", PRNumber: 7, CommitSHA: "abc", RequireReviewApproval: true,
+		RequireBuildSuccess: true, EnableAutoMerge: true}
+	// the PR isn't approved, so auto-merge isn't enabled
+	_, err := GitHubMerge(context.Background(), input, limiter, limiter)
+	assert.EqualError(t, err, "PR awaiting review")
+	assert.False(t, enabled)
+
+	reviews = `[{"user": {"login": "reviewer"}, "state": "APPROVED"}]`
+	output, err := GitHubMerge(context.Background(), input, limiter, limiter)
+	assert.NoError(t, err)
+	assert.True(t, output.AutoMergeEnabled)
+	assert.True(t, enabled)
+}
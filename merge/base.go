@@ -0,0 +1,60 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// checkBaseBranch is used when a PR can't be merged, to find out whether that's because its base branch
+// no longer exists, e.g. it was deleted or renamed (master -> main) after the PR was opened.
+// If it's gone, it returns an error explaining so. With retarget, the PR is instead switched to the repo's
+// current default branch, and the updated PR is returned.
+func checkBaseBranch(ctx context.Context, client *github.Client, input Input, pr *github.PullRequest, retarget bool, repoLimiter *time.Ticker) (*github.PullRequest, error) {
+	base := pr.GetBase().GetRef()
+	<-repoLimiter.C
+	_, resp, err := client.Repositories.GetBranch(ctx, input.Org, input.Repo, base)
+	if err == nil {
+		// base branch exists, so it's not the problem
+		return pr, nil
+	}
+	if resp == nil || resp.StatusCode != 404 {
+		return nil, err
+	}
+
+	<-repoLimiter.C
+	repo, _, err := client.Repositories.Get(ctx, input.Org, input.Repo)
+	if err != nil {
+		return nil, err
+	}
+	defaultBranch := repo.GetDefaultBranch()
+	if !retarget {
+		return nil, fmt.Errorf("base branch %s is gone (deleted or renamed), the default branch is now %s. Use --retarget-base to retarget the PR", base, defaultBranch)
+	}
+	if pr.GetState() == "closed" {
+		return nil, fmt.Errorf("base branch %s is gone (deleted or renamed), and the PR was closed. It must be reopened or pushed again", base)
+	}
+
+	<-repoLimiter.C
+	_, _, err = client.PullRequests.Edit(ctx, input.Org, input.Repo, input.PRNumber, &github.PullRequest{
+		Base: &github.PullRequestBranch{Ref: &defaultBranch},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("base branch %s is gone, failed to retarget PR to %s: %s", base, defaultBranch, err.Error())
+	}
+
+	// Github recomputes mergeability in the background after a retarget, so wait for it
+	if err := input.Retry.sleep(ctx, 1); err != nil {
+		return nil, err
+	}
+	pr, err = getPR(ctx, client, input, repoLimiter)
+	if err != nil {
+		return nil, err
+	}
+	if pr.Mergeable == nil {
+		return nil, fmt.Errorf("base branch %s is gone, retargeted PR to %s. Mergeability is still being computed, try again shortly", base, defaultBranch)
+	}
+	return pr, nil
+}
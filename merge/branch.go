@@ -0,0 +1,35 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/google/go-github/github"
+)
+
+// deleteBranch deletes a branch, retrying transient failures, and returns whether it was deleted by this call.
+// A branch that no longer exists counts as deleted, so this is safe to call again.
+func deleteBranch(ctx context.Context, client *github.Client, org, repo, branch string, retry RetryPolicy, repoLimiter *time.Ticker) (bool, error) {
+	alreadyDeleted := false
+	err := retry.retry(ctx, func() (*github.Response, error) {
+		<-repoLimiter.C
+		resp, err := client.Git.DeleteRef(ctx, org, repo, "heads/"+branch)
+		if err != nil && resp != nil && (resp.StatusCode == 404 || resp.StatusCode == 422) {
+			alreadyDeleted = true
+			return resp, nil
+		}
+		return resp, err
+	})
+	return err == nil && !alreadyDeleted, err
+}
+
+// GitHubDeleteBranch deletes the branch of a PR that was merged, but whose branch could not be deleted at the time
+func GitHubDeleteBranch(ctx context.Context, org, repo, branch string, repoLimiter *time.Ticker) error {
+	client := ghclient.New(ctx, ghclient.Campaign)
+	if _, err := deleteBranch(ctx, client, org, repo, branch, DefaultRetryPolicy, repoLimiter); err != nil {
+		return fmt.Errorf("failed to delete branch %s: %s", branch, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package merge
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteBranchAlreadyDeleted(t *testing.T) {
+	exists := true
+	client, close := testGitHubClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "DELETE", r.Method)
+		assert.Equal(t, "/repos/Clever/microplane/git/refs/heads/microplaning", r.URL.Path)
+		if !exists {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"message": "Reference does not exist"}`))
+			return
+		}
+		exists = false
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer close()
+	limiter := time.NewTicker(time.Millisecond)
+	defer limiter.Stop()
+
+	deleted, err := deleteBranch(context.Background(), client, "Clever", "microplane", "microplaning", DefaultRetryPolicy, limiter)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	deleted, err = deleteBranch(context.Background(), client, "Clever", "microplane", "microplaning", DefaultRetryPolicy, limiter)
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func TestAbandonOutputString(t *testing.T) {
+	assert.Equal(t, "closed #1, deleted branch microplaning", AbandonOutput{Number: 1, Closed: true, DeletedBranch: "microplaning"}.String())
+	assert.Equal(t, "#2 already closed, branch microplaning already deleted", AbandonOutput{Number: 2, AlreadyDeletedBranch: "microplaning"}.String())
+}
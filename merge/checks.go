@@ -0,0 +1,246 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/Clever/microplane/verbosity"
+	"github.com/google/go-github/github"
+)
+
+// Policies for a commit that has no status checks or check runs, see Input.NoChecksPolicy
+const (
+	// NoChecksPending keeps waiting for checks to appear, like Github's combined status does
+	NoChecksPending = "pending"
+	// NoChecksSuccess treats the repo as having no CI, so there's nothing to wait for
+	NoChecksSuccess = "success"
+	// NoChecksFailure refuses to merge without CI
+	NoChecksFailure = "failure"
+)
+
+// checkRun is the part of a Github check run we need. The go-github client doesn't support the checks API,
+// so check runs are fetched directly.
+type checkRun struct {
+	Name        string    `json:"name"`
+	Status      string    `json:"status"`
+	Conclusion  string    `json:"conclusion"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+type checkRunsResponse struct {
+	TotalCount int        `json:"total_count"`
+	CheckRuns  []checkRun `json:"check_runs"`
+}
+
+// listCheckRuns gets the check runs of a commit, e.g. from Github Actions, which aren't part of its combined status
+func listCheckRuns(ctx context.Context, client *github.Client, input Input, repoLimiter *time.Ticker) ([]checkRun, error) {
+	all := []checkRun{}
+	for page := 1; ; page++ {
+		u := fmt.Sprintf("repos/%s/%s/commits/%s/check-runs?per_page=100&page=%d", input.Org, input.Repo, input.CommitSHA, page)
+		req, err := client.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github.antiope-preview+json")
+		var resp checkRunsResponse
+		<-repoLimiter.C
+		if _, err := client.Do(ctx, req, &resp); err != nil {
+			return nil, err
+		}
+		all = append(all, resp.CheckRuns...)
+		if len(resp.CheckRuns) == 0 || len(all) >= resp.TotalCount {
+			return all, nil
+		}
+	}
+}
+
+// checkRunsState combines check runs into a state like a combined status's
+// - "failure" if any completed run didn't succeed, e.g. it failed, timed out or was cancelled
+// - "pending" if any run hasn't completed
+// - "success" otherwise
+func checkRunsState(runs []checkRun, ignoreContexts []string) string {
+	ignored := map[string]bool{}
+	for _, c := range ignoreContexts {
+		ignored[c] = true
+	}
+	state := "success"
+	for _, r := range runs {
+		if ignored[r.Name] {
+			continue
+		}
+		if r.Status != "completed" {
+			state = "pending"
+			continue
+		}
+		switch r.Conclusion {
+		case "success", "neutral", "skipped":
+		default:
+			return "failure"
+		}
+	}
+	return state
+}
+
+// stateSeverity orders build states, so that the worst of a commit's status checks and check runs wins
+var stateSeverity = map[string]int{"success": 0, "pending": 1, "failure": 2, "error": 2}
+
+// worseState returns whichever of two build states is worse
+func worseState(a, b string) string {
+	if stateSeverity[b] > stateSeverity[a] {
+		return b
+	}
+	return a
+}
+
+// resolveBuildState combines a commit's status checks and check runs, e.g. from Github Actions, which aren't part of
+// its combined status, and works around Github reporting a commit with no status checks as "pending", which is
+// indistinguishable from checks that are running:
+// - if the commit has status checks or check runs, the worst of their states stands
+// - otherwise, checks may not have been created yet, so it's "pending" until grace has passed, then up to the policy
+func resolveBuildState(statusState string, statuses int, runs []checkRun, ignoreContexts []string, pushedAt, now time.Time, grace time.Duration, policy string) (state, reason string) {
+	if statuses > 0 || countChecks(&github.CombinedStatus{}, runs, ignoreContexts) > 0 {
+		state = "success"
+		if statuses > 0 {
+			state = statusState
+		}
+		return worseState(state, checkRunsState(runs, ignoreContexts)), ""
+	}
+	if now.Sub(pushedAt) < grace {
+		return "pending", "no checks have been created yet"
+	}
+	if policy == "" {
+		policy = NoChecksPending
+	}
+	return policy, fmt.Sprintf("no checks were created within %s, treated as %s", grace, policy)
+}
+
+// buildStateWithChecks determines a commit's build state from its statuses and check runs, see resolveBuildState.
+// pushedAt is only called if the commit has no checks at all, since it may cost an API call.
+func buildStateWithChecks(ctx context.Context, client *github.Client, input Input, status *github.CombinedStatus, pushedAt func() (time.Time, error), repoLimiter *time.Ticker) (state, reason string, err error) {
+	// a commit's check runs count even if it has status checks, e.g. a failing Github Actions run alongside
+	// a passing CircleCI status
+	runs, err := listCheckRuns(ctx, client, input, repoLimiter)
+	if err != nil {
+		return "", "", err
+	}
+	return checksBuildState(input, status, runs, pushedAt)
+}
+
+// checksBuildState is buildStateWithChecks, with the commit's check runs already listed
+func checksBuildState(input Input, status *github.CombinedStatus, runs []checkRun, pushedAt func() (time.Time, error)) (state, reason string, err error) {
+	statuses := 0
+	ignored := map[string]bool{}
+	for _, c := range input.IgnoreContexts {
+		ignored[c] = true
+	}
+	for _, s := range status.Statuses {
+		if !ignored[s.GetContext()] {
+			statuses++
+		}
+	}
+	var at time.Time
+	if countChecks(status, runs, input.IgnoreContexts) == 0 {
+		if at, err = pushedAt(); err != nil {
+			return "", "", err
+		}
+	}
+	state, reason = resolveBuildState(buildState(status, input.IgnoreContexts), statuses, runs, input.IgnoreContexts,
+		at, time.Now(), input.NoChecksGracePeriod, input.NoChecksPolicy)
+	return state, reason, nil
+}
+
+// headPushedAt estimates when a PR's head commit was pushed: the later of when the PR was opened and the commit was made
+func headPushedAt(ctx context.Context, client *github.Client, input Input, pr *github.PullRequest, repoLimiter *time.Ticker) (time.Time, error) {
+	pushedAt := pr.GetCreatedAt()
+	<-repoLimiter.C
+	commit, _, err := client.Git.GetCommit(ctx, input.Org, input.Repo, input.CommitSHA)
+	if err != nil {
+		return pushedAt, err
+	}
+	if committed := commit.GetCommitter().GetDate(); committed.After(pushedAt) {
+		pushedAt = committed
+	}
+	return pushedAt, nil
+}
+
+// GitHubBuildState is a lightweight check of the build state of the PR's head commit, without checking anything else,
+// e.g. to find which PRs are worth running the full merge gate on. It returns the head commit, which may not be
+// input.CommitSHA if the PR was pushed to since. A commit with no checks at all is treated as if
+// NoChecksGracePeriod has passed, since when it was pushed isn't looked up.
+func GitHubBuildState(ctx context.Context, input Input, repoLimiter *time.Ticker) (state, head string, err error) {
+	client := ghclient.New(ctx, ghclient.Campaign)
+	// not getPR, since the PR's mergeability isn't needed
+	var pr *github.PullRequest
+	err = input.Retry.retry(ctx, func() (*github.Response, error) {
+		<-repoLimiter.C
+		var resp *github.Response
+		pr, resp, err = client.PullRequests.Get(ctx, input.Org, input.Repo, input.PRNumber)
+		return resp, err
+	})
+	if err != nil {
+		return "", "", err
+	}
+	input.CommitSHA = pr.GetHead().GetSHA()
+	status, err := combinedStatus(ctx, client, input, repoLimiter)
+	if err != nil {
+		return "", "", err
+	}
+	state, _, err = buildStateWithChecks(ctx, client, input, status, func() (time.Time, error) { return time.Time{}, nil }, repoLimiter)
+	return state, input.CommitSHA, err
+}
+
+// DefaultBuildTimeout is how long to wait for Input.MinExpectedChecks, if Input.BuildTimeout isn't set
+const DefaultBuildTimeout = 5 * time.Minute
+
+// countChecks is the number of status checks and check runs that aren't ignored
+func countChecks(status *github.CombinedStatus, runs []checkRun, ignoreContexts []string) int {
+	ignored := map[string]bool{}
+	for _, c := range ignoreContexts {
+		ignored[c] = true
+	}
+	n := 0
+	for _, s := range status.Statuses {
+		if !ignored[s.GetContext()] {
+			n++
+		}
+	}
+	for _, r := range runs {
+		if !ignored[r.Name] {
+			n++
+		}
+	}
+	return n
+}
+
+// waitForChecks polls a commit until it has at least input.MinExpectedChecks status checks and check runs,
+// returning its combined status, or an error once input.BuildTimeout has passed
+func waitForChecks(ctx context.Context, client *github.Client, input Input, repoLimiter *time.Ticker) (*github.CombinedStatus, error) {
+	timeout := input.BuildTimeout
+	if timeout <= 0 {
+		timeout = DefaultBuildTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		status, err := combinedStatus(ctx, client, input, repoLimiter)
+		if err != nil {
+			return nil, err
+		}
+		runs, err := listCheckRuns(ctx, client, input, repoLimiter)
+		if err != nil {
+			return nil, err
+		}
+		n := countChecks(status, runs, input.IgnoreContexts)
+		if n >= input.MinExpectedChecks {
+			return status, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("only %d of %d expected checks are present after waiting %s", n, input.MinExpectedChecks, timeout)
+		}
+		verbosity.Debugf("%s/%s - %d of %d expected checks are present, waiting", input.Org, input.Repo, n, input.MinExpectedChecks)
+		if err := input.Retry.sleep(ctx, attempt); err != nil {
+			return nil, err
+		}
+	}
+}
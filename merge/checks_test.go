@@ -0,0 +1,128 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveBuildState(t *testing.T) {
+	now := time.Date(2019, 8, 14, 9, 0, 0, 0, time.UTC)
+	grace := 10 * time.Minute
+	resolve := func(statuses int, runs []checkRun, pushedAt time.Time, policy string) string {
+		state, _ := resolveBuildState("pending", statuses, runs, []string{"flaky"}, pushedAt, now, grace, policy)
+		return state
+	}
+
+	// status checks are running
+	assert.Equal(t, "pending", resolve(1, nil, now.Add(-time.Hour), NoChecksSuccess))
+	// status checks and check runs together, the worst of them wins
+	passed := func(statuses int, runs []checkRun) string {
+		state, _ := resolveBuildState("success", statuses, runs, []string{"flaky"}, now, now, grace, NoChecksPending)
+		return state
+	}
+	assert.Equal(t, "success", passed(1, []checkRun{{Name: "build", Status: "completed", Conclusion: "success"}}))
+	assert.Equal(t, "failure", passed(1, []checkRun{{Name: "build", Status: "completed", Conclusion: "failure"}}))
+	assert.Equal(t, "pending", passed(1, []checkRun{{Name: "build", Status: "queued"}}))
+	assert.Equal(t, "success", passed(1, []checkRun{{Name: "flaky", Status: "completed", Conclusion: "failure"}}))
+	// check runs, rather than status checks
+	assert.Equal(t, "pending", resolve(0, []checkRun{{Name: "build", Status: "in_progress"}}, now.Add(-time.Hour), NoChecksSuccess))
+	assert.Equal(t, "failure", resolve(0, []checkRun{{Name: "build", Status: "completed", Conclusion: "timed_out"}}, now, NoChecksSuccess))
+	assert.Equal(t, "success", resolve(0, []checkRun{
+		{Name: "build", Status: "completed", Conclusion: "success"},
+		{Name: "flaky", Status: "completed", Conclusion: "failure"},
+	}, now, NoChecksFailure))
+	// no checks yet, within the grace period
+	assert.Equal(t, "pending", resolve(0, nil, now.Add(-time.Minute), NoChecksSuccess))
+	// no checks after the grace period
+	assert.Equal(t, "success", resolve(0, nil, now.Add(-time.Hour), NoChecksSuccess))
+	assert.Equal(t, "failure", resolve(0, nil, now.Add(-time.Hour), NoChecksFailure))
+	assert.Equal(t, "pending", resolve(0, nil, now.Add(-time.Hour), ""))
+}
+
+func TestCountChecks(t *testing.T) {
+	ci, flaky := "ci/circleci", "flaky"
+	status := &github.CombinedStatus{Statuses: []github.RepoStatus{{Context: &ci}, {Context: &flaky}}}
+	runs := []checkRun{{Name: "build"}, {Name: "flaky"}}
+	assert.Equal(t, 4, countChecks(status, runs, nil))
+	assert.Equal(t, 2, countChecks(status, runs, []string{"flaky"}))
+	assert.Equal(t, 0, countChecks(&github.CombinedStatus{}, nil, nil))
+}
+
+func TestBuildStateWithChecks(t *testing.T) {
+	runs := `{"total_count": 0, "check_runs": []}`
+	client, close := testGitHubClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/Clever/microplane/commits/abc123/check-runs", r.URL.Path)
+		fmt.Fprint(w, runs)
+	}))
+	defer close()
+	limiter := time.NewTicker(time.Millisecond)
+	defer limiter.Stop()
+	ctx := context.Background()
+	input := Input{Org: "Clever", Repo: "microplane", CommitSHA: "abc123", NoChecksGracePeriod: time.Hour}
+	lookups := 0
+	pushedAt := func() (time.Time, error) {
+		lookups++
+		return time.Now(), nil
+	}
+
+	ci, pending, success := "ci", "pending", "success"
+	withStatus := &github.CombinedStatus{State: &success, Statuses: []github.RepoStatus{{Context: &ci, State: &success}}}
+	state, _, err := buildStateWithChecks(ctx, client, input, withStatus, pushedAt, limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, "success", state)
+
+	// a failing check run fails the build, even though the status check passed
+	runs = `{"total_count": 1, "check_runs": [{"name": "build", "status": "completed", "conclusion": "failure"}]}`
+	state, _, err = buildStateWithChecks(ctx, client, input, withStatus, pushedAt, limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, "failure", state)
+
+	runs = `{"total_count": 1, "check_runs": [{"name": "build", "status": "completed", "conclusion": "success"}]}`
+	withoutStatus := &github.CombinedStatus{State: &pending}
+	state, _, err = buildStateWithChecks(ctx, client, input, withoutStatus, pushedAt, limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, "success", state)
+	assert.Equal(t, 0, lookups)
+
+	// the push is only looked up for the grace period without any checks
+	runs = `{"total_count": 0, "check_runs": []}`
+	state, reason, err := buildStateWithChecks(ctx, client, input, withoutStatus, pushedAt, limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, "pending", state)
+	assert.Equal(t, "no checks have been created yet", reason)
+	assert.Equal(t, 1, lookups)
+}
+
+func TestGitHubBuildStateOfLiveHead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/Clever/microplane/pulls/7":
+			fmt.Fprint(w, `{"number": 7, "head": {"sha": "rebased"}}`)
+		case "/repos/Clever/microplane/commits/rebased/status":
+			fmt.Fprint(w, `{"state": "success", "statuses": [{"context": "ci", "state": "success"}]}`)
+		case "/repos/Clever/microplane/commits/rebased/check-runs":
+			fmt.Fprint(w, `{"total_count": 0, "check_runs": []}`)
+		default:
+			t.Errorf("unexpected request for %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ghclient.Configure(server.URL+"/", "token")
+	defer ghclient.Configure("", "")
+	limiter := time.NewTicker(time.Millisecond)
+	defer limiter.Stop()
+
+	state, head, err := GitHubBuildState(context.Background(), Input{Org: "Clever", Repo: "microplane", PRNumber: 7, CommitSHA: "pushed"}, limiter)
+	assert.NoError(t, err)
+	assert.Equal(t, "success", state)
+	assert.Equal(t, "rebased", head)
+}
@@ -0,0 +1,48 @@
+package merge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// coAuthorTrailers builds "Co-authored-by" trailers for the distinct authors of a PR's commits,
+// so that a squash merge doesn't lose who contributed to it
+func coAuthorTrailers(commits []*github.RepositoryCommit) string {
+	seen := map[string]bool{}
+	trailers := []string{}
+	for _, c := range commits {
+		author := c.GetCommit().GetAuthor()
+		if author.GetEmail() == "" {
+			continue
+		}
+		key := strings.ToLower(author.GetEmail())
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		trailers = append(trailers, fmt.Sprintf("Co-authored-by: %s <%s>", author.GetName(), author.GetEmail()))
+	}
+	return strings.Join(trailers, "\n")
+}
+
+// squashCommitMessage builds a squash merge's commit message like Github's default, listing the PR's commit
+// messages, with co-author trailers appended. The message passed to the merge replaces Github's default,
+// so the trailers can't be passed alone.
+func squashCommitMessage(commits []*github.RepositoryCommit) string {
+	messages := []string{}
+	for _, c := range commits {
+		if message := strings.TrimSpace(c.GetCommit().GetMessage()); message != "" {
+			messages = append(messages, "* "+message)
+		}
+	}
+	if len(messages) == 1 {
+		messages[0] = strings.TrimPrefix(messages[0], "* ")
+	}
+	parts := messages
+	if trailers := coAuthorTrailers(commits); trailers != "" {
+		parts = append(parts, trailers)
+	}
+	return strings.Join(parts, "\n\n")
+}
@@ -0,0 +1,35 @@
+package merge
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoAuthorTrailers(t *testing.T) {
+	commit := func(name, email string) *github.RepositoryCommit {
+		return &github.RepositoryCommit{Commit: &github.Commit{Author: &github.CommitAuthor{Name: &name, Email: &email}}}
+	}
+	commits := []*github.RepositoryCommit{
+		commit("Ada", "ada@example.com"),
+		commit("Grace", "grace@example.com"),
+		commit("Ada", "ADA@example.com"),
+		commit("Nobody", ""),
+	}
+	assert.Equal(t, "Co-authored-by: Ada <ada@example.com>\nCo-authored-by: Grace <grace@example.com>", coAuthorTrailers(commits))
+	assert.Equal(t, "", coAuthorTrailers(nil))
+}
+
+func TestSquashCommitMessage(t *testing.T) {
+	commit := func(message, name, email string) *github.RepositoryCommit {
+		return &github.RepositoryCommit{Commit: &github.Commit{Message: &message, Author: &github.CommitAuthor{Name: &name, Email: &email}}}
+	}
+	assert.Equal(t, "upgrade go\n\nCo-authored-by: Ada <ada@example.com>",
+		squashCommitMessage([]*github.RepositoryCommit{commit("upgrade go\n", "Ada", "ada@example.com")}))
+	assert.Equal(t, "* upgrade go\n\n* fix tests\n\nCo-authored-by: Ada <ada@example.com>\nCo-authored-by: Grace <grace@example.com>",
+		squashCommitMessage([]*github.RepositoryCommit{
+			commit("upgrade go", "Ada", "ada@example.com"),
+			commit("fix tests", "Grace", "grace@example.com"),
+		}))
+}
@@ -0,0 +1,97 @@
+package merge
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/google/go-github/github"
+)
+
+// Outcomes reported by outcome comments
+const (
+	OutcomeMerged    = "merged"
+	OutcomeAutoMerge = "auto-merge"
+	OutcomeSkipped   = "skipped"
+)
+
+// outcomeCommentMarker identifies microplane's outcome comments, so that an unchanged outcome isn't posted again
+const outcomeCommentMarker = "<!-- microplane-outcome -->"
+
+// DefaultOutcomeCommentTemplate is the outcome comment, unless a template is configured
+const DefaultOutcomeCommentTemplate = `{{if eq .Outcome "merged"}}Merged automatically by microplane{{with .Campaign}} campaign {{.}}{{end}}.
+{{- else if eq .Outcome "auto-merge"}}Auto-merge enabled by microplane{{with .Campaign}} campaign {{.}}{{end}}, Github will merge this once checks and reviews pass.
+{{- else}}Skipped by microplane{{with .Campaign}} campaign {{.}}{{end}}: {{.Reason}}{{end}}`
+
+// CommentData are the variables available to an outcome comment template
+type CommentData struct {
+	Org      string
+	Repo     string
+	PRNumber int
+	Campaign string
+	// Outcome is OutcomeMerged, OutcomeAutoMerge or OutcomeSkipped
+	Outcome string
+	// Reason the PR was skipped, e.g. "PR awaiting review"
+	Reason string
+}
+
+// NewCommentTemplate parses an outcome comment template
+func NewCommentTemplate(text string) (*template.Template, error) {
+	return template.New("outcome-comment").Parse(text)
+}
+
+// OutcomeComment renders the outcome comment for the result of merging a PR
+func OutcomeComment(tmpl *template.Template, data CommentData, output Output, err error) (string, error) {
+	switch {
+	case err != nil:
+		data.Outcome = OutcomeSkipped
+		data.Reason = err.Error()
+	case output.AutoMergeEnabled:
+		data.Outcome = OutcomeAutoMerge
+	default:
+		data.Outcome = OutcomeMerged
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// GitHubCommentOutcome comments on a PR with the outcome of merging it, unless microplane's latest outcome comment
+// already says the same thing, so that retries don't spam the PR. It returns whether it commented.
+func GitHubCommentOutcome(ctx context.Context, org, repo string, prNumber int, body string, repoLimiter *time.Ticker) (bool, error) {
+	client := ghclient.New(ctx, ghclient.Campaign)
+	body = body + "\n\n" + outcomeCommentMarker
+
+	latest := ""
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		<-repoLimiter.C
+		comments, resp, err := client.Issues.ListComments(ctx, org, repo, prNumber, opts)
+		if err != nil {
+			return false, err
+		}
+		for _, c := range comments {
+			if strings.Contains(c.GetBody(), outcomeCommentMarker) {
+				latest = c.GetBody()
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	if latest == body {
+		return false, nil
+	}
+
+	<-repoLimiter.C
+	if _, _, err := client.Issues.CreateComment(ctx, org, repo, prNumber, &github.IssueComment{Body: &body}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
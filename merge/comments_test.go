@@ -0,0 +1,73 @@
+package merge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutcomeComment(t *testing.T) {
+	tmpl, err := NewCommentTemplate(DefaultOutcomeCommentTemplate)
+	assert.NoError(t, err)
+	data := CommentData{Org: "Clever", Repo: "microplane", PRNumber: 1, Campaign: "go-upgrade"}
+
+	comment, err := OutcomeComment(tmpl, data, Output{Success: true}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Merged automatically by microplane campaign go-upgrade.", comment)
+
+	comment, err = OutcomeComment(tmpl, CommentData{}, Output{}, fmt.Errorf("PR awaiting review"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Skipped by microplane: PR awaiting review", comment)
+
+	tmpl, err = NewCommentTemplate("{{.Repo}}#{{.PRNumber}} {{.Outcome}}")
+	assert.NoError(t, err)
+	comment, err = OutcomeComment(tmpl, data, Output{AutoMergeEnabled: true}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "microplane#1 auto-merge", comment)
+}
+
+func TestGitHubCommentOutcomeDedupes(t *testing.T) {
+	comments := []*github.IssueComment{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/Clever/microplane/issues/1/comments", r.URL.Path)
+		if r.Method == "POST" {
+			var comment github.IssueComment
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+			comments = append(comments, &comment)
+			assert.NoError(t, json.NewEncoder(w).Encode(comment))
+			return
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(comments))
+	}))
+	defer server.Close()
+	ghclient.Configure(server.URL+"/", "token")
+	defer ghclient.Configure("", "")
+	limiter := time.NewTicker(time.Millisecond)
+	defer limiter.Stop()
+	ctx := context.Background()
+
+	commented, err := GitHubCommentOutcome(ctx, "Clever", "microplane", 1, "Skipped by microplane: PR awaiting review", limiter)
+	assert.NoError(t, err)
+	assert.True(t, commented)
+	// a retry with the same outcome doesn't comment again
+	commented, err = GitHubCommentOutcome(ctx, "Clever", "microplane", 1, "Skipped by microplane: PR awaiting review", limiter)
+	assert.NoError(t, err)
+	assert.False(t, commented)
+	// a new outcome does
+	commented, err = GitHubCommentOutcome(ctx, "Clever", "microplane", 1, "Merged automatically by microplane.", limiter)
+	assert.NoError(t, err)
+	assert.True(t, commented)
+	// going back to an earlier outcome does too, since it's only compared with the latest
+	commented, err = GitHubCommentOutcome(ctx, "Clever", "microplane", 1, "Skipped by microplane: PR awaiting review", limiter)
+	assert.NoError(t, err)
+	assert.True(t, commented)
+	assert.Len(t, comments, 3)
+}
@@ -0,0 +1,47 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// dispatchBuild triggers a build of the base branch after a merge, by running a Github Actions workflow
+// (Input.DispatchWorkflow) and/or sending a repository_dispatch event (Input.DispatchEvent).
+// The go-github client doesn't support these endpoints, so they're sent directly.
+func dispatchBuild(ctx context.Context, client *github.Client, input Input, pr *github.PullRequest, repoLimiter *time.Ticker) error {
+	base := pr.GetBase().GetRef()
+	if input.DispatchWorkflow != "" {
+		u := fmt.Sprintf("repos/%s/%s/actions/workflows/%s/dispatches", input.Org, input.Repo, url.PathEscape(input.DispatchWorkflow))
+		if err := postDispatch(ctx, client, u, map[string]interface{}{"ref": base}, repoLimiter); err != nil {
+			return fmt.Errorf("failed to dispatch workflow %s on %s: %s", input.DispatchWorkflow, base, err.Error())
+		}
+	}
+	if input.DispatchEvent != "" {
+		u := fmt.Sprintf("repos/%s/%s/dispatches", input.Org, input.Repo)
+		body := map[string]interface{}{
+			"event_type": input.DispatchEvent,
+			"client_payload": map[string]interface{}{
+				"ref":       base,
+				"pr_number": input.PRNumber,
+			},
+		}
+		if err := postDispatch(ctx, client, u, body, repoLimiter); err != nil {
+			return fmt.Errorf("failed to send repository_dispatch event %s: %s", input.DispatchEvent, err.Error())
+		}
+	}
+	return nil
+}
+
+func postDispatch(ctx context.Context, client *github.Client, u string, body interface{}, repoLimiter *time.Ticker) error {
+	req, err := client.NewRequest("POST", u, body)
+	if err != nil {
+		return err
+	}
+	<-repoLimiter.C
+	_, err = client.Do(ctx, req, nil)
+	return err
+}
@@ -0,0 +1,88 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+)
+
+// Drift is live information about an open PR that may need attention before it can be merged,
+// e.g. because it has fallen behind its base branch
+type Drift struct {
+	// Open is false if the PR has been merged or closed, in which case the rest is empty
+	Open       bool
+	OpenedAt   time.Time
+	BaseBranch string
+	// BehindBy is how many commits the base branch has gained since the PR branched off
+	BehindBy int
+	// BuildState is the combined status of the PR's head: "success", "pending" or "failure"
+	BuildState string
+	// NewestCheck is when the most recent passing status check was reported, if any
+	NewestCheck time.Time
+}
+
+// Reasons explains why a PR has drifted, or returns nothing if it hasn't:
+// it's behind its base branch, its CI is failing, or it or its CI results are older than maxAge
+func (d Drift) Reasons(now time.Time, maxAge time.Duration) []string {
+	reasons := []string{}
+	if !d.Open {
+		return reasons
+	}
+	if d.BehindBy > 0 {
+		reasons = append(reasons, fmt.Sprintf("behind %s by %d commit(s)", d.BaseBranch, d.BehindBy))
+	}
+	if d.BuildState == "failure" || d.BuildState == "error" {
+		reasons = append(reasons, "CI failing")
+	}
+	if maxAge > 0 && now.Sub(d.OpenedAt) > maxAge {
+		reasons = append(reasons, fmt.Sprintf("open for %s", age(now.Sub(d.OpenedAt))))
+	}
+	if maxAge > 0 && !d.NewestCheck.IsZero() && now.Sub(d.NewestCheck) > maxAge {
+		reasons = append(reasons, fmt.Sprintf("CI results are %s old", age(now.Sub(d.NewestCheck))))
+	}
+	return reasons
+}
+
+// age formats a duration in days, or hours if less than a day
+func age(d time.Duration) string {
+	if d < 24*time.Hour {
+		return d.Round(time.Hour).String()
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// GitHubDrift gets live information about a PR, to tell whether it has drifted, see Drift.Reasons
+func GitHubDrift(ctx context.Context, input Input, repoLimiter *time.Ticker) (Drift, error) {
+	client := ghclient.New(ctx, ghclient.Discovery)
+	<-repoLimiter.C
+	pr, _, err := client.PullRequests.Get(ctx, input.Org, input.Repo, input.PRNumber)
+	if err != nil {
+		return Drift{}, err
+	}
+	if pr.GetState() != "open" {
+		return Drift{}, nil
+	}
+	drift := Drift{Open: true, OpenedAt: pr.GetCreatedAt(), BaseBranch: pr.GetBase().GetRef()}
+
+	<-repoLimiter.C
+	comparison, _, err := client.Repositories.CompareCommits(ctx, input.Org, input.Repo, pr.GetBase().GetRef(), pr.GetHead().GetSHA())
+	if err != nil {
+		return Drift{}, err
+	}
+	drift.BehindBy = comparison.GetBehindBy()
+
+	input.CommitSHA = pr.GetHead().GetSHA()
+	status, err := combinedStatus(ctx, client, input, repoLimiter)
+	if err != nil {
+		return Drift{}, err
+	}
+	drift.BuildState = buildState(status, input.IgnoreContexts)
+	runs, err := listCheckRuns(ctx, client, input, repoLimiter)
+	if err != nil {
+		return Drift{}, err
+	}
+	drift.NewestCheck = newestSuccess(status, runs, input.IgnoreContexts)
+	return drift, nil
+}
@@ -0,0 +1,24 @@
+package merge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDriftReasons(t *testing.T) {
+	now := time.Date(2020, 3, 20, 12, 0, 0, 0, time.UTC)
+	week := 7 * 24 * time.Hour
+
+	assert.Empty(t, Drift{}.Reasons(now, week))
+	assert.Empty(t, Drift{Open: true, OpenedAt: now.Add(-time.Hour), BuildState: "success"}.Reasons(now, week))
+	assert.Equal(t, []string{"behind master by 3 commit(s)", "CI failing", "open for 10d", "CI results are 8d old"}, Drift{
+		Open:        true,
+		OpenedAt:    now.Add(-10 * 24 * time.Hour),
+		BaseBranch:  "master",
+		BehindBy:    3,
+		BuildState:  "failure",
+		NewestCheck: now.Add(-8 * 24 * time.Hour),
+	}.Reasons(now, week))
+}
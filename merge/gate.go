@@ -0,0 +1,36 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// runGateCommand runs an external merge gate, for policies microplane doesn't know about.
+// The command is run with `sh -c`, with the PR's details in MICROPLANE_<X> env vars.
+// A zero exit status means the PR may be merged. Otherwise, the command's output is the reason it may not.
+func runGateCommand(ctx context.Context, command string, input Input, pr *github.PullRequest) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("MICROPLANE_ORG=%s", input.Org),
+		fmt.Sprintf("MICROPLANE_REPO=%s", input.Repo),
+		fmt.Sprintf("MICROPLANE_PR_NUMBER=%d", input.PRNumber),
+		fmt.Sprintf("MICROPLANE_PR_URL=%s", pr.GetHTMLURL()),
+		fmt.Sprintf("MICROPLANE_COMMIT_SHA=%s", input.CommitSHA),
+		fmt.Sprintf("MICROPLANE_BASE_BRANCH=%s", pr.GetBase().GetRef()),
+		fmt.Sprintf("MICROPLANE_HEAD_BRANCH=%s", pr.GetHead().GetRef()),
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		reason := strings.TrimSpace(string(output))
+		if reason == "" {
+			reason = err.Error()
+		}
+		return fmt.Errorf("external gate: %s", reason)
+	}
+	return nil
+}
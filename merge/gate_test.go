@@ -0,0 +1,22 @@
+package merge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunGateCommand(t *testing.T) {
+	url, base, head := "https://github.com/Clever/microplane/pull/7", "master", "microplaning"
+	pr := &github.PullRequest{HTMLURL: &url, Base: &github.PullRequestBranch{Ref: &base}, Head: &github.PullRequestBranch{Ref: &head}}
+	input := Input{Org: "Clever", Repo: "microplane", PRNumber: 7, CommitSHA: "abc123"}
+	ctx := context.Background()
+
+	env := `echo "$MICROPLANE_ORG/$MICROPLANE_REPO#$MICROPLANE_PR_NUMBER $MICROPLANE_COMMIT_SHA $MICROPLANE_BASE_BRANCH...$MICROPLANE_HEAD_BRANCH $MICROPLANE_PR_URL"`
+	expected := "Clever/microplane#7 abc123 master...microplaning " + url
+	assert.NoError(t, runGateCommand(ctx, `test "$(`+env+`)" = "`+expected+`"`, input, pr))
+	assert.EqualError(t, runGateCommand(ctx, "echo change freeze until Monday; exit 1", input, pr), "external gate: change freeze until Monday")
+	assert.EqualError(t, runGateCommand(ctx, "exit 3", input, pr), "external gate: exit status 3")
+}
@@ -0,0 +1,55 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphQLResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphQLURL returns the GraphQL endpoint for a client.
+// On Github Enterprise it's /api/graphql, rather than under the REST API's /api/v3/.
+// It's resolved relative to the API URL, since Github Enterprise may be under a path prefix.
+func graphQLURL(client *github.Client) string {
+	ref := "graphql"
+	if strings.HasSuffix(client.BaseURL.Path, "/api/v3/") {
+		ref = "../graphql"
+	}
+	return client.BaseURL.ResolveReference(&url.URL{Path: ref}).String()
+}
+
+// graphQL sends a GraphQL query or mutation. The go-github client has no GraphQL support, so it's sent directly.
+func graphQL(ctx context.Context, client *github.Client, query string, variables map[string]interface{}, repoLimiter *time.Ticker) error {
+	req, err := client.NewRequest("POST", graphQLURL(client), graphQLRequest{Query: query, Variables: variables})
+	if err != nil {
+		return err
+	}
+
+	var resp graphQLResponse
+	<-repoLimiter.C
+	if _, err := client.Do(ctx, req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		messages := []string{}
+		for _, e := range resp.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("%s", strings.Join(messages, "; "))
+	}
+	return nil
+}
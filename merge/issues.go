@@ -0,0 +1,86 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// issueRef identifies an issue, possibly in another repo
+type issueRef struct {
+	Org    string
+	Repo   string
+	Number int
+}
+
+func (i issueRef) String() string {
+	return fmt.Sprintf("%s/%s#%d", i.Org, i.Repo, i.Number)
+}
+
+// closingReference matches Github's closing keywords followed by an issue, e.g. "Fixes #12",
+// "closes Clever/other#3" or "resolves https://github.com/Clever/other/issues/3"
+var closingReference = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?):?\s+(?:https?://[^/\s]+/([\w.-]+)/([\w.-]+)/issues/|([\w.-]+)/([\w.-]+)#|#)(\d+)`)
+
+// linkedIssues returns the issues a PR body links with closing keywords, in order, without duplicates.
+// Issues without an org and repo are in the PR's repo.
+func linkedIssues(body, org, repo string) []issueRef {
+	refs := []issueRef{}
+	seen := map[string]bool{}
+	for _, m := range closingReference.FindAllStringSubmatch(body, -1) {
+		ref := issueRef{Org: org, Repo: repo}
+		if m[1] != "" {
+			ref.Org, ref.Repo = m[1], m[2]
+		} else if m[3] != "" {
+			ref.Org, ref.Repo = m[3], m[4]
+		}
+		ref.Number, _ = strconv.Atoi(m[5])
+		if key := strings.ToLower(ref.String()); !seen[key] {
+			seen[key] = true
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// issueRequirementError returns why an issue doesn't meet the linked issue requirement, or nil if it does:
+// it must be in state, unless state is "", and have all of labels
+func issueRequirementError(ref issueRef, issue *github.Issue, state string, labels []string) error {
+	if state != "" && issue.GetState() != state {
+		return fmt.Errorf("linked issue %s is %s, not %s", ref, issue.GetState(), state)
+	}
+	has := map[string]bool{}
+	for _, l := range issue.Labels {
+		has[strings.ToLower(l.GetName())] = true
+	}
+	for _, l := range labels {
+		if !has[strings.ToLower(l)] {
+			return fmt.Errorf("linked issue %s is missing label %s", ref, l)
+		}
+	}
+	return nil
+}
+
+// linkedIssuesError checks the issues a PR links against Input.LinkedIssueState and Input.LinkedIssueLabels.
+// A PR that doesn't link any issues fails the gate.
+func linkedIssuesError(ctx context.Context, client *github.Client, input Input, pr *github.PullRequest, repoLimiter *time.Ticker) error {
+	refs := linkedIssues(pr.GetBody(), input.Org, input.Repo)
+	if len(refs) == 0 {
+		return fmt.Errorf("PR doesn't link an issue, e.g. with 'Fixes #123'")
+	}
+	for _, ref := range refs {
+		<-repoLimiter.C
+		issue, _, err := client.Issues.Get(ctx, ref.Org, ref.Repo, ref.Number)
+		if err != nil {
+			return fmt.Errorf("error getting linked issue %s: %s", ref, err.Error())
+		}
+		if err := issueRequirementError(ref, issue, input.LinkedIssueState, input.LinkedIssueLabels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
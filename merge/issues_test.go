@@ -0,0 +1,32 @@
+package merge
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkedIssues(t *testing.T) {
+	body := "Upgrade Go.\n\nFixes #12, closes Clever/tracking#3\nResolves: https://github.com/Clever/tracking/issues/4\nSee #99. Fixed #12"
+	assert.Equal(t, []issueRef{
+		{Org: "Clever", Repo: "microplane", Number: 12},
+		{Org: "Clever", Repo: "tracking", Number: 3},
+		{Org: "Clever", Repo: "tracking", Number: 4},
+	}, linkedIssues(body, "Clever", "microplane"))
+	assert.Equal(t, []issueRef{}, linkedIssues("Refs #12, prefix #3", "Clever", "microplane"))
+}
+
+func TestIssueRequirementError(t *testing.T) {
+	ref := issueRef{Org: "Clever", Repo: "tracking", Number: 3}
+	state, label := "open", "Ready-To-Merge"
+	issue := &github.Issue{State: &state, Labels: []github.Label{{Name: &label}}}
+
+	assert.NoError(t, issueRequirementError(ref, issue, "", nil))
+	assert.NoError(t, issueRequirementError(ref, issue, "open", []string{"ready-to-merge"}))
+	err := issueRequirementError(ref, issue, "closed", nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, "linked issue Clever/tracking#3 is open, not closed", err.Error())
+	}
+	assert.Error(t, issueRequirementError(ref, issue, "", []string{"ready-to-merge", "approved"}))
+}
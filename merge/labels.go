@@ -0,0 +1,80 @@
+package merge
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+)
+
+// Outcome labels, applied to PRs so that a campaign's progress can be filtered in Github's UI
+const (
+	LabelAwaitingReview = "mp-awaiting-review"
+	LabelBuildPending   = "mp-build-pending"
+	LabelBuildFailed    = "mp-build-failed"
+	LabelNotMergeable   = "mp-not-mergeable"
+	LabelAutoMerge      = "mp-auto-merge"
+)
+
+var outcomeLabels = []string{LabelAwaitingReview, LabelBuildPending, LabelBuildFailed, LabelNotMergeable, LabelAutoMerge}
+
+// OutcomeLabel determines which outcome label a PR should have, given the result of merging it.
+// It returns "" if the PR shouldn't have one, e.g. because it was merged.
+func OutcomeLabel(output Output, err error) string {
+	if err == nil {
+		if output.AutoMergeEnabled {
+			return LabelAutoMerge
+		}
+		return ""
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "PR awaiting review"), strings.Contains(msg, "PR is not approved"):
+		return LabelAwaitingReview
+	case strings.Contains(msg, "instead was 'pending'"):
+		return LabelBuildPending
+	case strings.Contains(msg, "status was not 'success'"), strings.Contains(msg, "blocking status check"),
+		strings.Contains(msg, "newest passing status check"):
+		return LabelBuildFailed
+	case strings.Contains(msg, "PR is not mergeable"), strings.Contains(msg, "PR merge state is not clean"):
+		return LabelNotMergeable
+	}
+	return ""
+}
+
+// GitHubSetOutcomeLabel sets a PR's outcome label, removing any outcome labels from previous runs.
+// If label is "", all outcome labels are removed.
+func GitHubSetOutcomeLabel(ctx context.Context, org, repo string, prNumber int, label string, repoLimiter *time.Ticker) error {
+	client := ghclient.New(ctx, ghclient.Campaign)
+	<-repoLimiter.C
+	current, _, err := client.Issues.ListLabelsByIssue(ctx, org, repo, prNumber, nil)
+	if err != nil {
+		return err
+	}
+
+	hasLabel := false
+	for _, l := range current {
+		name := l.GetName()
+		if name == label {
+			hasLabel = true
+			continue
+		}
+		for _, outcome := range outcomeLabels {
+			if name == outcome {
+				<-repoLimiter.C
+				if _, err := client.Issues.RemoveLabelForIssue(ctx, org, repo, prNumber, name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if label != "" && !hasLabel {
+		<-repoLimiter.C
+		if _, _, err := client.Issues.AddLabelsToIssue(ctx, org, repo, prNumber, []string{label}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
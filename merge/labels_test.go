@@ -0,0 +1,18 @@
+package merge
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutcomeLabel(t *testing.T) {
+	assert.Equal(t, "", OutcomeLabel(Output{Success: true}, nil))
+	assert.Equal(t, LabelAutoMerge, OutcomeLabel(Output{AutoMergeEnabled: true}, nil))
+	assert.Equal(t, LabelAwaitingReview, OutcomeLabel(Output{}, fmt.Errorf("PR awaiting review")))
+	assert.Equal(t, LabelBuildPending, OutcomeLabel(Output{}, fmt.Errorf("status was not 'success', instead was 'pending'")))
+	assert.Equal(t, LabelBuildFailed, OutcomeLabel(Output{}, fmt.Errorf("status was not 'success', instead was 'failure'")))
+	assert.Equal(t, LabelNotMergeable, OutcomeLabel(Output{}, fmt.Errorf("PR is not mergeable")))
+	assert.Equal(t, "", OutcomeLabel(Output{}, fmt.Errorf("connection reset")))
+}
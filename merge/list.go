@@ -0,0 +1,84 @@
+package merge
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// listReviews lists all of a PR's reviews, across all pages
+func listReviews(ctx context.Context, client *github.Client, input Input, repoLimiter *time.Ticker) ([]*github.PullRequestReview, error) {
+	all := []*github.PullRequestReview{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		var reviews []*github.PullRequestReview
+		var resp *github.Response
+		err := input.Retry.retry(ctx, func() (*github.Response, error) {
+			<-repoLimiter.C
+			var err error
+			reviews, resp, err = client.PullRequests.ListReviews(ctx, input.Org, input.Repo, input.PRNumber, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, reviews...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// combinedStatus gets the combined status of a commit, with the statuses from all pages
+func combinedStatus(ctx context.Context, client *github.Client, input Input, repoLimiter *time.Ticker) (*github.CombinedStatus, error) {
+	var combined *github.CombinedStatus
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		var status *github.CombinedStatus
+		var resp *github.Response
+		err := input.Retry.retry(ctx, func() (*github.Response, error) {
+			<-repoLimiter.C
+			var err error
+			status, resp, err = client.Repositories.GetCombinedStatus(ctx, input.Org, input.Repo, input.CommitSHA, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if combined == nil {
+			combined = status
+		} else {
+			combined.Statuses = append(combined.Statuses, status.Statuses...)
+		}
+		if resp.NextPage == 0 {
+			return combined, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// listCommits lists all of a PR's commits
+func listCommits(ctx context.Context, client *github.Client, input Input, repoLimiter *time.Ticker) ([]*github.RepositoryCommit, error) {
+	all := []*github.RepositoryCommit{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		var commits []*github.RepositoryCommit
+		var resp *github.Response
+		err := input.Retry.retry(ctx, func() (*github.Response, error) {
+			<-repoLimiter.C
+			var err error
+			commits, resp, err = client.PullRequests.ListCommits(ctx, input.Org, input.Repo, input.PRNumber, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, commits...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,52 @@
+package merge
+
+import (
+	"context"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+)
+
+// LivePR is a PR's current state on Github, to compare against microplane's saved state
+type LivePR struct {
+	// State is "open" or "closed"
+	State          string
+	Merged         bool
+	MergeCommitSHA string
+	MergedBy       string
+	MergedAt       time.Time
+	HeadSHA        string
+	// BuildState is the combined status of the PR's head: "success", "pending" or "failure"
+	BuildState string
+}
+
+// GitHubLivePR re-fetches a PR's state, its head's build status, and whether it's been merged
+func GitHubLivePR(ctx context.Context, input Input, repoLimiter *time.Ticker) (LivePR, error) {
+	client := ghclient.New(ctx, ghclient.Discovery)
+	var pr LivePR
+	<-repoLimiter.C
+	p, _, err := client.PullRequests.Get(ctx, input.Org, input.Repo, input.PRNumber)
+	if err != nil {
+		return pr, err
+	}
+	pr = LivePR{
+		State:          p.GetState(),
+		Merged:         p.GetMerged(),
+		MergeCommitSHA: p.GetMergeCommitSHA(),
+		MergedBy:       p.GetMergedBy().GetLogin(),
+		MergedAt:       p.GetMergedAt(),
+		HeadSHA:        p.GetHead().GetSHA(),
+	}
+	if !pr.Merged {
+		// only an unmerged PR's merge commit SHA is a test merge, which isn't worth comparing
+		pr.MergeCommitSHA = ""
+	}
+
+	input.CommitSHA = pr.HeadSHA
+	status, err := combinedStatus(ctx, client, input, repoLimiter)
+	if err != nil {
+		return pr, err
+	}
+	pr.BuildState = buildState(status, input.IgnoreContexts)
+	return pr, nil
+}
@@ -3,12 +3,12 @@ package merge
 import (
 	"context"
 	"fmt"
-	"os"
+	"strings"
 	"time"
-	"net/url"
 
+	"github.com/Clever/microplane/ghclient"
+	"github.com/Clever/microplane/verbosity"
 	"github.com/google/go-github/github"
-	"golang.org/x/oauth2"
 )
 
 // Input to Push()
@@ -22,17 +22,115 @@ type Input struct {
 	// CommitSHA for the commit which opened the above PR. Used to look up Commit status.
 	CommitSHA string
 	// RequireReviewApproval specifies if the PR must be approved before merging
-	// - must have at least 1 reviewer
+	// - must have at least MinApprovals reviewers
 	// - all reviewers must have explicitly approved
 	RequireReviewApproval bool
+	// MinApprovals is how many distinct reviewers must approve with RequireReviewApproval. Defaults to 1.
+	MinApprovals int
+	// ApprovalsFromProtection uses the base branch protection's required approving review count
+	// as MinApprovals, so each repo's own policy applies. MinApprovals is used if the branch isn't protected
+	// or its protection can't be read, e.g. the token lacks admin access.
+	ApprovalsFromProtection bool
 	// RequireBuildSuccess specifies if the PR must have a successful build before merging
 	RequireBuildSuccess bool
+	// IgnoreContexts are status check contexts that don't count towards RequireBuildSuccess,
+	// e.g. path-scoped checks in a monorepo that don't run for this change
+	IgnoreContexts []string
+	// BlockingContexts are status check contexts or check run names that block merging if they fail,
+	// regardless of RequireBuildSuccess, e.g. a breaking change detector
+	BlockingContexts []string
+	// MinExpectedChecks, if set, waits up to BuildTimeout for at least this many status checks and check runs
+	// to be present on the commit before checking its build, so that a PR isn't merged before CI has registered
+	// all its checks. Github only.
+	MinExpectedChecks int
+	// BuildTimeout is how long to wait for MinExpectedChecks. Defaults to DefaultBuildTimeout.
+	BuildTimeout time.Duration
+	// MaxCheckAge, if set, requires the newest passing status check or check run to be more recent than this,
+	// so that a PR isn't merged on a stale build, e.g. one from before the base branch moved
+	MaxCheckAge time.Duration
+	// RequireCleanMergeState specifies if the PR's mergeable_state must be "clean",
+	// which is stricter than being mergeable, e.g. it excludes PRs that are behind the base branch
+	RequireCleanMergeState bool
+	// RebaseBeforeMerge rebases a PR that's behind its base branch in the local repo at PlanDir,
+	// and force-pushes it, rather than merging the base branch in. It then waits for CI to re-run before merging.
+	RebaseBeforeMerge bool
+	// PlanDir is the local repo containing the PR's branch, see RebaseBeforeMerge
+	PlanDir string
+	// GateCommand, if set, is an external merge gate run after the built-in ones, see runGateCommand
+	GateCommand string
+	// MarkReadyForReview marks a draft PR as ready for review once it passes the other gates, so it can be merged.
+	// Otherwise, draft PRs aren't merged.
+	MarkReadyForReview bool
+	// RetargetBaseBranch retargets the PR to the repo's default branch if its base branch has been deleted or renamed
+	RetargetBaseBranch bool
+	// AdminOverride merges as a repo admin, bypassing the base branch's protection rules.
+	// This requires the token to have admin access, and should only be used for emergencies.
+	AdminOverride bool
+	// RecordAdminEnforcement, if set, is called with lifted=true before AdminOverride lifts the base branch's
+	// admin enforcement, and with lifted=false once it's restored, so that enforcement left lifted by a crash
+	// can be restored later, see GitHubRestoreAdminEnforcement
+	RecordAdminEnforcement func(branch string, lifted bool) error `json:"-"`
+	// AcquireMergeSlot, if set, is called just before the merge API call, which waits until it returns. The release
+	// func it returns is called once the merge call has returned, e.g. to cap merges in flight in an org.
+	AcquireMergeSlot func(ctx context.Context) (release func(), err error) `json:"-"`
+	// Window, if set, is checked again just before the merge call, since waiting on the other gates,
+	// e.g. a rebase's build, can outlast it
+	Window *Window `json:"-"`
+	// MergeMethod is how the PR is merged: "merge", "squash" or "rebase". Defaults to "merge".
+	MergeMethod string
+	// CoAuthors adds a "Co-authored-by" trailer to the commit message for each author of the PR's commits.
+	// It only applies to squash merges.
+	CoAuthors bool
+	// EnableAutoMerge enables Github's auto-merge on the PR rather than merging it directly, once it passes
+	// the other gates, leaving Github to merge it once its required checks pass instead of waiting for its build
+	EnableAutoMerge bool
+	// NeverMergeWithChangesRequested blocks merging while any reviewer's latest review requests changes,
+	// even if RequireReviewApproval is off. Gitlab has no equivalent review state, so it's ignored there.
+	NeverMergeWithChangesRequested bool
+	// ProhibitSelfApproval requires an approval from someone other than the PR's author, the token user and Operator
+	ProhibitSelfApproval bool
+	// Operator is the login of the person running the merge, whose approvals don't count with ProhibitSelfApproval
+	Operator string
+	// DispatchWorkflow, if set, is a Github Actions workflow (file name or ID) run on the base branch after merging,
+	// e.g. to deploy. Failing to dispatch it is only a warning.
+	DispatchWorkflow string
+	// DispatchEvent, if set, is the type of a repository_dispatch event sent after merging, see DispatchWorkflow
+	DispatchEvent string
+	// KeepBranch leaves the PR's branch in place after merging, rather than deleting it
+	KeepBranch bool
+	// NoChecksPolicy is the build state of a commit with no status checks or check runs once NoChecksGracePeriod
+	// has passed since it was pushed: NoChecksPending (the default), NoChecksSuccess or NoChecksFailure
+	NoChecksPolicy      string
+	NoChecksGracePeriod time.Duration
+	// ExpectedHeadSHA, if set, is the commit that was pushed. The PR isn't merged if its head has changed since,
+	// e.g. someone pushed extra commits to the branch after it was reviewed.
+	ExpectedHeadSHA string
+	// LinkedIssueState and LinkedIssueLabels, if either is set, require the PR to link issues with closing keywords,
+	// e.g. "Fixes #123", that are in this state ("open" or "closed") and have all of these labels
+	LinkedIssueState  string
+	LinkedIssueLabels []string
+	// Retry is how transient API failures are retried, and how Github's background computations are polled
+	Retry RetryPolicy
 }
 
 // Output from Push()
 type Output struct {
 	Success        bool
 	MergeCommitSHA string
+	// AdminOverride records that branch protection was bypassed for this merge
+	AdminOverride bool
+	// AutoMergeEnabled records that the PR was left for Github to merge, see Input.EnableAutoMerge
+	AutoMergeEnabled bool `json:",omitempty"`
+	// LingeringBranch is the PR's branch, if the merge succeeded but the branch could not be deleted
+	LingeringBranch string `json:",omitempty"`
+	// Warnings are non-fatal problems, e.g. the branch could not be deleted
+	Warnings []string `json:",omitempty"`
+	// MergedBy is the user who merged the PR
+	MergedBy string
+	// MergedAt is when the PR was merged
+	MergedAt time.Time
+	// Splits are the outcomes of merging each PR, when the change was split into several PRs
+	Splits []Output `json:",omitempty"`
 }
 
 // Error and details from Push()
@@ -42,89 +140,346 @@ type Error struct {
 }
 
 // Merge an open PR in Github
-// - repoLimiter rate limits the # of calls to Github
+// - repoLimiter rate limits the # of calls to Github to check the PR, which can proceed in parallel across repos
 // - mergeLimiter rate limits # of merges, to prevent load when submitting builds to CI system
+//
+// Only the merge call itself waits for mergeLimiter, so a slow merge cadence doesn't hold up other repos' checks.
 func GitHubMerge(ctx context.Context, input Input, repoLimiter *time.Ticker, mergeLimiter *time.Ticker) (Output, error) {
-	// Create Github Client
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: os.Getenv("GITHUB_API_TOKEN")},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
-
-	if os.Getenv("GITHUB_URL") != "" {
-		baseEndpoint, _ := url.Parse(os.Getenv("GITHUB_URL"))
-		client.BaseURL = baseEndpoint
-		uploadEndpoint, _ := url.Parse(os.Getenv("GITHUB_URL") + "upload/")
-		client.UploadURL = uploadEndpoint
-	}
+	client := ghclient.New(ctx, ghclient.Campaign)
 
 	// OK to merge?
 
 	// (1) Check if the PR is mergeable
-	<-repoLimiter.C
-	pr, _, err := client.PullRequests.Get(ctx, input.Org, input.Repo, input.PRNumber)
+	pr, err := getPR(ctx, client, input, repoLimiter)
 	if err != nil {
 		return Output{Success: false}, err
 	}
 
 	if pr.GetMerged() {
 		// Success! already merged
-		return Output{Success: true, MergeCommitSHA: pr.GetMergeCommitSHA()}, nil
+		return Output{Success: true, MergeCommitSHA: pr.GetMergeCommitSHA(), MergedBy: pr.GetMergedBy().GetLogin(), MergedAt: pr.GetMergedAt()}, nil
 	}
 
-	if !pr.GetMergeable() {
-		return Output{Success: false}, fmt.Errorf("PR is not mergeable")
+	verbosity.Debugf("%s/%s - gate: mergeable=%v state=%s mergeable_state=%s", input.Org, input.Repo, pr.GetMergeable(), pr.GetState(), pr.GetMergeableState())
+	if !pr.GetMergeable() || pr.GetState() == "closed" {
+		// Maybe the base branch is gone, e.g. renamed while the PR was open
+		pr, err = checkBaseBranch(ctx, client, input, pr, input.RetargetBaseBranch, repoLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		if !pr.GetMergeable() {
+			return Output{Success: false}, fmt.Errorf("PR is not mergeable")
+		}
+	}
+
+	if input.ExpectedHeadSHA != "" && pr.GetHead().GetSHA() != input.ExpectedHeadSHA {
+		return Output{Success: false}, fmt.Errorf("head branch changed since push: expected %s, found %s", input.ExpectedHeadSHA, pr.GetHead().GetSHA())
+	}
+
+	if input.RebaseBeforeMerge {
+		// The branch may have been rebased by a previous run, so the PR's head is the commit to check
+		input.CommitSHA = pr.GetHead().GetSHA()
+		if pr.GetMergeableState() == "behind" {
+			verbosity.Printf("%s/%s - behind %s, rebasing", input.Org, input.Repo, pr.GetBase().GetRef())
+			sha, err := rebaseBranch(ctx, input.PlanDir, pr.GetBase().GetRef(), pr.GetHead().GetRef(), pr.GetHead().GetSHA())
+			if err != nil {
+				return Output{Success: false}, err
+			}
+			input.CommitSHA = sha
+			if err := waitForBuild(ctx, client, input, repoLimiter); err != nil {
+				return Output{Success: false}, err
+			}
+			pr, err = getPR(ctx, client, input, repoLimiter)
+			if err != nil {
+				return Output{Success: false}, err
+			}
+		}
+	}
+
+	isDraft := pr.GetMergeableState() == "draft"
+	if isDraft && !input.MarkReadyForReview {
+		return Output{Success: false}, fmt.Errorf("PR is a draft")
+	}
+
+	if input.RequireCleanMergeState {
+		// a draft's state can only be checked once it's ready for review
+		if state := pr.GetMergeableState(); state != "clean" && !isDraft {
+			return Output{Success: false}, fmt.Errorf("PR merge state is not clean: %s", describeMergeableState(state))
+		}
 	}
 
 	// (2) Check commit status
-	<-repoLimiter.C
-	status, _, err := client.Repositories.GetCombinedStatus(ctx, input.Org, input.Repo, input.CommitSHA, &github.ListOptions{})
+	var status *github.CombinedStatus
+	if input.MinExpectedChecks > 0 {
+		status, err = waitForChecks(ctx, client, input, repoLimiter)
+	} else {
+		status, err = combinedStatus(ctx, client, input, repoLimiter)
+	}
 	if err != nil {
 		return Output{Success: false}, err
 	}
 
-	if input.RequireBuildSuccess {
-		state := status.GetState()
-		if state != "success" {
-			return Output{Success: false}, fmt.Errorf("status was not 'success', instead was '%s'", state)
+	// with auto-merge, Github waits for the build to pass rather than microplane, see below
+	requireBuildSuccess := input.RequireBuildSuccess && !input.EnableAutoMerge
+	// check runs, e.g. from Github Actions, count towards the build and the gates on status checks
+	var runs []checkRun
+	if requireBuildSuccess || input.MaxCheckAge > 0 || len(input.BlockingContexts) > 0 {
+		if runs, err = listCheckRuns(ctx, client, input, repoLimiter); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+	state, reason := buildState(status, input.IgnoreContexts), ""
+	if requireBuildSuccess {
+		state, reason, err = checksBuildState(input, status, runs, func() (time.Time, error) {
+			return headPushedAt(ctx, client, input, pr, repoLimiter)
+		})
+		if err != nil {
+			return Output{Success: false}, err
+		}
+	}
+	verbosity.Debugf("%s/%s - gate: build status=%s (required=%v)", input.Org, input.Repo, state, requireBuildSuccess)
+	if requireBuildSuccess && state != "success" {
+		if reason != "" {
+			return Output{Success: false}, fmt.Errorf("status was not 'success', instead was '%s': %s", state, reason)
+		}
+		return Output{Success: false}, fmt.Errorf("status was not 'success', instead was '%s'", state)
+	}
+	if failing := failingContexts(status, runs, input.BlockingContexts); len(failing) > 0 {
+		return Output{Success: false}, fmt.Errorf("blocking status check(s) failed: %s", strings.Join(failing, ", "))
+	}
+	if input.MaxCheckAge > 0 {
+		newest := newestSuccess(status, runs, input.IgnoreContexts)
+		if newest.IsZero() {
+			return Output{Success: false}, fmt.Errorf("no passing status checks or check runs, can't verify they are newer than %s", input.MaxCheckAge)
+		}
+		if age := time.Since(newest); age > input.MaxCheckAge {
+			return Output{Success: false}, fmt.Errorf("newest passing status check or check run is %s old, older than %s. Re-run CI to merge", age.Round(time.Minute), input.MaxCheckAge)
 		}
 	}
 
 	// (3) check if PR has been approved by a reviewer
-	<-repoLimiter.C
-	reviews, _, err := client.PullRequests.ListReviews(ctx, input.Org, input.Repo, input.PRNumber, &github.ListOptions{})
+	reviews, err := listReviews(ctx, client, input, repoLimiter)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	minApprovals := input.MinApprovals
+	if input.RequireReviewApproval && input.ApprovalsFromProtection {
+		minApprovals = requiredApprovals(ctx, client, input, pr.GetBase().GetRef(), repoLimiter)
+	}
+	verbosity.Debugf("%s/%s - gate: %d review(s), approval error=%v (required=%v)", input.Org, input.Repo, len(reviews), approvalError(reviews, minApprovals), input.RequireReviewApproval)
 	if input.RequireReviewApproval {
-		if len(reviews) == 0 {
-			return Output{Success: false}, fmt.Errorf("PR awaiting review")
+		if err := approvalError(reviews, minApprovals); err != nil {
+			return Output{Success: false}, err
 		}
-		for _, r := range reviews {
-			if r.GetState() != "APPROVED" {
-				return Output{Success: false}, fmt.Errorf("PR is not approved. Review state is %s", r.GetState())
-			}
+	}
+	if input.NeverMergeWithChangesRequested {
+		if err := changesRequestedError(reviews); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+	if input.ProhibitSelfApproval {
+		excluded, err := selfApprovers(ctx, client, input, pr, repoLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		if err := selfApprovalError(reviews, excluded); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	if input.LinkedIssueState != "" || len(input.LinkedIssueLabels) > 0 {
+		if err := linkedIssuesError(ctx, client, input, pr, repoLimiter); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	// (4) check the external gate
+	if input.GateCommand != "" {
+		if err := runGateCommand(ctx, input.GateCommand, input, pr); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	if isDraft {
+		verbosity.Printf("%s/%s - draft PR passed all gates, marking it ready for review", input.Org, input.Repo)
+		if err := markReadyForReview(ctx, client, pr, repoLimiter); err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	if input.EnableAutoMerge {
+		// the PR passed all of microplane's gates but the build, which Github waits for before merging it
+		if err := enableAutoMerge(ctx, client, pr, input.MergeMethod, repoLimiter); err != nil {
+			return Output{Success: false}, err
 		}
+		return Output{Success: false, AutoMergeEnabled: true}, nil
 	}
 
 	// Merge the PR
-	options := &github.PullRequestOptions{}
+	options := &github.PullRequestOptions{MergeMethod: input.MergeMethod}
 	commitMsg := ""
+	if input.CoAuthors && input.MergeMethod == "squash" {
+		commits, err := listCommits(ctx, client, input, repoLimiter)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+		commitMsg = squashCommitMessage(commits)
+	}
+	if err := windowError(input.Window, time.Now()); err != nil {
+		return Output{Success: false}, err
+	}
+	// the slot is taken before lifting admin enforcement, so that it isn't lifted while waiting for one
+	release, err := acquireMergeSlot(ctx, input)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	restoreProtection := func() error { return nil }
+	if input.AdminOverride {
+		restoreProtection, err = liftAdminEnforcement(ctx, client, input, pr.GetBase().GetRef(), repoLimiter)
+		if err != nil {
+			release()
+			return Output{Success: false}, fmt.Errorf("admin override failed: %s", err.Error())
+		}
+	}
 	<-mergeLimiter.C
-	<-repoLimiter.C
 	result, _, err := client.PullRequests.Merge(ctx, input.Org, input.Repo, input.PRNumber, commitMsg, options)
+	release()
 	if err != nil {
+		// the merge may have gone through even though its response didn't make it back, e.g. on a 502,
+		// so it's only retried if the PR is still unmerged
+		<-repoLimiter.C
+		if merged, _, getErr := client.PullRequests.Get(ctx, input.Org, input.Repo, input.PRNumber); getErr == nil && merged.GetMerged() {
+			result, err = &github.PullRequestMergeResult{Merged: merged.Merged, SHA: merged.MergeCommitSHA}, nil
+		}
+	}
+	restoreErr := restoreProtection()
+	if restoreErr != nil {
+		restoreErr = fmt.Errorf("failed to restore branch protection for admins on %s, the next merge run will retry: %s", pr.GetBase().GetRef(), restoreErr.Error())
+	}
+	if err == nil && !result.GetMerged() {
+		err = fmt.Errorf("failed to merge: %s", result.GetMessage())
+	}
+	if err != nil {
+		if restoreErr != nil {
+			return Output{Success: false}, fmt.Errorf("%s, and %s", err.Error(), restoreErr.Error())
+		}
 		return Output{Success: false}, err
 	}
+	output := Output{Success: true, MergeCommitSHA: result.GetSHA(), AdminOverride: input.AdminOverride, MergedAt: time.Now().UTC()}
+	if restoreErr != nil {
+		output.Warnings = append(output.Warnings, "merged, but "+restoreErr.Error())
+	}
+
+	// Record who merged and when, for auditing
+	<-repoLimiter.C
+	if merged, _, err := client.PullRequests.Get(ctx, input.Org, input.Repo, input.PRNumber); err == nil {
+		output.MergedBy = merged.GetMergedBy().GetLogin()
+		output.MergedAt = merged.GetMergedAt()
+	} else {
+		output.Warnings = append(output.Warnings, fmt.Sprintf("merged, but failed to look up who merged it: %s", err.Error()))
+		// the PR was merged with the campaign token, so its user is who merged it
+		if login, err := GitHubLogin(ctx, ghclient.Campaign, repoLimiter); err == nil {
+			output.MergedBy = login
+		}
+	}
+
+	// Delete the branch. The merge already happened, so a failure here is only a warning,
+	// and the branch is left for a later run to delete.
+	if input.KeepBranch {
+		verbosity.Debugf("%s/%s - keeping branch %s", input.Org, input.Repo, pr.GetHead().GetRef())
+	} else if _, err := deleteBranch(ctx, client, input.Org, input.Repo, pr.GetHead().GetRef(), input.Retry, repoLimiter); err != nil {
+		output.LingeringBranch = pr.GetHead().GetRef()
+		output.Warnings = append(output.Warnings, fmt.Sprintf("merged, but failed to delete branch %s: %s", output.LingeringBranch, err.Error()))
+	}
+
+	// Kick off a build of the base branch, on a best-effort basis
+	if err := dispatchBuild(ctx, client, input, pr, repoLimiter); err != nil {
+		output.Warnings = append(output.Warnings, fmt.Sprintf("merged, but %s", err.Error()))
+	}
+
+	return output, nil
+}
 
-	if !result.GetMerged() {
-		return Output{Success: false}, fmt.Errorf("failed to merge: %s", result.GetMessage())
+// acquireMergeSlot calls input.AcquireMergeSlot, if set
+func acquireMergeSlot(ctx context.Context, input Input) (func(), error) {
+	if input.AcquireMergeSlot == nil {
+		return func() {}, nil
 	}
+	return input.AcquireMergeSlot(ctx)
+}
+
+// describeMergeableState explains Github's mergeable_state values
+func describeMergeableState(state string) string {
+	switch state {
+	case "behind":
+		return "behind (head branch is out of date with the base branch)"
+	case "blocked":
+		return "blocked (merging is blocked, e.g. by a required review or status check)"
+	case "dirty":
+		return "dirty (merge conflicts with the base branch)"
+	case "draft":
+		return "draft (PR is still a draft)"
+	case "unstable":
+		return "unstable (some non-required status checks are failing)"
+	case "has_hooks":
+		return "has_hooks (pre-receive hooks may reject the merge)"
+	case "unknown", "":
+		return "unknown (Github has not yet computed mergeability, try again shortly)"
+	}
+	return state
+}
+
+// approvalError returns why a PR's reviews don't approve it, or nil if the PR is approved
+// - must have at least minApprovals reviewers (at least 1)
+// - all reviewers must have explicitly approved
+func approvalError(reviews []*github.PullRequestReview, minApprovals int) error {
+	if len(reviews) == 0 {
+		return fmt.Errorf("PR awaiting review")
+	}
+	approvers := map[string]bool{}
+	for _, r := range reviews {
+		if r.GetState() != "APPROVED" {
+			return fmt.Errorf("PR is not approved. Review state is %s", r.GetState())
+		}
+		approvers[strings.ToLower(r.GetUser().GetLogin())] = true
+	}
+	if len(approvers) < minApprovals {
+		return fmt.Errorf("PR awaiting review: %d of %d required approvals", len(approvers), minApprovals)
+	}
+	return nil
+}
 
-	// Delete the branch
+// GitHubApproval is a lightweight check of whether a PR satisfies the review approval gate,
+// without checking anything else. It returns nil if the PR is approved.
+func GitHubApproval(ctx context.Context, input Input, repoLimiter *time.Ticker) (approvalErr error, err error) {
+	client := ghclient.New(ctx, ghclient.Campaign)
+	reviews, err := listReviews(ctx, client, input, repoLimiter)
+	if err != nil {
+		return nil, err
+	}
+	if input.NeverMergeWithChangesRequested {
+		if err := changesRequestedError(reviews); err != nil {
+			return err, nil
+		}
+	}
+	if !input.ApprovalsFromProtection && !input.ProhibitSelfApproval {
+		return approvalError(reviews, input.MinApprovals), nil
+	}
 	<-repoLimiter.C
-	_, err = client.Git.DeleteRef(ctx, input.Org, input.Repo, "heads/"+*pr.Head.Ref)
+	pr, _, err := client.PullRequests.Get(ctx, input.Org, input.Repo, input.PRNumber)
 	if err != nil {
-		return Output{Success: false}, err
+		return nil, err
 	}
-
-	return Output{Success: true, MergeCommitSHA: result.GetSHA()}, nil
+	minApprovals := input.MinApprovals
+	if input.ApprovalsFromProtection {
+		minApprovals = requiredApprovals(ctx, client, input, pr.GetBase().GetRef(), repoLimiter)
+	}
+	if err := approvalError(reviews, minApprovals); err != nil || !input.ProhibitSelfApproval {
+		return err, nil
+	}
+	excluded, err := selfApprovers(ctx, client, input, pr, repoLimiter)
+	if err != nil {
+		return nil, err
+	}
+	return selfApprovalError(reviews, excluded), nil
 }
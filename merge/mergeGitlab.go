@@ -11,9 +11,21 @@ import (
 )
 
 // Merge an open MR in Gitlab
-// - repoLimiter rate limits the # of calls to Github
+// - repoLimiter rate limits the # of calls to Gitlab to check the MR, which can proceed in parallel across repos
 // - mergeLimiter rate limits # of merges, to prevent load when submitting builds to CI system
+//
+// Only the merge call itself waits for mergeLimiter, so a slow merge cadence doesn't hold up other repos' checks.
 func GitlabMerge(ctx context.Context, input Input, repoLimiter *time.Ticker, mergeLimiter *time.Ticker) (Output, error) {
+	if input.EnableAutoMerge {
+		return Output{Success: false}, fmt.Errorf("auto-merge is only supported on Github")
+	}
+	if input.DispatchWorkflow != "" || input.DispatchEvent != "" {
+		return Output{Success: false}, fmt.Errorf("dispatching a build after merging is only supported on Github")
+	}
+	if input.LinkedIssueState != "" || len(input.LinkedIssueLabels) > 0 {
+		return Output{Success: false}, fmt.Errorf("requiring linked issues is only supported on Github")
+	}
+
 	// Create Gitlab Client
 	ctxFunc := gitlab.WithContext(ctx)
 
@@ -39,6 +51,9 @@ func GitlabMerge(ctx context.Context, input Input, repoLimiter *time.Ticker, mer
 	if mr.MergeStatus != "can_be_merged" {
 		return Output{Success: false}, fmt.Errorf("MR is not mergeable")
 	}
+	if input.ExpectedHeadSHA != "" && mr.SHA != input.ExpectedHeadSHA {
+		return Output{Success: false}, fmt.Errorf("head branch changed since push: expected %s, found %s", input.ExpectedHeadSHA, mr.SHA)
+	}
 
 	// (2) Check commit status
 	<-repoLimiter.C
@@ -72,14 +87,72 @@ func GitlabMerge(ctx context.Context, input Input, repoLimiter *time.Ticker, mer
 	}
 
 	// Merge the MR
+	if err := windowError(input.Window, time.Now()); err != nil {
+		return Output{Success: false}, err
+	}
+	release, err := acquireMergeSlot(ctx, input)
+	if err != nil {
+		return Output{Success: false}, err
+	}
 	<-mergeLimiter.C
-	<-repoLimiter.C
+	removeSourceBranch := !input.KeepBranch
 	result, _, err := client.MergeRequests.AcceptMergeRequest(pid, input.PRNumber, &gitlab.AcceptMergeRequestOptions{
-		ShouldRemoveSourceBranch: &truePointer,
+		ShouldRemoveSourceBranch: &removeSourceBranch,
 	}, ctxFunc)
+	release()
 	if err != nil {
-		return Output{Success: false}, err
+		// the merge may have gone through even though its response didn't make it back, see GitHubMerge
+		<-repoLimiter.C
+		merged, _, getErr := client.MergeRequests.GetMergeRequest(pid, input.PRNumber, &gitlab.GetMergeRequestsOptions{}, ctxFunc)
+		if getErr != nil || merged.State != "merged" {
+			return Output{Success: false}, err
+		}
+		result = &gitlab.MergeRequest{SHA: merged.MergeCommitSHA}
+	}
+	output := Output{Success: true, MergeCommitSHA: result.SHA, MergedAt: time.Now().UTC()}
+
+	// Record who merged, for auditing. The MR was accepted as the token's user.
+	<-repoLimiter.C
+	if user, _, err := client.Users.CurrentUser(ctxFunc); err == nil {
+		output.MergedBy = user.Username
 	}
+	return output, nil
+}
 
-	return Output{Success: true, MergeCommitSHA: result.SHA}, nil
+// GitlabApproval is a lightweight check of whether an MR satisfies the review approval gate,
+// without checking anything else. It returns nil if the MR is approved.
+func GitlabApproval(ctx context.Context, input Input, repoLimiter *time.Ticker) (approvalErr error, err error) {
+	client := gitlab.NewClient(nil, os.Getenv("GITLAB_API_TOKEN"))
+	if os.Getenv("GITLAB_URL") != "" {
+		client.SetBaseURL(os.Getenv("GITLAB_URL"))
+	}
+
+	<-repoLimiter.C
+	pid := fmt.Sprintf("%s/%s", input.Org, input.Repo)
+	approvals, _, err := client.MergeRequests.GetMergeRequestApprovals(pid, input.PRNumber, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if approvals.ApprovalsRequired > len(approvals.ApprovedBy) {
+		return fmt.Errorf("MR is not approved. %d of %d required approvals", len(approvals.ApprovedBy), approvals.ApprovalsRequired), nil
+	}
+	return nil, nil
+}
+
+// GitlabBuildState is a lightweight check of the pipeline status of the MR's head commit, see GitHubBuildState
+func GitlabBuildState(ctx context.Context, input Input, repoLimiter *time.Ticker) (state, head string, err error) {
+	client := gitlab.NewClient(nil, os.Getenv("GITLAB_API_TOKEN"))
+	if os.Getenv("GITLAB_URL") != "" {
+		client.SetBaseURL(os.Getenv("GITLAB_URL"))
+	}
+
+	<-repoLimiter.C
+	pid := fmt.Sprintf("%s/%s", input.Org, input.Repo)
+	mr, _, err := client.MergeRequests.GetMergeRequest(pid, input.PRNumber, &gitlab.GetMergeRequestsOptions{}, gitlab.WithContext(ctx))
+	if err != nil {
+		return "", "", err
+	}
+	<-repoLimiter.C
+	state, err = push.GetPipelineStatus(client, input.Org, input.Repo, &gitlab.ListProjectPipelinesOptions{SHA: &mr.SHA})
+	return state, mr.SHA, err
 }
@@ -0,0 +1,141 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/Clever/microplane/verbosity"
+	"github.com/google/go-github/github"
+)
+
+// ProtectionReport describes the branch protection rules on a repo's base branch,
+// and which of them would prevent the authenticated user from merging
+type ProtectionReport struct {
+	Branch string
+	// Readable is false if the protection rules could not be read, e.g. the token lacks admin access
+	Readable bool
+	// Gates are the protection rules enabled on the branch
+	Gates []string
+	// Blockers are gates the authenticated user can not satisfy
+	Blockers []string
+	// Warnings are gates we could not fully verify
+	Warnings []string
+}
+
+// GitHubLogin returns the login of an identity's user, e.g. ghclient.Campaign's, which pushes and merges
+func GitHubLogin(ctx context.Context, id ghclient.Identity, repoLimiter *time.Ticker) (string, error) {
+	client := ghclient.New(ctx, id)
+	<-repoLimiter.C
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return "", err
+	}
+	return user.GetLogin(), nil
+}
+
+// GitHubProtectionPreflight reads the protection rules of a branch, so that an operator
+// can find out which repos can't be merged before attempting any merges
+func GitHubProtectionPreflight(ctx context.Context, org, repo, branch, login string, repoLimiter *time.Ticker) (ProtectionReport, error) {
+	client := ghclient.New(ctx, ghclient.Campaign)
+	report := ProtectionReport{Branch: branch}
+
+	<-repoLimiter.C
+	protection, resp, err := client.Repositories.GetBranchProtection(ctx, org, repo, branch)
+	if err != nil {
+		if notProtected(resp) {
+			report.Readable = true
+			return report, nil
+		}
+		if resp != nil && resp.StatusCode == 403 {
+			// Reading protection rules requires admin access to the repo
+			report.Warnings = append(report.Warnings, "unable to read branch protection (requires admin access)")
+			return report, nil
+		}
+		return report, err
+	}
+	report.Readable = true
+
+	if checks := protection.RequiredStatusChecks; checks != nil {
+		gate := fmt.Sprintf("required status checks: %s", strings.Join(checks.Contexts, ", "))
+		if checks.Strict {
+			gate += " (branch must be up to date)"
+		}
+		report.Gates = append(report.Gates, gate)
+	}
+
+	if reviews := protection.RequiredPullRequestReviews; reviews != nil {
+		gate := fmt.Sprintf("required approving reviews: %d", reviews.RequiredApprovingReviewCount)
+		if reviews.RequireCodeOwnerReviews {
+			gate += " (including code owners)"
+		}
+		report.Gates = append(report.Gates, gate)
+	}
+
+	if admins := protection.EnforceAdmins; admins != nil && admins.Enabled {
+		report.Gates = append(report.Gates, "enforced for admins")
+	}
+
+	if restrictions := protection.Restrictions; restrictions != nil {
+		users := []string{}
+		allowed := false
+		for _, u := range restrictions.Users {
+			users = append(users, u.GetLogin())
+			if strings.EqualFold(u.GetLogin(), login) {
+				allowed = true
+			}
+		}
+		teams := []string{}
+		for _, t := range restrictions.Teams {
+			teams = append(teams, t.GetSlug())
+		}
+		report.Gates = append(report.Gates, fmt.Sprintf("merging restricted to users [%s] and teams [%s]",
+			strings.Join(users, ", "), strings.Join(teams, ", ")))
+
+		if !allowed {
+			if len(teams) == 0 {
+				report.Blockers = append(report.Blockers, fmt.Sprintf("%s is not allowed to merge to %s", login, branch))
+			} else {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s is not an allowed user, and may only merge via membership in teams [%s]", login, strings.Join(teams, ", ")))
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// notProtected returns whether a failed request for a branch's protection failed because the branch isn't protected,
+// which Github reports as a 404
+func notProtected(resp *github.Response) bool {
+	return resp != nil && resp.StatusCode == http.StatusNotFound
+}
+
+// requiredApprovals is the number of approving reviews the base branch's protection requires, see
+// Input.ApprovalsFromProtection. It falls back to input.MinApprovals if the protection can't be read.
+func requiredApprovals(ctx context.Context, client *github.Client, input Input, branch string, repoLimiter *time.Ticker) int {
+	var protection *github.Protection
+	var resp *github.Response
+	err := input.Retry.retry(ctx, func() (*github.Response, error) {
+		<-repoLimiter.C
+		var err error
+		protection, resp, err = client.Repositories.GetBranchProtection(ctx, input.Org, input.Repo, branch)
+		return resp, err
+	})
+	if err != nil {
+		if notProtected(resp) {
+			verbosity.Debugf("%s/%s - %s is not protected, requiring %d approval(s)", input.Org, input.Repo, branch, input.MinApprovals)
+		} else {
+			verbosity.Printf("%s/%s - unable to read branch protection on %s, requiring %d approval(s): %s", input.Org, input.Repo, branch, input.MinApprovals, err.Error())
+		}
+		return input.MinApprovals
+	}
+	required := 0
+	if reviews := protection.RequiredPullRequestReviews; reviews != nil {
+		required = reviews.RequiredApprovingReviewCount
+	}
+	verbosity.Debugf("%s/%s - branch protection on %s requires %d approval(s)", input.Org, input.Repo, branch, required)
+	return required
+}
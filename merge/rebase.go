@@ -0,0 +1,74 @@
+package merge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// how long to wait for CI to re-run after rebasing. It's polled with backoff, see Input.Retry.
+const rebaseCITimeout = time.Hour
+
+// rebaseBranch rebases the PR's branch onto the latest base branch in the local repo, and force-pushes it.
+// headSHA is the PR's head commit, which must be the local repo's, and the pushed branch's when it's replaced,
+// so that commits pushed by someone else are never overwritten. It returns the new head commit.
+func rebaseBranch(ctx context.Context, dir, base, head, headSHA string) (string, error) {
+	git := func(args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", errors.New(string(output))
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	local, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	if local != headSHA {
+		return "", fmt.Errorf("the PR's head %s isn't the planned commit %s, it was pushed to since, needs manual attention", headSHA, local)
+	}
+	if _, err := git("fetch", "origin", base); err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %s", base, err.Error())
+	}
+	if _, err := git("rebase", "FETCH_HEAD"); err != nil {
+		git("rebase", "--abort")
+		return "", fmt.Errorf("failed to rebase onto %s, needs manual attention: %s", base, err.Error())
+	}
+	if _, err := git("push", fmt.Sprintf("--force-with-lease=refs/heads/%s:%s", head, headSHA), "origin", "HEAD:refs/heads/"+head); err != nil {
+		return "", fmt.Errorf("failed to push rebased branch: %s", err.Error())
+	}
+	return git("rev-parse", "HEAD")
+}
+
+// waitForBuild polls a commit's status until it's no longer pending
+func waitForBuild(ctx context.Context, client *github.Client, input Input, repoLimiter *time.Ticker) error {
+	pushedAt := time.Now()
+	deadline := pushedAt.Add(rebaseCITimeout)
+	for attempt := 1; ; attempt++ {
+		status, err := combinedStatus(ctx, client, input, repoLimiter)
+		if err != nil {
+			return err
+		}
+		state, _, err := buildStateWithChecks(ctx, client, input, status, func() (time.Time, error) { return pushedAt, nil }, repoLimiter)
+		if err != nil {
+			return err
+		}
+		if state != "pending" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for CI to re-run on the rebased branch", rebaseCITimeout)
+		}
+		if err := input.Retry.sleep(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
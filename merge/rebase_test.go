@@ -0,0 +1,85 @@
+package merge
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testRebaseRemote sets up a bare remote with a "master" base branch and a "microplaning" PR branch,
+// returning a clone checked out on the PR branch, and a function to run git in a directory
+func testRebaseRemote(t *testing.T, dir string) (string, func(dir string, args ...string) string) {
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=mp", "-c", "user.email=mp@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(output))
+		return strings.TrimSpace(string(output))
+	}
+	remote, clone := filepath.Join(dir, "remote.git"), filepath.Join(dir, "planned")
+	git(dir, "init", "-q", "--bare", remote)
+	git(dir, "clone", "-q", remote, clone)
+	git(clone, "checkout", "-q", "-b", "master")
+	git(clone, "commit", "-q", "--allow-empty", "-m", "base")
+	git(clone, "push", "-q", "origin", "master")
+	git(clone, "checkout", "-q", "-b", "microplaning")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(clone, "change"), []byte("change\n"), 0644))
+	git(clone, "add", "change")
+	git(clone, "commit", "-q", "-m", "microplane fun")
+	git(clone, "push", "-q", "origin", "microplaning")
+	git(clone, "config", "user.name", "mp")
+	git(clone, "config", "user.email", "mp@example.com")
+
+	// the base branch moves on
+	other := filepath.Join(dir, "other")
+	git(dir, "clone", "-q", "-b", "master", remote, other)
+	git(other, "commit", "-q", "--allow-empty", "-m", "meanwhile")
+	git(other, "push", "-q", "origin", "master")
+	return clone, git
+}
+
+func TestRebaseBranch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-rebase")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	clone, git := testRebaseRemote(t, dir)
+	remote := filepath.Join(dir, "remote.git")
+
+	sha, err := rebaseBranch(context.Background(), clone, "master", "microplaning", git(clone, "rev-parse", "HEAD"))
+	assert.NoError(t, err)
+	assert.Equal(t, sha, git(remote, "rev-parse", "microplaning"))
+	assert.Equal(t, git(remote, "rev-parse", "master"), git(remote, "rev-parse", "microplaning^"))
+}
+
+func TestRebaseBranchDoesntOverwritePushes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-rebase")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	clone, git := testRebaseRemote(t, dir)
+	remote := filepath.Join(dir, "remote.git")
+	planned := git(clone, "rev-parse", "HEAD")
+
+	// someone else pushes to the PR branch
+	other := filepath.Join(dir, "other")
+	git(other, "fetch", "-q", "origin", "microplaning")
+	git(other, "checkout", "-q", "-b", "microplaning", "FETCH_HEAD")
+	git(other, "commit", "-q", "--allow-empty", "-m", "fixup")
+	git(other, "push", "-q", "origin", "microplaning")
+	pushed := git(remote, "rev-parse", "microplaning")
+
+	// the PR's head isn't the planned commit
+	_, err = rebaseBranch(context.Background(), clone, "master", "microplaning", pushed)
+	assert.Error(t, err)
+	// the PR's head was read before the push, which the lease catches
+	_, err = rebaseBranch(context.Background(), clone, "master", "microplaning", planned)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to push rebased branch")
+	}
+	assert.Equal(t, pushed, git(remote, "rev-parse", "microplaning"))
+}
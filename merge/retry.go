@@ -0,0 +1,136 @@
+package merge
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// RetryPolicy controls how GitHubMerge retries transient failures, and polls for results Github computes
+// in the background, e.g. a PR's mergeability. Zero fields fall back to DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is how many times to try, including the first
+	MaxAttempts int
+	// BaseDelay is the wait after the first attempt. It doubles after each attempt, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter randomizes each delay by up to this fraction, e.g. 0.2 for ±20%, so that repos don't retry in lockstep.
+	// Since 0 falls back to the default, NoJitter disables it.
+	Jitter float64
+	// RetryableStatusCodes are the HTTP statuses worth retrying. Network errors, without a status, are always retried.
+	RetryableStatusCodes []int
+}
+
+// NoJitter is the RetryPolicy.Jitter that disables jitter, e.g. for predictable delays
+const NoJitter = -1
+
+// DefaultRetryPolicy is used for any RetryPolicy fields that aren't set
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:          3,
+	BaseDelay:            time.Second,
+	MaxDelay:             30 * time.Second,
+	Jitter:               0.2,
+	RetryableStatusCodes: []int{500, 502, 503, 504},
+}
+
+// withDefaults fills in unset fields from DefaultRetryPolicy
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	if p.Jitter == 0 {
+		p.Jitter = DefaultRetryPolicy.Jitter
+	} else if p.Jitter < 0 {
+		p.Jitter = 0
+	}
+	if len(p.RetryableStatusCodes) == 0 {
+		p.RetryableStatusCodes = DefaultRetryPolicy.RetryableStatusCodes
+	}
+	return p
+}
+
+// delay is how long to wait after an attempt, numbered from 1, before the next one
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	p = p.withDefaults()
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d + time.Duration((rand.Float64()*2-1)*p.Jitter*float64(d))
+}
+
+// retryable returns whether a failed API call is worth retrying
+func (p RetryPolicy) retryable(resp *github.Response) bool {
+	if resp == nil {
+		return true
+	}
+	for _, code := range p.withDefaults().RetryableStatusCodes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// sleep waits before the next attempt, returning early with the context's error if it's canceled
+func (p RetryPolicy) sleep(ctx context.Context, attempt int) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(p.delay(attempt)):
+		return nil
+	}
+}
+
+// retry calls f until it succeeds, fails with a status that isn't retryable, or runs out of attempts
+func (p RetryPolicy) retry(ctx context.Context, f func() (*github.Response, error)) error {
+	p = p.withDefaults()
+	var err error
+	for attempt := 1; attempt <= p.MaxAttempts; attempt++ {
+		var resp *github.Response
+		resp, err = f()
+		if err == nil || !p.retryable(resp) || attempt == p.MaxAttempts {
+			return err
+		}
+		if sleepErr := p.sleep(ctx, attempt); sleepErr != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// getPR gets a PR, retrying transient failures. If Github hasn't finished computing the PR's mergeability,
+// it polls until it has, or the attempts run out.
+func getPR(ctx context.Context, client *github.Client, input Input, repoLimiter *time.Ticker) (*github.PullRequest, error) {
+	p := input.Retry.withDefaults()
+	var pr *github.PullRequest
+	for attempt := 1; ; attempt++ {
+		err := p.retry(ctx, func() (*github.Response, error) {
+			<-repoLimiter.C
+			var resp *github.Response
+			var err error
+			pr, resp, err = client.PullRequests.Get(ctx, input.Org, input.Repo, input.PRNumber)
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if pr.Mergeable != nil || pr.GetState() != "open" || attempt >= p.MaxAttempts {
+			return pr, nil
+		}
+		if err := p.sleep(ctx, attempt); err != nil {
+			return pr, nil
+		}
+	}
+}
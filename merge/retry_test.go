@@ -0,0 +1,57 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second, Jitter: 0.001}
+	assert.InDelta(t, float64(time.Second), float64(p.delay(1)), float64(10*time.Millisecond))
+	assert.InDelta(t, float64(4*time.Second), float64(p.delay(3)), float64(10*time.Millisecond))
+	assert.InDelta(t, float64(5*time.Second), float64(p.delay(10)), float64(10*time.Millisecond))
+
+	p.Jitter = NoJitter
+	assert.Equal(t, 4*time.Second, p.delay(3))
+	assert.Equal(t, DefaultRetryPolicy.Jitter, RetryPolicy{}.withDefaults().Jitter)
+}
+
+func TestRetryPolicyRetry(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	status := func(code int) *github.Response {
+		return &github.Response{Response: &http.Response{StatusCode: code}}
+	}
+
+	calls := 0
+	err := p.retry(context.Background(), func() (*github.Response, error) {
+		calls++
+		return status(502), fmt.Errorf("bad gateway")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = p.retry(context.Background(), func() (*github.Response, error) {
+		calls++
+		return status(404), fmt.Errorf("not found")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	err = p.retry(context.Background(), func() (*github.Response, error) {
+		calls++
+		if calls == 1 {
+			return nil, fmt.Errorf("connection reset")
+		}
+		return status(200), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,91 @@
+package merge
+
+import (
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// buildState computes the combined state of a commit's statuses, like Github does,
+// except that the ignored contexts don't count towards it
+// - "failure" if any status is "failure" or "error"
+// - "pending" if any status is "pending"
+// - "success" otherwise
+func buildState(status *github.CombinedStatus, ignoreContexts []string) string {
+	if len(ignoreContexts) == 0 {
+		return status.GetState()
+	}
+	ignored := map[string]bool{}
+	for _, c := range ignoreContexts {
+		ignored[c] = true
+	}
+
+	state := "success"
+	for _, s := range status.Statuses {
+		if ignored[s.GetContext()] {
+			continue
+		}
+		switch s.GetState() {
+		case "failure", "error":
+			return "failure"
+		case "pending":
+			state = "pending"
+		}
+	}
+	return state
+}
+
+// newestSuccess returns when the most recent successful status was reported, or successful check run completed,
+// ignoring the ignored contexts. It returns the zero time if there are no successful statuses or check runs.
+func newestSuccess(status *github.CombinedStatus, runs []checkRun, ignoreContexts []string) time.Time {
+	ignored := map[string]bool{}
+	for _, c := range ignoreContexts {
+		ignored[c] = true
+	}
+	var newest time.Time
+	for _, s := range status.Statuses {
+		if ignored[s.GetContext()] || s.GetState() != "success" {
+			continue
+		}
+		if updated := s.GetUpdatedAt(); updated.After(newest) {
+			newest = updated
+		}
+	}
+	for _, r := range runs {
+		if ignored[r.Name] || r.Status != "completed" || r.Conclusion != "success" {
+			continue
+		}
+		if r.CompletedAt.After(newest) {
+			newest = r.CompletedAt
+		}
+	}
+	return newest
+}
+
+// failingContexts returns which of the given contexts have a "failure" or "error" status, or are the names of
+// check runs that failed, timed out or were cancelled
+func failingContexts(status *github.CombinedStatus, runs []checkRun, contexts []string) []string {
+	wanted := map[string]bool{}
+	for _, c := range contexts {
+		wanted[c] = true
+	}
+	failing := []string{}
+	for _, s := range status.Statuses {
+		if !wanted[s.GetContext()] {
+			continue
+		}
+		if s.GetState() == "failure" || s.GetState() == "error" {
+			failing = append(failing, s.GetContext())
+		}
+	}
+	for _, r := range runs {
+		if !wanted[r.Name] || r.Status != "completed" {
+			continue
+		}
+		switch r.Conclusion {
+		case "failure", "timed_out", "cancelled":
+			failing = append(failing, r.Name)
+		}
+	}
+	return failing
+}
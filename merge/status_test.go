@@ -0,0 +1,60 @@
+package merge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewestSuccess(t *testing.T) {
+	at := func(hour int) *time.Time {
+		t := time.Date(2019, 8, 14, hour, 0, 0, 0, time.UTC)
+		return &t
+	}
+	status := &github.CombinedStatus{Statuses: []github.RepoStatus{
+		{Context: github.String("ci/build"), State: github.String("success"), UpdatedAt: at(9)},
+		{Context: github.String("ci/lint"), State: github.String("success"), UpdatedAt: at(10)},
+		{Context: github.String("ci/deploy"), State: github.String("pending"), UpdatedAt: at(12)},
+		{Context: github.String("ci/flaky"), State: github.String("success"), UpdatedAt: at(11)},
+	}}
+
+	assert.Equal(t, *at(11), newestSuccess(status, nil, nil))
+	assert.Equal(t, *at(10), newestSuccess(status, nil, []string{"ci/flaky"}))
+	assert.True(t, newestSuccess(&github.CombinedStatus{}, nil, nil).IsZero())
+
+	// successful check runs count by when they completed, e.g. in a repo that only uses Github Actions
+	runs := []checkRun{
+		{Name: "build", Status: "completed", Conclusion: "success", CompletedAt: *at(13)},
+		{Name: "lint", Status: "completed", Conclusion: "failure", CompletedAt: *at(14)},
+		{Name: "deploy", Status: "in_progress"},
+	}
+	assert.Equal(t, *at(13), newestSuccess(status, runs, nil))
+	assert.Equal(t, *at(13), newestSuccess(&github.CombinedStatus{}, runs, nil))
+	assert.Equal(t, *at(11), newestSuccess(status, runs, []string{"build"}))
+}
+
+func TestFailingContexts(t *testing.T) {
+	status := &github.CombinedStatus{Statuses: []github.RepoStatus{
+		{Context: github.String("ci/build"), State: github.String("failure")},
+		{Context: github.String("breaking-changes"), State: github.String("error")},
+		{Context: github.String("ci/lint"), State: github.String("success")},
+	}}
+
+	assert.Equal(t, []string{"breaking-changes"}, failingContexts(status, nil, []string{"breaking-changes", "ci/lint"}))
+	assert.Equal(t, []string{}, failingContexts(status, nil, []string{"ci/lint"}))
+	assert.Equal(t, []string{}, failingContexts(status, nil, nil))
+
+	// check runs, e.g. from Github Actions, block by name
+	runs := []checkRun{
+		{Name: "api-diff", Status: "completed", Conclusion: "failure"},
+		{Name: "e2e", Status: "completed", Conclusion: "timed_out"},
+		{Name: "deploy-preview", Status: "completed", Conclusion: "cancelled"},
+		{Name: "docs", Status: "completed", Conclusion: "neutral"},
+		{Name: "slow", Status: "in_progress"},
+	}
+	assert.Equal(t, []string{"breaking-changes", "api-diff", "e2e", "deploy-preview"},
+		failingContexts(status, runs, []string{"breaking-changes", "api-diff", "e2e", "deploy-preview", "docs", "slow"}))
+	assert.Equal(t, []string{}, failingContexts(&github.CombinedStatus{}, runs, []string{"docs", "slow"}))
+}
@@ -0,0 +1,128 @@
+package merge
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a recurring period of time during which merges are allowed, e.g. 09:00-17:00 on weekdays
+type Window struct {
+	// Start and End are offsets from midnight
+	Start time.Duration
+	End   time.Duration
+	// Location is the timezone that Start and End are in
+	Location *time.Location
+	// Weekdays on which the window opens
+	Weekdays map[time.Weekday]bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseWindow parses a merge window
+// - start and end are times of day, e.g. "09:00" and "17:30"
+// - timezone is an IANA timezone name, e.g. "America/Los_Angeles". If empty, local time is used.
+// - days is a comma-separated list of weekdays, e.g. "mon,tue,wed,thu,fri". If empty, all days are allowed.
+func ParseWindow(start, end, timezone, days string) (Window, error) {
+	w := Window{Location: time.Local, Weekdays: map[time.Weekday]bool{}}
+
+	var err error
+	if w.Start, err = parseTimeOfDay(start); err != nil {
+		return Window{}, fmt.Errorf("invalid merge window start: %s", err.Error())
+	}
+	if w.End, err = parseTimeOfDay(end); err != nil {
+		return Window{}, fmt.Errorf("invalid merge window end: %s", err.Error())
+	}
+	if w.Start >= w.End {
+		return Window{}, fmt.Errorf("merge window start (%s) must be before end (%s)", start, end)
+	}
+
+	if timezone != "" {
+		if w.Location, err = time.LoadLocation(timezone); err != nil {
+			return Window{}, fmt.Errorf("invalid merge window timezone: %s", err.Error())
+		}
+	}
+
+	if days == "" {
+		for _, d := range weekdays {
+			w.Weekdays[d] = true
+		}
+		return w, nil
+	}
+	for _, day := range strings.Split(days, ",") {
+		key := strings.ToLower(strings.TrimSpace(day))
+		if len(key) > 3 {
+			key = key[:3]
+		}
+		d, ok := weekdays[key]
+		if !ok {
+			return Window{}, fmt.Errorf("invalid merge window day: %s", day)
+		}
+		w.Weekdays[d] = true
+	}
+	return w, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains returns whether t falls within the window
+func (w Window) Contains(t time.Time) bool {
+	t = t.In(w.Location)
+	if !w.Weekdays[t.Weekday()] {
+		return false
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, w.Location)
+	offset := t.Sub(midnight)
+	return offset >= w.Start && offset < w.End
+}
+
+// NextOpen returns the next time at or after t that the window is open
+func (w Window) NextOpen(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+	t = t.In(w.Location)
+	for i := 0; i <= 7; i++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()+i, 0, 0, 0, 0, w.Location)
+		open := day.Add(w.Start)
+		if w.Weekdays[day.Weekday()] && open.After(t) {
+			return open
+		}
+	}
+	// unreachable, as long as the window opens on at least one day
+	return t
+}
+
+// windowError returns why a merge can't happen at t, if w is set and t is outside it
+func windowError(w *Window, t time.Time) error {
+	if w == nil || w.Contains(t) {
+		return nil
+	}
+	return fmt.Errorf("outside merge window %s, next opens at %s", w, w.NextOpen(t))
+}
+
+func (w Window) String() string {
+	days := []string{}
+	for _, name := range []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"} {
+		if w.Weekdays[weekdays[name]] {
+			days = append(days, name)
+		}
+	}
+	midnight := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	return fmt.Sprintf("%s-%s %s (%s)", midnight.Add(w.Start).Format("15:04"), midnight.Add(w.End).Format("15:04"),
+		w.Location, strings.Join(days, ","))
+}
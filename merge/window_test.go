@@ -0,0 +1,59 @@
+package merge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowContains(t *testing.T) {
+	w, err := ParseWindow("09:00", "17:00", "UTC", "mon,tue,wed,thu,fri")
+	assert.NoError(t, err)
+
+	// Wednesday
+	assert.True(t, w.Contains(time.Date(2019, 8, 14, 9, 0, 0, 0, time.UTC)))
+	assert.True(t, w.Contains(time.Date(2019, 8, 14, 16, 59, 0, 0, time.UTC)))
+	assert.False(t, w.Contains(time.Date(2019, 8, 14, 17, 0, 0, 0, time.UTC)))
+	assert.False(t, w.Contains(time.Date(2019, 8, 14, 8, 59, 0, 0, time.UTC)))
+	// Saturday
+	assert.False(t, w.Contains(time.Date(2019, 8, 17, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestWindowNextOpen(t *testing.T) {
+	w, err := ParseWindow("09:00", "17:00", "UTC", "Monday,Friday")
+	assert.NoError(t, err)
+
+	// Friday evening opens again on Monday morning
+	assert.Equal(t, time.Date(2019, 8, 19, 9, 0, 0, 0, time.UTC),
+		w.NextOpen(time.Date(2019, 8, 16, 18, 0, 0, 0, time.UTC)))
+	// Friday morning opens later that day
+	assert.Equal(t, time.Date(2019, 8, 16, 9, 0, 0, 0, time.UTC),
+		w.NextOpen(time.Date(2019, 8, 16, 7, 0, 0, 0, time.UTC)))
+	// already open
+	now := time.Date(2019, 8, 16, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, now, w.NextOpen(now))
+}
+
+func TestWindowError(t *testing.T) {
+	w, err := ParseWindow("09:00", "17:00", "UTC", "mon,tue,wed,thu,fri")
+	assert.NoError(t, err)
+
+	assert.NoError(t, windowError(nil, time.Date(2019, 8, 17, 12, 0, 0, 0, time.UTC)))
+	assert.NoError(t, windowError(&w, time.Date(2019, 8, 16, 16, 59, 0, 0, time.UTC)))
+	// closed while waiting on the other gates
+	err = windowError(&w, time.Date(2019, 8, 16, 17, 0, 0, 0, time.UTC))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "next opens at 2019-08-19 09:00:00")
+}
+
+func TestParseWindowErrors(t *testing.T) {
+	_, err := ParseWindow("17:00", "09:00", "", "")
+	assert.Error(t, err)
+	_, err = ParseWindow("9am", "17:00", "", "")
+	assert.Error(t, err)
+	_, err = ParseWindow("09:00", "17:00", "Not/AZone", "")
+	assert.Error(t, err)
+	_, err = ParseWindow("09:00", "17:00", "", "mon,funday")
+	assert.Error(t, err)
+}
@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of metric, see https://prometheus.io/docs/instrumenting/exposition_formats/
+const (
+	Counter = "counter"
+	Gauge   = "gauge"
+)
+
+// Metrics recorded during a run
+const (
+	// ReposTotal counts the repos each step has processed, by step and outcome (succeeded, failed or skipped)
+	ReposTotal = "microplane_repos_total"
+	// APICallsTotal counts the Github API calls made, by HTTP status code
+	APICallsTotal = "microplane_api_calls_total"
+	// RateLimitRemaining is the number of Github API calls left in the rate limit, as of the latest call
+	RateLimitRemaining = "microplane_rate_limit_remaining"
+	// StepDurationSeconds is how long the run's step took, by step
+	StepDurationSeconds = "microplane_step_duration_seconds"
+	// LastRunSuccess is 1 if the run succeeded and 0 if it failed, by command
+	LastRunSuccess = "microplane_last_run_success"
+	// LastRunTimestampSeconds is when the run ended, by command
+	LastRunTimestampSeconds = "microplane_last_run_timestamp_seconds"
+)
+
+type metric struct {
+	kind   string
+	help   string
+	values map[string]float64
+}
+
+var registry = struct {
+	sync.Mutex
+	metrics map[string]*metric
+}{metrics: map[string]*metric{
+	ReposTotal:              {kind: Counter, help: "Repos processed by each step, by outcome."},
+	APICallsTotal:           {kind: Counter, help: "Github API calls made, by HTTP status code."},
+	RateLimitRemaining:      {kind: Gauge, help: "Github API calls left in the rate limit."},
+	StepDurationSeconds:     {kind: Gauge, help: "How long the step took."},
+	LastRunSuccess:          {kind: Gauge, help: "Whether the run succeeded."},
+	LastRunTimestampSeconds: {kind: Gauge, help: "When the run ended."},
+}}
+
+// labelString renders label name/value pairs, e.g. ("step", "merge") as `{step="merge"}`
+func labelString(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func update(name string, labels []string, f func(float64) float64) {
+	registry.Lock()
+	defer registry.Unlock()
+	m, ok := registry.metrics[name]
+	if !ok {
+		return
+	}
+	if m.values == nil {
+		m.values = map[string]float64{}
+	}
+	key := labelString(labels)
+	m.values[key] = f(m.values[key])
+}
+
+// Inc adds 1 to a counter. Labels are name/value pairs, e.g. Inc(ReposTotal, "step", "merge", "outcome", "failed").
+func Inc(name string, labels ...string) {
+	update(name, labels, func(v float64) float64 { return v + 1 })
+}
+
+// Set sets a gauge
+func Set(name string, value float64, labels ...string) {
+	update(name, labels, func(float64) float64 { return value })
+}
+
+// Write writes the metrics that have been recorded in Prometheus' text format
+func Write(w io.Writer) error {
+	registry.Lock()
+	defer registry.Unlock()
+	names := []string{}
+	for name, m := range registry.metrics {
+		if len(m.values) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := registry.metrics[name]
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, m.help, name, m.kind); err != nil {
+			return err
+		}
+		keys := []string{}
+		for k := range m.values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", name, k, strconv.FormatFloat(m.values[k], 'g', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Serve exposes the metrics at http://{addr}/metrics for the rest of the run, e.g. ":9090"
+func Serve(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error serving metrics: %s", err.Error())
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Write(w)
+	})
+	go http.Serve(listener, mux)
+	return nil
+}
+
+// Push sends the metrics to a Prometheus Pushgateway, e.g. "http://pushgateway:9091", replacing those
+// previously pushed with the same grouping labels, e.g. ("campaign", "go-upgrade")
+func Push(gateway, job string, grouping ...string) error {
+	u := strings.TrimSuffix(gateway, "/") + "/metrics/job/" + url.PathEscape(job)
+	for i := 0; i+1 < len(grouping); i += 2 {
+		u += "/" + url.PathEscape(grouping[i]) + "/" + url.PathEscape(grouping[i+1])
+	}
+	var body bytes.Buffer
+	if err := Write(&body); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("PUT", u, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error pushing metrics: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error pushing metrics: %s returned %d", gateway, resp.StatusCode)
+	}
+	return nil
+}
+
+// Transport counts each HTTP request in APICallsTotal
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	Inc(APICallsTotal, "code", code)
+	return resp, err
+}
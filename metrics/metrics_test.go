@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func reset() {
+	registry.Lock()
+	defer registry.Unlock()
+	for _, m := range registry.metrics {
+		m.values = nil
+	}
+}
+
+func TestWrite(t *testing.T) {
+	reset()
+	Inc(ReposTotal, "step", "merge", "outcome", "succeeded")
+	Inc(ReposTotal, "step", "merge", "outcome", "succeeded")
+	Inc(ReposTotal, "step", "merge", "outcome", "failed")
+	Set(RateLimitRemaining, 4999)
+	Inc("not_a_metric")
+
+	var b bytes.Buffer
+	assert.NoError(t, Write(&b))
+	assert.Equal(t, `# HELP microplane_rate_limit_remaining Github API calls left in the rate limit.
+# TYPE microplane_rate_limit_remaining gauge
+microplane_rate_limit_remaining 4999
+# HELP microplane_repos_total Repos processed by each step, by outcome.
+# TYPE microplane_repos_total counter
+microplane_repos_total{step="merge",outcome="failed"} 1
+microplane_repos_total{step="merge",outcome="succeeded"} 2
+`, b.String())
+}
+
+func TestPush(t *testing.T) {
+	reset()
+	Set(LastRunSuccess, 1, "command", "merge")
+	var method, path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer server.Close()
+
+	assert.NoError(t, Push(server.URL+"/", "microplane", "campaign", "go-upgrade"))
+	assert.Equal(t, "PUT", method)
+	assert.Equal(t, "/metrics/job/microplane/campaign/go-upgrade", path)
+	assert.Contains(t, body, `microplane_last_run_success{command="merge"} 1`)
+}
@@ -0,0 +1,37 @@
+package plan
+
+import (
+	"path/filepath"
+)
+
+// DefaultCIConfigPaths are globs of the config files of common CI systems, see Input.CIConfigPaths
+var DefaultCIConfigPaths = []string{
+	".github/workflows/*.yml",
+	".github/workflows/*.yaml",
+	".circleci/config.yml",
+	".gitlab-ci.yml",
+	".travis.yml",
+	".drone.yml",
+	".buildkite/pipeline.yml",
+	"azure-pipelines.yml",
+	"Jenkinsfile",
+}
+
+// findCIConfig returns the files in the repo in dir that match any of the globs, relative to dir
+func findCIConfig(dir string, globs []string) ([]string, error) {
+	found := []string{}
+	for _, g := range globs {
+		matches, err := filepath.Glob(filepath.Join(dir, g))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			rel, err := filepath.Rel(dir, m)
+			if err != nil {
+				return nil, err
+			}
+			found = append(found, filepath.ToSlash(rel))
+		}
+	}
+	return found, nil
+}
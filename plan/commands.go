@@ -0,0 +1,28 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (c Command) String() string {
+	return strings.Join(append([]string{c.Path}, c.Args...), " ")
+}
+
+// runCommands runs a pipeline of commands in order, e.g. a codemod, then a formatter, then a lockfile update.
+// It stops at the first failure, unless continueOnError is set. It returns the commands that failed,
+// numbered from 1, and an error if the pipeline stopped.
+func runCommands(run func(Command) error, commands []Command, continueOnError bool) ([]string, error) {
+	failed := []string{}
+	for i, cmd := range commands {
+		err := run(cmd)
+		if err == nil {
+			continue
+		}
+		failed = append(failed, fmt.Sprintf("%d: %s", i+1, cmd))
+		if !continueOnError {
+			return failed, fmt.Errorf("command %d of %d (%s) failed: %s", i+1, len(commands), cmd, err.Error())
+		}
+	}
+	return failed, nil
+}
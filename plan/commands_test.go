@@ -0,0 +1,33 @@
+package plan
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCommands(t *testing.T) {
+	ran := []string{}
+	run := func(cmd Command) error {
+		ran = append(ran, cmd.Path)
+		if cmd.Path == "false" {
+			return fmt.Errorf("exit status 1")
+		}
+		return nil
+	}
+	commands := []Command{{Path: "true"}, {Path: "false"}, {Path: "gofmt", Args: []string{"-w", "."}}}
+
+	failed, err := runCommands(run, commands, false)
+	assert.Equal(t, []string{"true", "false"}, ran)
+	assert.Equal(t, []string{"2: false"}, failed)
+	if assert.Error(t, err) {
+		assert.Equal(t, "command 2 of 3 (false) failed: exit status 1", err.Error())
+	}
+
+	ran = []string{}
+	failed, err = runCommands(run, commands, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"true", "false", "gofmt"}, ran)
+	assert.Equal(t, []string{"2: false"}, failed)
+}
@@ -0,0 +1,35 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffStat summarizes a git diff, similar to `git diff --stat`
+type DiffStat struct {
+	FilesChanged int
+	Insertions   int
+	Deletions    int
+}
+
+// ParseDiffStat counts the files, insertions, and deletions in the output of `git diff`
+func ParseDiffStat(gitDiff string) DiffStat {
+	var stat DiffStat
+	for _, line := range strings.Split(gitDiff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			stat.FilesChanged++
+		case strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "):
+			// file headers, not content
+		case strings.HasPrefix(line, "+"):
+			stat.Insertions++
+		case strings.HasPrefix(line, "-"):
+			stat.Deletions++
+		}
+	}
+	return stat
+}
+
+func (s DiffStat) String() string {
+	return fmt.Sprintf("%d file(s) changed, %d insertion(s)(+), %d deletion(s)(-)", s.FilesChanged, s.Insertions, s.Deletions)
+}
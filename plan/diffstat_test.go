@@ -0,0 +1,35 @@
+package plan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDiff = `diff --git a/README.md b/README.md
+index 3b18e51..a042389 100644
+--- a/README.md
++++ b/README.md
+@@ -1,3 +1,3 @@
+ # repo
+-old line
++new line
++another new line
+diff --git a/main.go b/main.go
+index 1234567..89abcde 100644
+--- a/main.go
++++ b/main.go
+@@ -1,2 +1,1 @@
+ package main
+-// removed
+`
+
+func TestParseDiffStat(t *testing.T) {
+	stat := ParseDiffStat(testDiff)
+	assert.Equal(t, DiffStat{FilesChanged: 2, Insertions: 2, Deletions: 2}, stat)
+	assert.Equal(t, "2 file(s) changed, 2 insertion(s)(+), 2 deletion(s)(-)", stat.String())
+}
+
+func TestParseDiffStatEmpty(t *testing.T) {
+	assert.Equal(t, DiffStat{}, ParseDiffStat(""))
+}
@@ -0,0 +1,40 @@
+package plan
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+var envKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseEnvFile reads KEY=VALUE pairs for the change command's environment, one per line.
+// Blank lines and lines starting with # are ignored. Keys can't start with MICROPLANE_,
+// since those are set by microplane.
+func ParseEnvFile(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseEnv(string(b))
+}
+
+func parseEnv(s string) ([]string, error) {
+	env := []string{}
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || !envKeyRegexp.MatchString(parts[0]) {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE, got %q", i+1, line)
+		}
+		if strings.HasPrefix(parts[0], "MICROPLANE_") {
+			return nil, fmt.Errorf("line %d: %s is reserved for microplane", i+1, parts[0])
+		}
+		env = append(env, line)
+	}
+	return env, nil
+}
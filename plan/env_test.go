@@ -0,0 +1,20 @@
+package plan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEnv(t *testing.T) {
+	env, err := parseEnv("# campaign settings\nTARGET_VERSION=1.12\n\nFLAG_NAME=use-new-client\nEMPTY=\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"TARGET_VERSION=1.12", "FLAG_NAME=use-new-client", "EMPTY="}, env)
+
+	_, err = parseEnv("TARGET_VERSION")
+	assert.Error(t, err)
+	_, err = parseEnv("1ST=a")
+	assert.Error(t, err)
+	_, err = parseEnv("MICROPLANE_REPO=other")
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// applyIsolated runs the change on a scratch copy of the cloned repo, then applies only its diff to the repo in dir,
+// see Input.Isolated. Whatever else the change leaves behind, e.g. ignored build artifacts, commits, or changes
+// to the git config, is thrown away with the scratch copy.
+func applyIsolated(ctx context.Context, input Input, dir string) ([]string, error) {
+	scratch, err := ioutil.TempDir("", "microplane-isolated-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(scratch)
+	// lay out the scratch copy like the planned one, so that e.g. a Go repo's import path matches its directory
+	scratchRepo := path.Join(scratch, "repo")
+	if input.LayoutPath != "" {
+		scratchRepo = path.Join(scratch, input.LayoutPath)
+	}
+	if err := os.MkdirAll(path.Dir(scratchRepo), 0755); err != nil {
+		return nil, err
+	}
+	if err := copyRepo(ctx, input.RepoDir, scratchRepo); err != nil {
+		return nil, err
+	}
+	base, err := gitOutput(ctx, scratchRepo, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	failed, err := applyChange(ctx, input, scratchRepo)
+	if err != nil {
+		return failed, err
+	}
+
+	// stage everything, so that new files are included, and diff against where the copy started,
+	// in case the change made commits of its own
+	if err := runIn(ctx, scratchRepo, Command{Path: "git", Args: []string{"add", "-A"}}); err != nil {
+		return failed, err
+	}
+	diff, err := gitOutput(ctx, scratchRepo, "diff", "--cached", "--binary", strings.TrimSpace(base))
+	if err != nil {
+		return failed, err
+	}
+	if diff == "" {
+		return failed, nil
+	}
+	patchPath := path.Join(scratch, "change.patch")
+	if err := ioutil.WriteFile(patchPath, []byte(diff), 0644); err != nil {
+		return failed, err
+	}
+	if err := runIn(ctx, dir, Command{Path: "git", Args: []string{"apply", patchPath}}); err != nil {
+		return failed, errors.New("could not import the change from its isolated copy: " + err.Error())
+	}
+	return failed, nil
+}
+
+// gitOutput runs a git command in dir and returns its stdout. Its stderr, e.g. warnings, is only kept for the error.
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return string(output), nil
+}
@@ -0,0 +1,86 @@
+package plan
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyIsolated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-isolated")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, planned := filepath.Join(dir, "cloned"), filepath.Join(dir, "planned")
+	assert.NoError(t, exec.Command("git", "init", "-q", repo).Run())
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo, ".gitignore"), []byte("build/\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo, "README.md"), []byte("before\n"), 0644))
+	for _, args := range [][]string{{"add", "-A"}, {"-c", "user.name=mp", "-c", "user.email=mp@example.com", "commit", "-q", "-m", "init"}} {
+		git := exec.Command("git", args...)
+		git.Dir = repo
+		assert.NoError(t, git.Run())
+	}
+	ctx := context.Background()
+	assert.NoError(t, copyRepo(ctx, repo, planned))
+
+	change := "echo after > README.md && echo new > NEW.md && mkdir build && touch build/artifact"
+	_, err = applyIsolated(ctx, Input{RepoDir: repo, Command: Command{Path: "sh", Args: []string{"-c", change}}}, planned)
+	assert.NoError(t, err)
+
+	b, err := ioutil.ReadFile(filepath.Join(planned, "README.md"))
+	assert.NoError(t, err)
+	assert.Equal(t, "after\n", string(b))
+	_, err = os.Stat(filepath.Join(planned, "NEW.md"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(planned, "build"))
+	assert.True(t, os.IsNotExist(err))
+	// the clone is untouched
+	b, err = ioutil.ReadFile(filepath.Join(repo, "README.md"))
+	assert.NoError(t, err)
+	assert.Equal(t, "before\n", string(b))
+}
+
+func TestApplyIsolatedLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-isolated")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo, planned, pwd := filepath.Join(dir, "cloned"), filepath.Join(dir, "planned"), filepath.Join(dir, "pwd")
+	assert.NoError(t, exec.Command("git", "init", "-q", repo).Run())
+	git := exec.Command("git", "-c", "user.name=mp", "-c", "user.email=mp@example.com", "commit", "-q", "--allow-empty", "-m", "init")
+	git.Dir = repo
+	assert.NoError(t, git.Run())
+	ctx := context.Background()
+	assert.NoError(t, copyRepo(ctx, repo, planned))
+
+	input := Input{
+		RepoDir:    repo,
+		LayoutPath: filepath.Join("github.com", "Clever", "microplane"),
+		Command:    Command{Path: "sh", Args: []string{"-c", "pwd > " + pwd}},
+	}
+	_, err = applyIsolated(ctx, input, planned)
+	assert.NoError(t, err)
+	b, err := ioutil.ReadFile(pwd)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(string(b)), "/github.com/Clever/microplane"), string(b))
+}
+
+func TestGitOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-isolated")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	assert.NoError(t, exec.Command("git", "init", "-q", dir).Run())
+
+	output, err := gitOutput(ctx, dir, "rev-parse", "--git-dir")
+	assert.NoError(t, err)
+	assert.Equal(t, ".git\n", output)
+
+	_, err = gitOutput(ctx, dir, "rev-parse", "HEAD^{commit}")
+	assert.Error(t, err)
+	assert.NotEqual(t, "", err.Error())
+}
@@ -0,0 +1,57 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// metadataFileName is where Metadata is written, within the planned repo.
+// Its path is given to the change command by the MICROPLANE_METADATA env var.
+const metadataFileName = ".microplane.json"
+
+// Metadata is what microplane knows about a repo, written as JSON for the change command to read, e.g.
+//
+//	{
+//	  "name": "microplane",
+//	  "owner": "Clever",
+//	  "clone_url": "git@github.com:Clever/microplane",
+//	  "provider": "github",
+//	  "topics": ["go", "cli"],
+//	  "ref": "v1.2.0",
+//	  "base_branch": "master",
+//	  "branch_name": "microplaning",
+//	  "commit_message": "microplane fun"
+//	}
+//
+// topics is only set if init filtered repos by topic. ref is only set if clone checked out a ref.
+type Metadata struct {
+	Name          string   `json:"name"`
+	Owner         string   `json:"owner"`
+	CloneURL      string   `json:"clone_url"`
+	Provider      string   `json:"provider"`
+	Topics        []string `json:"topics"`
+	Ref           string   `json:"ref,omitempty"`
+	BaseBranch    string   `json:"base_branch"`
+	BranchName    string   `json:"branch_name"`
+	CommitMessage string   `json:"commit_message"`
+}
+
+// writeMetadata writes the metadata file into planDir, returning its path.
+// It refuses to overwrite a file that's part of the repo.
+func writeMetadata(planDir string, metadata Metadata) (string, error) {
+	metadataPath := path.Join(planDir, metadataFileName)
+	if _, err := os.Stat(metadataPath); err == nil {
+		return "", fmt.Errorf("can't write repo metadata, %s already exists in the repo", metadataFileName)
+	}
+	if metadata.Topics == nil {
+		metadata.Topics = []string{}
+	}
+	b, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return metadataPath, ioutil.WriteFile(metadataPath, b, 0644)
+}
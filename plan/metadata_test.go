@@ -0,0 +1,68 @@
+package plan
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-metadata")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	metadataPath, err := writeMetadata(dir, Metadata{Name: "microplane", Owner: "Clever", BaseBranch: "master"})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, metadataFileName), metadataPath)
+	b, err := ioutil.ReadFile(metadataPath)
+	assert.NoError(t, err)
+	var written map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &written))
+	assert.Equal(t, "microplane", written["name"])
+	assert.Equal(t, "master", written["base_branch"])
+	assert.Equal(t, []interface{}{}, written["topics"])
+	_, hasRef := written["ref"]
+	assert.False(t, hasRef)
+
+	// the repo's own file of the same name isn't overwritten
+	_, err = writeMetadata(dir, Metadata{Name: "other"})
+	assert.Error(t, err)
+}
+
+func TestApplyChangeMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-metadata")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	planned, read := filepath.Join(dir, "planned"), filepath.Join(dir, "read.json")
+	assert.NoError(t, os.Mkdir(planned, 0755))
+
+	input := Input{
+		RepoName:      "microplane",
+		BranchName:    "microplaning",
+		CommitMessage: "microplane fun",
+		Metadata:      Metadata{Name: "microplane", Owner: "Clever", Topics: []string{"go"}},
+		Command:       Command{Path: "sh", Args: []string{"-c", `cp "$MICROPLANE_METADATA" ` + read}},
+	}
+	_, err = applyChange(context.Background(), input, planned)
+	assert.NoError(t, err)
+
+	b, err := ioutil.ReadFile(read)
+	assert.NoError(t, err)
+	var metadata Metadata
+	assert.NoError(t, json.Unmarshal(b, &metadata))
+	assert.Equal(t, Metadata{
+		Name:          "microplane",
+		Owner:         "Clever",
+		Topics:        []string{"go"},
+		BranchName:    "microplaning",
+		CommitMessage: "microplane fun",
+	}, metadata)
+	// it's removed, so it isn't in the diff
+	_, err = os.Stat(filepath.Join(planned, metadataFileName))
+	assert.True(t, os.IsNotExist(err))
+}
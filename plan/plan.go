@@ -26,51 +26,111 @@ type Input struct {
 	WorkDir string
 	// Command to run
 	Command Command
+	// Commands, if set, are run in order instead of Command, stopping at the first that fails
+	// unless ContinueOnError is set
+	Commands        []Command
+	ContinueOnError bool
+	// PatchPath, if set, is a patch file to apply with `git apply` instead of running Command
+	PatchPath string
 	// CommitMessage to send to `git commit -m`
 	CommitMessage string
 	// BranchName where the commit will be made
 	BranchName string
+	// CopyPaths are local files or directories to copy into the repo before running Command.
+	// They are copied into the directory given by the MICROPLANE_COPY_DIR env var, and removed before committing.
+	CopyPaths []string
+	// Metadata about the repo, written to a JSON file for Command to read. It's removed before committing.
+	Metadata Metadata
+	// Env are extra KEY=VALUE environment variables for Command, see ParseEnvFile
+	Env []string
+	// When are predicates the cloned repo must all match for the change to be made, otherwise it's skipped
+	When []Predicate
+	// Subdir, if set, is the directory relative to the repo root that Command is run from, e.g. a package in a monorepo.
+	// The diff is still of the whole repo. Repos without it are skipped.
+	Subdir string
+	// PlanDir, if set, is where the copy of the repo is made instead of {WorkDir}/planned
+	PlanDir string
+	// LayoutPath, if set, is where the repo is laid out under PlanDir's parent, e.g. "Clever/microplane",
+	// so that an isolated change's scratch copy is laid out the same way
+	LayoutPath string
+	// CIConfigPaths are globs of CI config files, e.g. DefaultCIConfigPaths. If set, the ones the repo has
+	// are recorded in Output.CIConfig, and with RequireCIConfig, a repo without any is skipped.
+	CIConfigPaths   []string
+	RequireCIConfig bool
+	// Isolated runs Command on a scratch copy of the cloned repo, and only applies its diff to the planned repo,
+	// so that anything else it leaves behind, e.g. ignored build artifacts, doesn't end up in the planned repo
+	Isolated bool
 }
 
+// copyDirName is where CopyPaths are copied to, within the planned repo
+const copyDirName = ".microplane-copy"
+
 // Output for Plan
 type Output struct {
 	Success bool
 
 	PlanDir       string
 	GitDiff       string
+	DiffStat      DiffStat
 	CommitMessage string
 	BranchName    string
+	// FailedCommands are the Commands that failed, e.g. "2: sh -c gofmt -w ."
+	FailedCommands []string `json:",omitempty"`
+	// SkippedBy is the predicate in Input.When that the repo didn't match, if it was skipped
+	SkippedBy string `json:",omitempty"`
+	// CIConfig are the repo's CI config files matching Input.CIConfigPaths
+	CIConfig []string `json:",omitempty"`
+	// NoCIConfig is true if Input.CIConfigPaths was set but the repo has none of them,
+	// so CI won't validate the change
+	NoCIConfig bool `json:",omitempty"`
 }
 
 // Plan creates a copy of the cloned repo and executes a command on it.
 // This allows the user to preview a change to the repo.
 func Plan(ctx context.Context, input Input) (Output, error) {
+	ciConfig, err := findCIConfig(input.RepoDir, input.CIConfigPaths)
+	if err != nil {
+		return Output{Success: false}, err
+	}
+	noCIConfig := len(input.CIConfigPaths) > 0 && len(ciConfig) == 0
+	if skippedBy, err := checkWhen(ctx, input); err != nil || skippedBy != "" {
+		return Output{Success: false, SkippedBy: skippedBy, CIConfig: ciConfig, NoCIConfig: noCIConfig}, err
+	}
+
 	// create a copy of the cloned repo and run all commands there
 	// wipe out the directory in case Plan has been run previously
 	// but the change command has been edited and you want to run again
 	planDir := path.Join(input.WorkDir, "planned")
+	if input.PlanDir != "" {
+		planDir = input.PlanDir
+	}
 	if err := os.RemoveAll(planDir); err != nil {
 		return Output{Success: false}, fmt.Errorf("could not clear directory %s", planDir)
 	}
-	cmd := exec.CommandContext(ctx, "cp", "-a", "./.", planDir) // "./." copies all the contents of the current directory into the target directory
-	cmd.Dir = input.RepoDir
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return Output{Success: false}, errors.New(string(output))
+	if err := os.MkdirAll(path.Dir(planDir), 0755); err != nil {
+		return Output{Success: false}, err
+	}
+	if err := copyRepo(ctx, input.RepoDir, planDir); err != nil {
+		return Output{Success: false}, err
+	}
+	var failed []string
+	if input.Isolated {
+		failed, err = applyIsolated(ctx, input, planDir)
+	} else {
+		failed, err = applyChange(ctx, input, planDir)
+	}
+	if err != nil {
+		return Output{Success: false, FailedCommands: failed}, err
 	}
 
-	// run the change command, git add, and git commit
+	// git add, and git commit
 	for _, cmd := range []Command{
-		input.Command,
 		Command{Path: "git", Args: []string{"checkout", "-b", input.BranchName}},
 		Command{Path: "git", Args: []string{"add", "-A"}},
 		Command{Path: "git", Args: []string{"commit", "-m", input.CommitMessage}},
 	} {
-		execCmd := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
-		execCmd.Dir = planDir
-		// Set MICROPLANE_<X> convenience env vars, for use in user's script
-		execCmd.Env = append(os.Environ(), fmt.Sprintf("MICROPLANE_REPO=%s", input.RepoName))
-		if output, err := execCmd.CombinedOutput(); err != nil {
-			return Output{Success: false}, errors.New(string(output))
+		if err := runIn(ctx, planDir, cmd); err != nil {
+			return Output{Success: false}, err
 		}
 	}
 
@@ -85,10 +145,118 @@ func Plan(ctx context.Context, input Input) (Output, error) {
 	gitDiff = string(output)
 
 	return Output{
-		Success:       true,
-		PlanDir:       planDir,
-		GitDiff:       gitDiff,
-		BranchName:    input.BranchName,
-		CommitMessage: input.CommitMessage,
+		Success:        true,
+		PlanDir:        planDir,
+		GitDiff:        gitDiff,
+		DiffStat:       ParseDiffStat(gitDiff),
+		BranchName:     input.BranchName,
+		CommitMessage:  input.CommitMessage,
+		FailedCommands: failed,
+		CIConfig:       ciConfig,
+		NoCIConfig:     noCIConfig,
 	}, nil
 }
+
+// checkWhen evaluates Input.When against the cloned repo, returning the first predicate it doesn't match, if any.
+// A repo without Input.Subdir, or without CI config when it's required, doesn't match either.
+func checkWhen(ctx context.Context, input Input) (string, error) {
+	if input.Subdir != "" {
+		if info, err := os.Stat(path.Join(input.RepoDir, input.Subdir)); err != nil || !info.IsDir() {
+			return fmt.Sprintf("--workdir '%s'", input.Subdir), nil
+		}
+	}
+	if input.RequireCIConfig {
+		found, err := findCIConfig(input.RepoDir, input.CIConfigPaths)
+		if err != nil {
+			return "", err
+		}
+		if len(found) == 0 {
+			return "--require-ci-config", nil
+		}
+	}
+	env := append(append(os.Environ(), input.Env...), fmt.Sprintf("MICROPLANE_REPO=%s", input.RepoName))
+	unmatched, err := firstUnmatched(ctx, input.When, input.RepoDir, env)
+	if err != nil || unmatched == nil {
+		return "", err
+	}
+	return unmatched.String(), nil
+}
+
+// copyRepo copies the cloned repo, so that the change is made in a separate working tree
+func copyRepo(ctx context.Context, repoDir, dir string) error {
+	cmd := exec.CommandContext(ctx, "cp", "-a", "./.", dir) // "./." copies all the contents of the current directory into the target directory
+	cmd.Dir = repoDir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return errors.New(string(output))
+	}
+	return nil
+}
+
+// applyChange runs the change command(s) in dir, or applies the patch.
+// It returns the commands that failed, see runCommands.
+func applyChange(ctx context.Context, input Input, dir string) ([]string, error) {
+	// copy any helper files the change command needs
+	copyDir := path.Join(dir, copyDirName)
+	if len(input.CopyPaths) > 0 {
+		if err := os.MkdirAll(copyDir, 0755); err != nil {
+			return nil, err
+		}
+		for _, p := range input.CopyPaths {
+			cmd := exec.CommandContext(ctx, "cp", "-a", p, copyDir)
+			if output, err := cmd.CombinedOutput(); err != nil {
+				return nil, fmt.Errorf("could not copy %s: %s", p, string(output))
+			}
+		}
+	}
+
+	// describe the repo to the change command
+	metadata := input.Metadata
+	metadata.BranchName = input.BranchName
+	metadata.CommitMessage = input.CommitMessage
+	metadataPath, err := writeMetadata(dir, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	// copy Env, since it's shared by every repo's plan
+	env := append(append([]string{}, input.Env...),
+		fmt.Sprintf("MICROPLANE_REPO=%s", input.RepoName),
+		fmt.Sprintf("MICROPLANE_COPY_DIR=%s", copyDir),
+		fmt.Sprintf("MICROPLANE_METADATA=%s", metadataPath),
+	)
+	run := func(cmd Command) error {
+		return runIn(ctx, path.Join(dir, input.Subdir), cmd, env...)
+	}
+
+	// run the change command(s), or apply the patch
+	var failed []string
+	if input.PatchPath != "" {
+		// a patch's paths are relative to the repo root
+		err = runIn(ctx, dir, Command{Path: "git", Args: []string{"apply", input.PatchPath}}, env...)
+		if err != nil {
+			err = fmt.Errorf("patch does not apply cleanly, needs manual attention: %s", err.Error())
+		}
+	} else if len(input.Commands) > 0 {
+		failed, err = runCommands(run, input.Commands, input.ContinueOnError)
+	} else {
+		err = run(input.Command)
+	}
+	// remove copied files and metadata, so they don't end up in the diff
+	for _, p := range []string{copyDir, metadataPath} {
+		if removeErr := os.RemoveAll(p); removeErr != nil && err == nil {
+			err = removeErr
+		}
+	}
+	return failed, err
+}
+
+// runIn runs a command in dir, with extra env vars
+func runIn(ctx context.Context, dir string, cmd Command, env ...string) error {
+	execCmd := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
+	execCmd.Dir = dir
+	execCmd.Env = append(os.Environ(), env...)
+	if output, err := execCmd.CombinedOutput(); err != nil {
+		return errors.New(string(output))
+	}
+	return nil
+}
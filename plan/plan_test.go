@@ -0,0 +1,43 @@
+package plan
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyChangePatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-patch")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	planned, patch := filepath.Join(dir, "planned"), filepath.Join(dir, "change.patch")
+	assert.NoError(t, exec.Command("git", "init", "-q", planned).Run())
+	assert.NoError(t, os.MkdirAll(filepath.Join(planned, "pkg"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(planned, "go.mod"), []byte("go 1.11\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(patch, []byte(`diff --git a/go.mod b/go.mod
+--- a/go.mod
++++ b/go.mod
+@@ -1 +1 @@
+-go 1.11
++go 1.12
+`), 0644))
+
+	// the patch's paths are relative to the repo root, even with a subdir
+	_, err = applyChange(context.Background(), Input{PatchPath: patch, Subdir: "pkg"}, planned)
+	assert.NoError(t, err)
+	b, err := ioutil.ReadFile(filepath.Join(planned, "go.mod"))
+	assert.NoError(t, err)
+	assert.Equal(t, "go 1.12\n", string(b))
+
+	// it no longer applies
+	_, err = applyChange(context.Background(), Input{PatchPath: patch}, planned)
+	if assert.Error(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "patch does not apply cleanly"), err.Error())
+	}
+}
@@ -0,0 +1,41 @@
+package plan
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// Preview runs the change on a throwaway copy of the cloned repo, and returns the diffstat of the change it would make.
+// Nothing is left behind, so a later Plan starts clean.
+func Preview(ctx context.Context, input Input) (DiffStat, error) {
+	if skippedBy, err := checkWhen(ctx, input); err != nil || skippedBy != "" {
+		return DiffStat{}, err
+	}
+	previewDir, err := ioutil.TempDir("", "microplane-preview-")
+	if err != nil {
+		return DiffStat{}, err
+	}
+	defer os.RemoveAll(previewDir)
+
+	if err := copyRepo(ctx, input.RepoDir, previewDir); err != nil {
+		return DiffStat{}, err
+	}
+	if _, err := applyChange(ctx, input, previewDir); err != nil {
+		return DiffStat{}, err
+	}
+
+	// stage everything, so that new files are included in the diff
+	if err := runIn(ctx, previewDir, Command{Path: "git", Args: []string{"add", "-A"}}); err != nil {
+		return DiffStat{}, err
+	}
+	gitDiff := exec.CommandContext(ctx, "git", "diff", "--cached", "HEAD")
+	gitDiff.Dir = previewDir
+	output, err := gitDiff.CombinedOutput()
+	if err != nil {
+		return DiffStat{}, errors.New(string(output))
+	}
+	return ParseDiffStat(string(output)), nil
+}
@@ -0,0 +1,41 @@
+package plan
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreview(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-preview")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	repo := filepath.Join(dir, "cloned")
+	assert.NoError(t, exec.Command("git", "init", "-q", repo).Run())
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo, "README.md"), []byte("before\n"), 0644))
+	for _, args := range [][]string{{"add", "-A"}, {"-c", "user.name=mp", "-c", "user.email=mp@example.com", "commit", "-q", "-m", "init"}} {
+		git := exec.Command("git", args...)
+		git.Dir = repo
+		assert.NoError(t, git.Run())
+	}
+
+	change := "echo after > README.md && printf 'one\\ntwo\\n' > NEW.md"
+	stat, err := Preview(context.Background(), Input{RepoDir: repo, Command: Command{Path: "sh", Args: []string{"-c", change}}})
+	assert.NoError(t, err)
+	assert.Equal(t, DiffStat{FilesChanged: 2, Insertions: 3, Deletions: 1}, stat)
+
+	// the clone is untouched
+	b, err := ioutil.ReadFile(filepath.Join(repo, "README.md"))
+	assert.NoError(t, err)
+	assert.Equal(t, "before\n", string(b))
+	_, err = os.Stat(filepath.Join(repo, "NEW.md"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = Preview(context.Background(), Input{RepoDir: repo, Command: Command{Path: "false"}})
+	assert.Error(t, err)
+}
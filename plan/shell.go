@@ -0,0 +1,33 @@
+package plan
+
+import (
+	"runtime"
+	"strings"
+)
+
+// ShellCommand builds the command that runs a change script with a shell, e.g. for bash features like pipefail.
+// The args are joined into one script. shell is one of:
+// - "bash", "sh" or any other executable that takes a script with -c
+// - "pwsh" or "powershell", which take a script with -Command
+// - "cmd", which takes a script with /C
+// - "auto", which is sh, or powershell on Windows
+func ShellCommand(shell string, args []string) Command {
+	if shell == "auto" {
+		shell = "sh"
+		if runtime.GOOS == "windows" {
+			shell = "powershell"
+		}
+	}
+	script := strings.Join(args, " ")
+	// the shell's name, without its directory or extension, on any OS, e.g. "cmd" for C:\Windows\System32\cmd.exe
+	name := strings.ToLower(shell[strings.LastIndexAny(shell, `/\`)+1:])
+	name = strings.TrimSuffix(name, ".exe")
+	switch name {
+	case "pwsh", "powershell":
+		return Command{Path: shell, Args: []string{"-NoProfile", "-NonInteractive", "-Command", script}}
+	case "cmd":
+		return Command{Path: shell, Args: []string{"/C", script}}
+	default:
+		return Command{Path: shell, Args: []string{"-c", script}}
+	}
+}
@@ -0,0 +1,18 @@
+package plan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellCommand(t *testing.T) {
+	assert.Equal(t, Command{Path: "bash", Args: []string{"-c", "set -o pipefail; ./fix.sh | tee log"}},
+		ShellCommand("bash", []string{"set -o pipefail;", "./fix.sh | tee log"}))
+	assert.Equal(t, Command{Path: "/usr/local/bin/zsh", Args: []string{"-c", "./fix.sh"}},
+		ShellCommand("/usr/local/bin/zsh", []string{"./fix.sh"}))
+	assert.Equal(t, Command{Path: "pwsh", Args: []string{"-NoProfile", "-NonInteractive", "-Command", "./fix.ps1"}},
+		ShellCommand("pwsh", []string{"./fix.ps1"}))
+	assert.Equal(t, Command{Path: `C:\Windows\System32\cmd.exe`, Args: []string{"/C", "fix.bat"}},
+		ShellCommand(`C:\Windows\System32\cmd.exe`, []string{"fix.bat"}))
+}
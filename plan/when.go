@@ -0,0 +1,73 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+)
+
+// Predicate decides whether a repo should be changed, before any work is done on it.
+// Exactly one of its fields is set.
+type Predicate struct {
+	// Command matches if it exits zero when run in the repo
+	Command *Command `json:",omitempty"`
+	// FileExists matches if the repo has a file matching this glob, e.g. "go.mod" or "services/*/Dockerfile"
+	FileExists string `json:",omitempty"`
+	// Grep matches if any tracked file in the repo matches this extended regexp, e.g. "github.com/pkg/errors"
+	Grep string `json:",omitempty"`
+}
+
+func (p Predicate) String() string {
+	switch {
+	case p.Command != nil:
+		return fmt.Sprintf("--when '%s'", p.Command)
+	case p.FileExists != "":
+		return fmt.Sprintf("--when-file-exists '%s'", p.FileExists)
+	default:
+		return fmt.Sprintf("--when-grep '%s'", p.Grep)
+	}
+}
+
+// matches evaluates the predicate against the repo in dir. An error means it couldn't be evaluated,
+// e.g. the command doesn't exist, rather than that it didn't match.
+func (p Predicate) matches(ctx context.Context, dir string, env []string) (bool, error) {
+	var cmd *exec.Cmd
+	switch {
+	case p.Command != nil:
+		cmd = exec.CommandContext(ctx, p.Command.Path, p.Command.Args...)
+	case p.FileExists != "":
+		found, err := filepath.Glob(filepath.Join(dir, p.FileExists))
+		return len(found) > 0, err
+	default:
+		cmd = exec.CommandContext(ctx, "git", "grep", "-q", "-E", "-e", p.Grep)
+	}
+	cmd.Dir = dir
+	cmd.Env = env
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return true, nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		// git grep exits 1 for no match, but higher for errors like a bad regexp
+		if p.Command == nil && exitErr.ExitCode() != 1 {
+			return false, fmt.Errorf("%s failed: %s", p, string(output))
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("%s failed: %s", p, err.Error())
+}
+
+// firstUnmatched returns the first predicate that doesn't match the repo in dir, or nil if they all do
+func firstUnmatched(ctx context.Context, predicates []Predicate, dir string, env []string) (*Predicate, error) {
+	for i := range predicates {
+		matched, err := predicates[i].matches(ctx, dir, env)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			return &predicates[i], nil
+		}
+	}
+	return nil, nil
+}
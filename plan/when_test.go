@@ -0,0 +1,89 @@
+package plan
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirstUnmatched(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-when")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, exec.Command("git", "init", "-q", dir).Run())
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("require github.com/pkg/errors v0.8.1\n"), 0644))
+	add := exec.Command("git", "add", "go.mod")
+	add.Dir = dir
+	assert.NoError(t, add.Run())
+
+	ctx := context.Background()
+	matching := []Predicate{
+		{FileExists: "go.mod"},
+		{Grep: "pkg/errors"},
+		{Command: &Command{Path: "true"}},
+	}
+	unmatched, err := firstUnmatched(ctx, matching, dir, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, unmatched)
+
+	unmatched, err = firstUnmatched(ctx, append(matching, Predicate{Grep: "golang.org/x/xerrors"}), dir, nil)
+	assert.NoError(t, err)
+	if assert.NotNil(t, unmatched) {
+		assert.Equal(t, "--when-grep 'golang.org/x/xerrors'", unmatched.String())
+	}
+
+	unmatched, err = firstUnmatched(ctx, []Predicate{{FileExists: "package.json"}, {Command: &Command{Path: "false"}}}, dir, nil)
+	assert.NoError(t, err)
+	if assert.NotNil(t, unmatched) {
+		assert.Equal(t, "--when-file-exists 'package.json'", unmatched.String())
+	}
+
+	_, err = firstUnmatched(ctx, []Predicate{{Grep: "("}}, dir, nil)
+	assert.Error(t, err)
+}
+
+func TestCheckWhenSubdir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-when")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "packages", "api"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "packages", "README.md"), []byte("packages\n"), 0644))
+
+	ctx := context.Background()
+	skippedBy, err := checkWhen(ctx, Input{RepoDir: dir, Subdir: "packages/api"})
+	assert.NoError(t, err)
+	assert.Equal(t, "", skippedBy)
+
+	for _, subdir := range []string{"packages/web", "packages/README.md"} {
+		skippedBy, err = checkWhen(ctx, Input{RepoDir: dir, Subdir: subdir})
+		assert.NoError(t, err)
+		assert.Equal(t, "--workdir '"+subdir+"'", skippedBy)
+	}
+}
+
+func TestCheckWhenCIConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp-when")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	input := Input{RepoDir: dir, CIConfigPaths: DefaultCIConfigPaths, RequireCIConfig: true}
+	skippedBy, err := checkWhen(ctx, input)
+	assert.NoError(t, err)
+	assert.Equal(t, "--require-ci-config", skippedBy)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, ".github", "workflows"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".github", "workflows", "test.yml"), []byte("on: push\n"), 0644))
+	skippedBy, err = checkWhen(ctx, input)
+	assert.NoError(t, err)
+	assert.Equal(t, "", skippedBy)
+
+	found, err := findCIConfig(dir, DefaultCIConfigPaths)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".github/workflows/test.yml"}, found)
+}
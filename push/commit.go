@@ -0,0 +1,29 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// RewordCommit replaces the message of the planned commit in planDir.
+// The commit is only amended if its message differs, so re-running push doesn't create a new commit.
+func RewordCommit(ctx context.Context, planDir, message string) error {
+	gitLog := exec.CommandContext(ctx, "git", "log", "-1", "--pretty=format:%B")
+	gitLog.Dir = planDir
+	current, err := gitLog.CombinedOutput()
+	if err != nil {
+		return errors.New(string(current))
+	}
+	if strings.TrimSpace(string(current)) == strings.TrimSpace(message) {
+		return nil
+	}
+
+	gitCommit := exec.CommandContext(ctx, "git", "commit", "--amend", "--allow-empty", "-m", message)
+	gitCommit.Dir = planDir
+	if output, err := gitCommit.CombinedOutput(); err != nil {
+		return errors.New(string(output))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Clever/microplane/ghclient"
+	"github.com/google/go-github/github"
+)
+
+// GithubPushDirect commits the planned change directly to the base branch, without opening a PR.
+// This bypasses review, so it refuses to push to a branch whose protection requires reviews or status checks.
+func GithubPushDirect(ctx context.Context, input Input, repoLimiter *time.Ticker, pushLimiter *time.Ticker) (Output, error) {
+	gitRevParse := exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
+	gitRevParse.Dir = input.PlanDir
+	sha, err := gitRevParse.CombinedOutput()
+	if err != nil {
+		return Output{Success: false}, errors.New(string(sha))
+	}
+
+	base := input.BaseBranch
+	if base == "" {
+		base = DefaultBaseBranch
+	}
+	client := ghclient.New(ctx, ghclient.Campaign)
+	if err := checkDirectPushAllowed(ctx, client, input.RepoOwner, input.RepoName, base, repoLimiter); err != nil {
+		return Output{Success: false}, err
+	}
+
+	// Not a force push: if the base branch has moved on, the push fails rather than overwriting it
+	<-pushLimiter.C
+	gitPush := exec.CommandContext(ctx, "git", "push", "origin", fmt.Sprintf("HEAD:refs/heads/%s", base))
+	gitPush.Dir = input.PlanDir
+	if output, err := gitPush.CombinedOutput(); err != nil {
+		return Output{Success: false}, fmt.Errorf("direct push to %s failed: %s", base, string(output))
+	}
+
+	return Output{
+		Success:      true,
+		CommitSHA:    strings.TrimSpace(string(sha)),
+		DirectCommit: true,
+		DirectBranch: base,
+	}, nil
+}
+
+// checkDirectPushAllowed returns an error if a branch's protection means changes must go through a PR
+func checkDirectPushAllowed(ctx context.Context, client *github.Client, owner, repo, branch string, repoLimiter *time.Ticker) error {
+	<-repoLimiter.C
+	b, _, err := client.Repositories.GetBranch(ctx, owner, repo, branch)
+	if err != nil {
+		return err
+	}
+	if !b.GetProtected() {
+		return nil
+	}
+
+	<-repoLimiter.C
+	protection, _, err := client.Repositories.GetBranchProtection(ctx, owner, repo, branch)
+	if err != nil {
+		// Be conservative: if the rules can't be read, assume they require a PR
+		return fmt.Errorf("refusing to commit directly to protected branch %s, unable to read its protection rules: %s", branch, err.Error())
+	}
+	if protection.RequiredPullRequestReviews != nil {
+		return fmt.Errorf("refusing to commit directly to %s, its protection requires PR reviews", branch)
+	}
+	if protection.RequiredStatusChecks != nil {
+		return fmt.Errorf("refusing to commit directly to %s, its protection requires status checks", branch)
+	}
+	return nil
+}
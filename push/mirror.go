@@ -0,0 +1,61 @@
+package push
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// RemotePush is the outcome of pushing a branch to an additional remote, e.g. a mirror
+type RemotePush struct {
+	Remote  string
+	Branch  string
+	Success bool
+	Error   string `json:",omitempty"`
+}
+
+// MirrorTokenEnvVar, if set, is a token used to push to a mirror over https, e.g. a Gitlab access token.
+// Mirrors with ssh URLs authenticate with ssh keys as usual.
+const MirrorTokenEnvVar = "MICROPLANE_MIRROR_TOKEN"
+
+// PushToRemote force-pushes a commit to a branch on another remote of the planned repo, e.g. a mirror added by clone
+func PushToRemote(ctx context.Context, planDir, remote, sha, branch string) RemotePush {
+	result := RemotePush{Remote: remote, Branch: branch}
+	cmd := exec.CommandContext(ctx, "git", "push", "-f", remote, fmt.Sprintf("%s:refs/heads/%s", sha, branch))
+	cmd.Dir = planDir
+	if token := os.Getenv(MirrorTokenEnvVar); token != "" {
+		// Gitlab accepts access tokens as the password of the "oauth2" user.
+		// It's passed in the environment rather than with -c, which would show it in process listings.
+		auth := base64.StdEncoding.EncodeToString([]byte("oauth2:" + token))
+		cmd.Env = gitConfigEnv(os.Environ(), "http.extraHeader", "Authorization: Basic "+auth)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		result.Error = strings.TrimSpace(string(output))
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+// gitConfigEnv adds a git config setting to env, with the GIT_CONFIG_COUNT, GIT_CONFIG_KEY_<n> and
+// GIT_CONFIG_VALUE_<n> env vars, after any that are already set
+func gitConfigEnv(env []string, key, value string) []string {
+	count := 0
+	withoutCount := []string{}
+	for _, e := range env {
+		if strings.HasPrefix(e, "GIT_CONFIG_COUNT=") {
+			count, _ = strconv.Atoi(strings.TrimPrefix(e, "GIT_CONFIG_COUNT="))
+			continue
+		}
+		withoutCount = append(withoutCount, e)
+	}
+	return append(withoutCount,
+		fmt.Sprintf("GIT_CONFIG_COUNT=%d", count+1),
+		fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", count, key),
+		fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", count, value),
+	)
+}
@@ -0,0 +1,16 @@
+package push
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitConfigEnv(t *testing.T) {
+	assert.Equal(t,
+		[]string{"HOME=/root", "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0=Authorization: Basic abc"},
+		gitConfigEnv([]string{"HOME=/root"}, "http.extraHeader", "Authorization: Basic abc"))
+	assert.Equal(t,
+		[]string{"GIT_CONFIG_KEY_0=core.autocrlf", "GIT_CONFIG_VALUE_0=false", "GIT_CONFIG_COUNT=2", "GIT_CONFIG_KEY_1=http.extraHeader", "GIT_CONFIG_VALUE_1=x"},
+		gitConfigEnv([]string{"GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=core.autocrlf", "GIT_CONFIG_VALUE_0=false"}, "http.extraHeader", "x"))
+}
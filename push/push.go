@@ -5,13 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"os"
 	"os/exec"
 	"strings"
 	"time"
 
-	"golang.org/x/oauth2"
-
+	"github.com/Clever/microplane/ghclient"
 	"github.com/google/go-github/github"
 )
 
@@ -41,6 +39,18 @@ type Input struct {
 	RepoOwner string
 	// BranchName is the branch name in Git
 	BranchName string
+	// BaseBranch is the branch the PR is opened against. Defaults to DefaultBaseBranch.
+	BaseBranch string
+	// Ref is the commit to push to BranchName. Defaults to HEAD.
+	Ref string
+	// Reviewers are users whose review is requested on the PR
+	Reviewers []string
+	// Labels are added to the PR
+	Labels []string
+	// SupersedePrefix, if set, closes our open PRs from previous runs whose branch starts with it, see closeSuperseded
+	SupersedePrefix string
+	// Direct commits to BaseBranch rather than opening a PR, see GithubPushDirect
+	Direct bool
 }
 
 // Output from Push()
@@ -52,9 +62,34 @@ type Output struct {
 	PullRequestCombinedStatus string // failure, pending, or success
 	PullRequestAssignee       string
 	CircleCIBuildURL          string
+	// BaseBranch is the branch the PR was opened against, e.g. the repo's default branch
+	BaseBranch string `json:",omitempty"`
+	// DirectCommit records that the change was committed directly to DirectBranch, bypassing review
+	DirectCommit bool   `json:",omitempty"`
+	DirectBranch string `json:",omitempty"`
+	// Remotes are the outcomes of pushing to other remotes, e.g. a mirror, see PushToRemote
+	Remotes []RemotePush `json:",omitempty"`
+	// SupersededPRs are the numbers of previous PRs that were closed in favor of this one
+	SupersededPRs []int `json:",omitempty"`
+	// SupersedeError is why closing the superseded PRs failed, after the PR was opened
+	SupersedeError string `json:",omitempty"`
+	// SplitPRs are the PRs opened when the change was split into several PRs, see SplitCommit
+	SplitPRs []SplitPR `json:",omitempty"`
+}
+
+// SplitPR is one of several PRs opened for a repo, each containing part of the change
+type SplitPR struct {
+	Group             string
+	BranchName        string
+	CommitSHA         string
+	PullRequestURL    string
+	PullRequestNumber int
 }
 
 func (o Output) String() string {
+	if o.DirectCommit {
+		return fmt.Sprintf("committed directly to %s (%s), without a PR", o.DirectBranch, o.CommitSHA)
+	}
 	s := "status:"
 	switch o.PullRequestCombinedStatus {
 	case "failure":
@@ -86,7 +121,11 @@ func GithubPush(ctx context.Context, input Input, repoLimiter *time.Ticker, push
 	}
 
 	// Push the commit
-	gitHeadBranch := fmt.Sprintf("HEAD:%s", input.BranchName)
+	ref := input.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	gitHeadBranch := fmt.Sprintf("%s:refs/heads/%s", ref, input.BranchName)
 	cmd = Command{Path: "git", Args: []string{"push", "-f", "origin", gitHeadBranch}}
 	gitPush := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
 	gitPush.Dir = input.PlanDir
@@ -94,36 +133,16 @@ func GithubPush(ctx context.Context, input Input, repoLimiter *time.Ticker, push
 		return Output{Success: false}, errors.New(string(output))
 	}
 
-	// Create Github Client
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: os.Getenv("GITHUB_API_TOKEN")},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
-
-	if os.Getenv("GITHUB_URL") != "" {
-		baseEndpoint, _ := url.Parse(os.Getenv("GITHUB_URL"))
-		client.BaseURL = baseEndpoint
-		uploadEndpoint, _ := url.Parse(os.Getenv("GITHUB_URL") + "upload/")
-		client.UploadURL = uploadEndpoint
-	}
+	client := ghclient.New(ctx, ghclient.Campaign)
 
 	// Open a pull request, if one doesn't exist already
 	head := fmt.Sprintf("%s:%s", input.RepoOwner, input.BranchName)
-	base := "master"
-
-	// Determine PR title and body
-	// Title is first line of commit message.
-	// Body is given by body-file if it exists or is the remainder of the commit message after title.
-	title := input.CommitMessage
-	body := ""
-	splitMsg := strings.SplitN(input.CommitMessage, "\n", 2)
-	if len(splitMsg) == 2 {
-		title = splitMsg[0]
-		if input.PRBody == "" {
-			body = splitMsg[1]
-		}
+	base := input.BaseBranch
+	if base == "" {
+		base = DefaultBaseBranch
 	}
+
+	title, body := PRTitleAndBody(input)
 	pr, err := findOrCreatePR(ctx, client, input.RepoOwner, input.RepoName, &github.NewPullRequest{
 		Title: &title,
 		Body:  &body,
@@ -142,6 +161,32 @@ func GithubPush(ctx context.Context, input Input, repoLimiter *time.Ticker, push
 		}
 	}
 
+	if len(input.Reviewers) > 0 {
+		<-repoLimiter.C
+		_, _, err := client.PullRequests.RequestReviewers(ctx, input.RepoOwner, input.RepoName, pr.GetNumber(), github.ReviewersRequest{Reviewers: input.Reviewers})
+		if err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	if len(input.Labels) > 0 {
+		<-repoLimiter.C
+		_, _, err := client.Issues.AddLabelsToIssue(ctx, input.RepoOwner, input.RepoName, pr.GetNumber(), input.Labels)
+		if err != nil {
+			return Output{Success: false}, err
+		}
+	}
+
+	// the PR is open regardless, so failing to close the PRs it supersedes isn't a failure to push
+	var superseded []int
+	supersedeError := ""
+	if input.SupersedePrefix != "" {
+		superseded, err = closeSuperseded(ctx, client, input, pr, repoLimiter)
+		if err != nil {
+			supersedeError = fmt.Sprintf("error closing superseded PRs: %s", err.Error())
+		}
+	}
+
 	<-repoLimiter.C
 	cs, _, err := client.Repositories.GetCombinedStatus(ctx, input.RepoOwner, input.RepoName, *pr.Head.SHA, nil)
 	if err != nil {
@@ -172,9 +217,27 @@ func GithubPush(ctx context.Context, input Input, repoLimiter *time.Ticker, push
 		PullRequestCombinedStatus: *cs.State,
 		PullRequestAssignee:       input.PRAssignee,
 		CircleCIBuildURL:          circleCIBuildURL,
+		SupersededPRs:             superseded,
+		SupersedeError:            supersedeError,
 	}, nil
 }
 
+// PRTitleAndBody determines the PR title and body
+// Title is first line of commit message.
+// Body is given by body-file if it exists or is the remainder of the commit message after title.
+func PRTitleAndBody(input Input) (title, body string) {
+	title = input.CommitMessage
+	body = input.PRBody
+	splitMsg := strings.SplitN(input.CommitMessage, "\n", 2)
+	if len(splitMsg) == 2 {
+		title = splitMsg[0]
+		if input.PRBody == "" {
+			body = splitMsg[1]
+		}
+	}
+	return title, body
+}
+
 func findOrCreatePR(ctx context.Context, client *github.Client, owner string, name string, pull *github.NewPullRequest, repoLimiter *time.Ticker, pushLimiter *time.Ticker) (*github.PullRequest, error) {
 	var pr *github.PullRequest
 	<-pushLimiter.C
@@ -215,3 +278,11 @@ func findOrCreatePR(ctx context.Context, client *github.Client, owner string, na
 func different(s1, s2 *string) bool {
 	return s1 != nil && s2 != nil && *s1 != *s2
 }
+
+// GithubPRDiff fetches the diff of an open pull request
+func GithubPRDiff(ctx context.Context, owner, name string, number int, repoLimiter *time.Ticker) (string, error) {
+	client := ghclient.New(ctx, ghclient.Campaign)
+	<-repoLimiter.C
+	diff, _, err := client.PullRequests.GetRaw(ctx, owner, name, number, github.RawOptions{Type: github.Diff})
+	return diff, err
+}
@@ -14,6 +14,9 @@ import (
 
 // GitlabPush pushes the commit to Gitlab and opens a pull request
 func GitlabPush(ctx context.Context, input Input, repoLimiter *time.Ticker, pushLimiter *time.Ticker) (Output, error) {
+	if input.Direct {
+		return Output{Success: false}, fmt.Errorf("direct commits are only supported on Github")
+	}
 	// Get the commit SHA from the last commit
 	cmd := Command{Path: "git", Args: []string{"log", "-1", "--pretty=format:%H"}}
 	gitLog := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
@@ -24,7 +27,11 @@ func GitlabPush(ctx context.Context, input Input, repoLimiter *time.Ticker, push
 	}
 
 	// Push the commit
-	gitHeadBranch := fmt.Sprintf("HEAD:%s", input.BranchName)
+	ref := input.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	gitHeadBranch := fmt.Sprintf("%s:refs/heads/%s", ref, input.BranchName)
 	cmd = Command{Path: "git", Args: []string{"push", "-f", "origin", gitHeadBranch}}
 	gitPush := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
 	gitPush.Dir = input.PlanDir
@@ -40,21 +47,13 @@ func GitlabPush(ctx context.Context, input Input, repoLimiter *time.Ticker, push
 
 	// Open a pull request, if one doesn't exist already
 	head := input.BranchName
-	base := "master"
-
-	// Determine MR title and body
-	// Title is first line of commit message.
-	// Body is given by body-file if it exists or is the remainder of the commit message after title.
-	title := input.CommitMessage
-	body := ""
-	splitMsg := strings.SplitN(input.CommitMessage, "\n", 2)
-	if len(splitMsg) == 2 {
-		title = splitMsg[0]
-		if input.PRBody == "" {
-			body = splitMsg[1]
-		}
+	base := input.BaseBranch
+	if base == "" {
+		base = DefaultBaseBranch
 	}
 
+	title, body := PRTitleAndBody(input)
+
 	pr, err := findOrCreateGitlabMR(ctx, client, input.RepoOwner, input.RepoName, &gitlab.CreateMergeRequestOptions{
 		Title:        &title,
 		Description:  &body,
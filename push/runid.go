@@ -0,0 +1,33 @@
+package push
+
+import (
+	"strings"
+)
+
+// RunIDFooter is the key of the footer that identifies the campaign a PR or commit came from,
+// e.g. "microplane-run: 20190214-9f1c2e4a". It's a git trailer, so `git log --format=%(trailers)` shows it.
+const RunIDFooter = "microplane-run"
+
+// WithRunID appends the run ID footer to a commit message or PR body, unless it's already there
+func WithRunID(text, runID string) string {
+	if runID == "" || ParseRunID(text) == runID {
+		return text
+	}
+	footer := RunIDFooter + ": " + runID
+	if strings.TrimSpace(text) == "" {
+		return footer
+	}
+	return strings.TrimRight(text, "\n") + "\n\n" + footer
+}
+
+// ParseRunID returns the run ID in a commit message or PR body's footer, or "" if it has none
+func ParseRunID(text string) string {
+	lines := strings.Split(text, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, RunIDFooter+":") {
+			return strings.TrimSpace(strings.TrimPrefix(line, RunIDFooter+":"))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,24 @@
+package push
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRunID(t *testing.T) {
+	assert.Equal(t, "upgrade go\n\nmicroplane-run: abc", WithRunID("upgrade go\n", "abc"))
+	assert.Equal(t, "upgrade go\n\nbecause\n\nmicroplane-run: abc", WithRunID("upgrade go\n\nbecause", "abc"))
+	assert.Equal(t, "microplane-run: abc", WithRunID("", "abc"))
+	assert.Equal(t, "upgrade go", WithRunID("upgrade go", ""))
+
+	// idempotent, e.g. when a commit message carrying the footer is rendered into a PR body
+	once := WithRunID("upgrade go", "abc")
+	assert.Equal(t, once, WithRunID(once, "abc"))
+}
+
+func TestParseRunID(t *testing.T) {
+	assert.Equal(t, "abc", ParseRunID("upgrade go\n\nmicroplane-run: abc\n"))
+	assert.Equal(t, "abc", ParseRunID("upgrade go\n\nmicroplane-run: abc\r\nCo-authored-by: a <a@example.com>"))
+	assert.Equal(t, "", ParseRunID("upgrade go"))
+}
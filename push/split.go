@@ -0,0 +1,146 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FileChange is a file changed by the planned commit
+type FileChange struct {
+	// Status is the git status letter, e.g. "A", "M", or "D"
+	Status string
+	Path   string
+}
+
+// rootGroup is the group for files that aren't in a directory, or that don't match a manifest
+const rootGroup = "root"
+
+// ChangedFiles lists the files changed by the planned commit, i.e. HEAD
+func ChangedFiles(ctx context.Context, planDir string) ([]FileChange, error) {
+	cmd := exec.CommandContext(ctx, "git", "diff", "--name-status", "--no-renames", "HEAD^", "HEAD")
+	cmd.Dir = planDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, errors.New(string(output))
+	}
+	files := []FileChange{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		files = append(files, FileChange{Status: parts[0], Path: parts[1]})
+	}
+	return files, nil
+}
+
+// GroupByTopLevelDir groups changed files by their top-level directory.
+// Files at the root of the repo are grouped together.
+func GroupByTopLevelDir(files []FileChange) map[string][]FileChange {
+	groups := map[string][]FileChange{}
+	for _, f := range files {
+		group := rootGroup
+		if i := strings.Index(f.Path, "/"); i > 0 {
+			group = f.Path[:i]
+		}
+		groups[group] = append(groups[group], f)
+	}
+	return groups
+}
+
+// GroupByManifest groups changed files using a manifest that maps group names to path prefixes.
+// A file matching several groups goes to the one with the longest matching prefix, i.e. the most specific.
+// Files matching no group are grouped together.
+func GroupByManifest(files []FileChange, manifest map[string][]string) map[string][]FileChange {
+	// check groups in a consistent order, in case a file matches the same prefix in several
+	names := []string{}
+	for name := range manifest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	groups := map[string][]FileChange{}
+	for _, f := range files {
+		group := rootGroup
+		longest := -1
+		for _, name := range names {
+			for _, prefix := range manifest[name] {
+				if strings.HasPrefix(f.Path, prefix) && len(prefix) > longest {
+					group = name
+					longest = len(prefix)
+				}
+			}
+		}
+		groups[group] = append(groups[group], f)
+	}
+	return groups
+}
+
+var invalidBranchChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SplitBranchName is the branch for one group of a split change
+func SplitBranchName(branchName, group string) string {
+	return fmt.Sprintf("%s-%s", branchName, strings.Trim(invalidBranchChars.ReplaceAllString(group, "-"), "-"))
+}
+
+// SplitCommit creates a commit, on top of the planned commit's parent, containing only some of its changed files.
+// It uses a temporary index, so the planned working tree is left as is. It returns the new commit's SHA.
+func SplitCommit(ctx context.Context, planDir string, files []FileChange, message string) (string, error) {
+	indexFile, err := filepath.Abs(filepath.Join(planDir, ".git", fmt.Sprintf("microplane-split-%d.index", os.Getpid())))
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(indexFile)
+
+	git := func(args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = planDir
+		cmd.Env = append(os.Environ(), "GIT_INDEX_FILE="+indexFile)
+		output, err := cmd.Output()
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				return "", fmt.Errorf("git %s: %s", args[0], string(exitErr.Stderr))
+			}
+			return "", err
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	if _, err := git("read-tree", "HEAD^"); err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		if f.Status == "D" {
+			if _, err := git("update-index", "--force-remove", "--", f.Path); err != nil {
+				return "", err
+			}
+			continue
+		}
+		// e.g. "100644 blob 3b18e512dba79e4c8300dd08aeb37f8e728b8dad\tREADME.md"
+		entry, err := git("ls-tree", "HEAD", "--", f.Path)
+		if err != nil {
+			return "", err
+		}
+		fields := strings.Fields(strings.SplitN(entry, "\t", 2)[0])
+		if len(fields) != 3 {
+			return "", fmt.Errorf("unexpected: could not find %s in planned commit", f.Path)
+		}
+		cacheInfo := fmt.Sprintf("%s,%s,%s", fields[0], fields[2], f.Path)
+		if _, err := git("update-index", "--add", "--cacheinfo", cacheInfo); err != nil {
+			return "", err
+		}
+	}
+
+	tree, err := git("write-tree")
+	if err != nil {
+		return "", err
+	}
+	return git("commit-tree", tree, "-p", "HEAD^", "-m", message)
+}
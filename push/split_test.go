@@ -0,0 +1,50 @@
+package push
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testFiles = []FileChange{
+	{Status: "M", Path: "README.md"},
+	{Status: "M", Path: "api/server.go"},
+	{Status: "A", Path: "api/v2/server.go"},
+	{Status: "D", Path: "web/index.js"},
+}
+
+func TestGroupByTopLevelDir(t *testing.T) {
+	assert.Equal(t, map[string][]FileChange{
+		"root": {testFiles[0]},
+		"api":  {testFiles[1], testFiles[2]},
+		"web":  {testFiles[3]},
+	}, GroupByTopLevelDir(testFiles))
+}
+
+func TestGroupByManifest(t *testing.T) {
+	assert.Equal(t, map[string][]FileChange{
+		"root":     {testFiles[0], testFiles[3]},
+		"api-v1":   {testFiles[1]},
+		"api-next": {testFiles[2]},
+	}, GroupByManifest(testFiles, map[string][]string{
+		"api-next": {"api/v2/"},
+		"api-v1":   {"api/"},
+	}))
+}
+
+func TestGroupByManifestLongestPrefix(t *testing.T) {
+	// "api" sorts before "api-v2", but the more specific prefix wins
+	assert.Equal(t, map[string][]FileChange{
+		"root":   {testFiles[0], testFiles[3]},
+		"api":    {testFiles[1]},
+		"api-v2": {testFiles[2]},
+	}, GroupByManifest(testFiles, map[string][]string{
+		"api":    {"api/"},
+		"api-v2": {"api/v2/"},
+	}))
+}
+
+func TestSplitBranchName(t *testing.T) {
+	assert.Equal(t, "microplaning-api", SplitBranchName("microplaning", "api"))
+	assert.Equal(t, "microplaning-my-group", SplitBranchName("microplaning", "my group/"))
+}
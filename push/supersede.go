@@ -0,0 +1,63 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// closeSuperseded closes open PRs left over from previous runs of a campaign, now that pr replaces them.
+// To avoid closing anyone else's PRs, only PRs that match all of these are closed:
+// - the head branch starts with input.SupersedePrefix, and isn't pr's branch
+// - the head branch is in the repo itself, not a fork
+// - the PR was opened by the authenticated user
+func closeSuperseded(ctx context.Context, client *github.Client, input Input, pr *github.PullRequest, repoLimiter *time.Ticker) ([]int, error) {
+	<-repoLimiter.C
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []*github.PullRequest{}
+	opts := &github.PullRequestListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		<-repoLimiter.C
+		prs, resp, err := client.PullRequests.List(ctx, input.RepoOwner, input.RepoName, opts)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, prs...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	closed := []int{}
+	for _, old := range candidates {
+		head := old.GetHead()
+		if old.GetNumber() == pr.GetNumber() ||
+			head.GetRef() == input.BranchName ||
+			!strings.HasPrefix(head.GetRef(), input.SupersedePrefix) ||
+			head.GetRepo().GetFullName() != fmt.Sprintf("%s/%s", input.RepoOwner, input.RepoName) ||
+			old.GetUser().GetLogin() != user.GetLogin() {
+			continue
+		}
+
+		comment := fmt.Sprintf("Superseded by #%d, from a newer run of this campaign.", pr.GetNumber())
+		<-repoLimiter.C
+		if _, _, err := client.Issues.CreateComment(ctx, input.RepoOwner, input.RepoName, old.GetNumber(), &github.IssueComment{Body: &comment}); err != nil {
+			return closed, err
+		}
+		state := "closed"
+		<-repoLimiter.C
+		if _, _, err := client.PullRequests.Edit(ctx, input.RepoOwner, input.RepoName, old.GetNumber(), &github.PullRequest{State: &state}); err != nil {
+			return closed, err
+		}
+		closed = append(closed, old.GetNumber())
+	}
+	return closed, nil
+}
@@ -0,0 +1,48 @@
+package push
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/Clever/microplane/plan"
+)
+
+// DefaultBaseBranch is the branch that pull requests are opened against
+const DefaultBaseBranch = "master"
+
+// TemplateData are the per-repo variables available when rendering templates, e.g. the PR body
+type TemplateData struct {
+	// Repo is the name of the repo, without the owner
+	Repo string
+	// Org is the owner of the repo
+	Org string
+	// DefaultBranch is the branch the PR is opened against
+	DefaultBranch string
+	// BranchName is the branch containing the change
+	BranchName string
+	// CommitMessage is the commit message from the plan step
+	CommitMessage string
+	// Diff is the git diff from the plan step
+	Diff string
+}
+
+var templateFuncs = template.FuncMap{
+	// diffstat summarizes a diff, e.g. `{{diffstat .Diff}}`
+	"diffstat": func(diff string) string {
+		return plan.ParseDiffStat(diff).String()
+	},
+}
+
+// NewTemplate parses a template that can be rendered per repo with TemplateData
+func NewTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+// RenderTemplate executes the template for a single repo
+func RenderTemplate(tmpl *template.Template, data TemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,56 @@
+package push
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testTemplateData = TemplateData{
+	Repo:          "microplane",
+	Org:           "Clever",
+	DefaultBranch: "main",
+	BranchName:    "go-upgrade",
+	CommitMessage: "upgrade go",
+	Diff: `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+-go 1.11
++go 1.12
++// upgraded
+`,
+}
+
+func TestRenderTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"repo variables", "{{.Org}}/{{.Repo}}: {{.BranchName}} -> {{.DefaultBranch}}", "Clever/microplane: go-upgrade -> main"},
+		{"commit message", "{{.CommitMessage}}", "upgrade go"},
+		{"diffstat", "{{diffstat .Diff}}", "1 file(s) changed, 2 insertion(s)(+), 1 deletion(s)(-)"},
+		{"diffstat of no diff", `{{diffstat ""}}`, "0 file(s) changed, 0 insertion(s)(+), 0 deletion(s)(-)"},
+		{"plain text", "no variables", "no variables"},
+	}
+	for _, test := range tests {
+		tmpl, err := NewTemplate(test.name, test.template)
+		assert.NoError(t, err, test.name)
+		got, err := RenderTemplate(tmpl, testTemplateData)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.want, got, test.name)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	_, err := NewTemplate("unknown func", "{{shout .Repo}}")
+	assert.Error(t, err)
+
+	_, err = NewTemplate("unclosed", "{{.Repo")
+	assert.Error(t, err)
+
+	tmpl, err := NewTemplate("unknown field", "{{.Team}}")
+	assert.NoError(t, err)
+	_, err = RenderTemplate(tmpl, testTemplateData)
+	assert.Error(t, err)
+}
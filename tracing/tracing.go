@@ -0,0 +1,243 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// endpoint is where spans are exported with OTLP over HTTP, see Configure. Tracing is disabled if it's empty.
+var endpoint string
+
+// serviceName identifies microplane in the tracing backend
+var serviceName = "microplane"
+
+// finished are the spans that have ended but not been exported yet, see Flush
+var finished struct {
+	sync.Mutex
+	spans []*Span
+}
+
+// Configure enables tracing, exporting spans to an OTLP/HTTP collector, e.g. "http://localhost:4318".
+// Spans are sent to {endpoint}/v1/traces, unless the endpoint already ends with that path.
+func Configure(otlpEndpoint string) {
+	otlpEndpoint = strings.TrimSuffix(otlpEndpoint, "/")
+	if otlpEndpoint != "" && !strings.HasSuffix(otlpEndpoint, "/v1/traces") {
+		otlpEndpoint += "/v1/traces"
+	}
+	endpoint = otlpEndpoint
+}
+
+// Enabled returns whether spans are being recorded
+func Enabled() bool {
+	return endpoint != ""
+}
+
+// Span is a timed operation, e.g. a step, a repo's part of a step, or an API call.
+// A nil Span is valid and does nothing, which is what Start returns when tracing is disabled.
+type Span struct {
+	name       string
+	traceID    string
+	spanID     string
+	parentID   string
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	err        string
+	mu         sync.Mutex
+}
+
+type spanKey struct{}
+
+// Start starts a span as a child of the span in ctx, if any, and returns a context containing it
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	if !Enabled() {
+		return ctx, nil
+	}
+	s := &Span{name: name, spanID: randomID(8), start: time.Now(), attributes: map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		s.traceID = randomID(16)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttribute records a string, int or bool attribute on the span, e.g. the repo
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed, and records the outcome
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End finishes the span. It's exported by the next Flush.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.end = time.Now()
+	s.mu.Unlock()
+	finished.Lock()
+	finished.spans = append(finished.spans, s)
+	finished.Unlock()
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Transport records a span for each HTTP request, as a child of the span in the request's context
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !Enabled() {
+		return t.Base.RoundTrip(req)
+	}
+	_, span := Start(req.Context(), fmt.Sprintf("%s %s", req.Method, req.URL.Path))
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.String())
+	defer span.End()
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return resp, err
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		span.SetError(fmt.Errorf("HTTP %d", resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// Flush exports the spans that have ended since the last Flush
+func Flush() error {
+	if !Enabled() {
+		return nil
+	}
+	finished.Lock()
+	spans := finished.spans
+	finished.spans = nil
+	finished.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(payload(spans))
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error exporting traces: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error exporting traces: %s returned %d", endpoint, resp.StatusCode)
+	}
+	return nil
+}
+
+// OTLP's JSON encoding, see https://github.com/open-telemetry/opentelemetry-proto
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+func attribute(key string, value interface{}) otlpAttribute {
+	switch v := value.(type) {
+	case int:
+		return otlpAttribute{Key: key, Value: map[string]interface{}{"intValue": strconv.Itoa(v)}}
+	case bool:
+		return otlpAttribute{Key: key, Value: map[string]interface{}{"boolValue": v}}
+	default:
+		return otlpAttribute{Key: key, Value: map[string]interface{}{"stringValue": fmt.Sprint(v)}}
+	}
+}
+
+func payload(spans []*Span) map[string]interface{} {
+	out := []otlpSpan{}
+	for _, s := range spans {
+		s.mu.Lock()
+		o := otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              1, // internal
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        []otlpAttribute{},
+		}
+		for k, v := range s.attributes {
+			o.Attributes = append(o.Attributes, attribute(k, v))
+		}
+		outcome := "success"
+		if s.err != "" {
+			outcome = "error"
+			o.Status.Code = 2
+			o.Status.Message = s.err
+		}
+		o.Attributes = append(o.Attributes, attribute("outcome", outcome))
+		s.mu.Unlock()
+		out = append(out, o)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpAttribute{attribute("service.name", serviceName)},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": serviceName},
+						"spans": out,
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisabled(t *testing.T) {
+	Configure("")
+	ctx, span := Start(context.Background(), "step")
+	assert.Nil(t, span)
+	assert.Equal(t, context.Background(), ctx)
+	span.SetAttribute("repo", "microplane")
+	span.End()
+	assert.NoError(t, Flush())
+}
+
+func TestFlush(t *testing.T) {
+	var body map[string]interface{}
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &body)
+	}))
+	defer server.Close()
+	Configure(server.URL)
+	defer Configure("")
+
+	ctx, root := Start(context.Background(), "mp merge")
+	_, child := Start(ctx, "merge microplane")
+	child.SetAttribute("repo", "microplane")
+	child.SetError(fmt.Errorf("PR awaiting review"))
+	child.End()
+	root.End()
+	assert.NoError(t, Flush())
+
+	assert.Equal(t, "/v1/traces", path)
+	spans := body["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if assert.Len(t, spans, 2) {
+		c, r := spans[0].(map[string]interface{}), spans[1].(map[string]interface{})
+		assert.Equal(t, r["traceId"], c["traceId"])
+		assert.Equal(t, r["spanId"], c["parentSpanId"])
+		assert.Nil(t, r["parentSpanId"])
+		assert.Equal(t, "PR awaiting review", c["status"].(map[string]interface{})["message"])
+	}
+}
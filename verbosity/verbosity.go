@@ -0,0 +1,43 @@
+package verbosity
+
+import (
+	"log"
+)
+
+// Level controls how much microplane prints
+type Level int
+
+const (
+	// Quiet only prints errors and warnings
+	Quiet Level = iota
+	// Normal also prints each repo's progress
+	Normal
+	// Verbose also prints details useful for debugging, e.g. API call timing and merge gate evaluations
+	Verbose
+)
+
+var level = Normal
+
+// Set the verbosity level
+func Set(l Level) {
+	level = l
+}
+
+// IsVerbose returns whether debugging details should be printed
+func IsVerbose() bool {
+	return level >= Verbose
+}
+
+// Printf logs progress, unless quiet
+func Printf(format string, v ...interface{}) {
+	if level >= Normal {
+		log.Printf(format, v...)
+	}
+}
+
+// Debugf logs debugging details, only if verbose
+func Debugf(format string, v ...interface{}) {
+	if level >= Verbose {
+		log.Printf(format, v...)
+	}
+}